@@ -6,18 +6,31 @@ import (
 	"expvar"
 	"fmt"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/MohammadTaghipour/social/docs"
+	"github.com/MohammadTaghipour/social/internal/activitypub"
 	"github.com/MohammadTaghipour/social/internal/auth"
+	"github.com/MohammadTaghipour/social/internal/digest"
 	"github.com/MohammadTaghipour/social/internal/env"
+	"github.com/MohammadTaghipour/social/internal/jobs"
 	"github.com/MohammadTaghipour/social/internal/mailer"
+	"github.com/MohammadTaghipour/social/internal/notifications"
+	"github.com/MohammadTaghipour/social/internal/outbox"
+	"github.com/MohammadTaghipour/social/internal/ranking"
 	"github.com/MohammadTaghipour/social/internal/ratelimiter"
+	"github.com/MohammadTaghipour/social/internal/scheduler"
 	"github.com/MohammadTaghipour/social/internal/store"
 	"github.com/MohammadTaghipour/social/internal/store/cache"
+	"github.com/MohammadTaghipour/social/internal/stream"
+	"github.com/MohammadTaghipour/social/internal/timeline"
+	"github.com/MohammadTaghipour/social/internal/webhooks"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -32,7 +45,17 @@ type application struct {
 	logger        *zap.SugaredLogger
 	mailer        mailer.Client
 	authenticator auth.Authenticator
-	ratelimiter   ratelimiter.Limiter
+	ratelimiter   *ratelimiter.Policies
+	scorer        *ranking.Scorer
+	timeline      *timeline.Service
+	federation    *activitypub.Service
+	notifications *notifications.Service
+	stream        *stream.Broker
+	webhooks      *webhooks.Service
+	outbox        *outbox.Dispatcher
+	jobs          *jobs.Runner
+	scheduler     *scheduler.Scheduler
+	digest        *digest.Generator
 }
 
 type config struct {
@@ -45,10 +68,41 @@ type config struct {
 	auth        authConfig
 	frontendURL string
 	ratelimiter ratelimiter.Config
+	// trustedProxies may set the client address with X-Forwarded-For
+	trustedProxies []netip.Prefix
+	comments       commentsConfig
+	pagination     paginationConfig
+	ranking        ranking.Config
+	timeline       timeline.Config
+	syndication    syndicationConfig
+	federation     activitypub.Config
+	stream         stream.Config
+	webhooks       webhooks.Config
+	outbox         outbox.Config
+	jobs           jobs.Config
+	scheduler      schedulerConfig
+	digest         digest.Config
+}
+
+type syndicationConfig struct {
+	itemLimit int
+}
+
+type commentsConfig struct {
+	embedLimit int
+}
+
+type paginationConfig struct {
+	cursorSecret string
 }
 
 type mailConfig struct {
+	// provider is mailhog, smtp, api or file
+	provider  string
 	mailHog   mailHogConfig
+	smtp      mailer.SMTPConfig
+	api       mailAPIConfig
+	file      mailFileConfig
 	fromEmail string
 	exp       time.Duration
 }
@@ -57,6 +111,15 @@ type mailHogConfig struct {
 	addr string
 }
 
+type mailAPIConfig struct {
+	url    string
+	apiKey string
+}
+
+type mailFileConfig struct {
+	dir string
+}
+
 type dbConfig struct {
 	addr         string
 	maxOpenConns int
@@ -95,29 +158,34 @@ func (app *application) mount() http.Handler {
 		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(realIP(app.config.trustedProxies))
+	// keeps the stream's access_token out of the logs
+	r.Use(streamTokenMiddleware)
 	r.Use(middleware.Logger)
 	// must be upper than rate limiter
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{env.GetString("CORS_ALLOWED_ORIGIN", "http://localhost:5678")}, // Use this to allow specific origin hosts
 		// AllowedOrigins: []string{"https://*", "http://*"}, // for development
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
-	r.Use(app.RateLimiterMiddleware)
+	r.Use(unlessStreaming(middleware.Timeout(60 * time.Second)))
+
+	if app.federation != nil {
+		r.With(app.RateLimiterMiddleware).Get("/.well-known/webfinger", app.webfingerHandler)
+	}
 
 	r.Route("/v1", func(r chi.Router) {
 		// Operations
@@ -131,6 +199,7 @@ func (app *application) mount() http.Handler {
 		// feature Posts
 		r.Route("/post", func(r chi.Router) {
 			r.Use(app.JwtAuthMiddleware())
+			r.Use(app.RateLimiterMiddleware)
 
 			r.Post("/create", app.createPostHandler)
 
@@ -140,31 +209,185 @@ func (app *application) mount() http.Handler {
 				// also r.with(...) can be used for authorization
 				r.Delete("/", app.CheckPostOwnership("admin", app.deletePostHandler))
 				r.Patch("/", app.CheckPostOwnership("moderator", app.updatePostHandler))
-				r.Post("/comments", app.createCommentHandler)
+				r.Put("/reactions", app.reactPostHandler)
+				r.Delete("/reactions", app.unreactPostHandler)
+				r.Put("/repost", app.repostHandler)
+				r.Delete("/repost", app.unrepostHandler)
+
+				r.Route("/comments", func(r chi.Router) {
+					r.Get("/", app.getPostCommentsHandler)
+					r.Post("/", app.createCommentHandler)
+
+					r.Route("/{commentID}", func(r chi.Router) {
+						r.Use(app.commentsContextMiddleware)
+						r.Get("/replies", app.getCommentRepliesHandler)
+						r.Patch("/", app.CheckCommentOwnership("moderator", app.updateCommentHandler))
+						r.Delete("/", app.CheckCommentOwnership("moderator", app.deleteCommentHandler))
+						r.Put("/reactions", app.reactCommentHandler)
+						r.Delete("/reactions", app.unreactCommentHandler)
+					})
+				})
 			})
 		})
 
 		// feature Users
 		r.Route("/user", func(r chi.Router) {
-			r.Put("/activate/{token}", app.activateUserHandler)
+			r.With(app.RateLimiterMiddleware).Put("/activate/{token}", app.activateUserHandler)
 
 			r.Route("/{userID}", func(r chi.Router) {
-				r.Use(app.JwtAuthMiddleware())
-
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+				// public so feed readers can subscribe
+				r.Group(func(r chi.Router) {
+					r.Use(app.RateLimiterMiddleware)
+
+					r.Get("/posts.rss", app.getUserPostsRSSHandler)
+					r.Get("/posts.atom", app.getUserPostsAtomHandler)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.JwtAuthMiddleware())
+					r.Use(app.RateLimiterMiddleware)
+
+					r.Get("/", app.getUserHandler)
+					r.Put("/follow", app.followUserHandler)
+					r.Put("/unfollow", app.unfollowUserHandler)
+					r.Put("/block", app.blockUserHandler)
+					r.Put("/unblock", app.unblockUserHandler)
+				})
 			})
 
 			r.Group(func(r chi.Router) {
 				r.Use(app.JwtAuthMiddleware())
+				r.Use(app.RateLimiterMiddleware)
 
 				r.Get("/feed", app.getUserFeedHandler)
+				r.Put("/locale", app.updateUserLocaleHandler)
+				r.Get("/digest", app.getDigestPreferencesHandler)
+				r.Put("/digest", app.updateDigestPreferencesHandler)
+			})
+
+		})
+
+		r.Route("/me", func(r chi.Router) {
+			r.Use(app.JwtAuthMiddleware())
+			r.Use(app.RateLimiterMiddleware)
+
+			r.Get("/quota", app.getQuotaHandler)
+		})
+
+		// feature Feed
+		r.Route("/feed", func(r chi.Router) {
+			r.Use(app.JwtAuthMiddleware())
+			r.Use(app.RateLimiterMiddleware)
+
+			r.Get("/explore", app.getExploreFeedHandler)
+		})
+
+		// feature Syndication
+		r.Route("/tag/{tag}", func(r chi.Router) {
+			r.Use(app.RateLimiterMiddleware)
+
+			r.Get("/posts.rss", app.getTagPostsRSSHandler)
+			r.Get("/posts.atom", app.getTagPostsAtomHandler)
+		})
+
+		// feature Federation
+		if app.federation != nil {
+			r.Route("/ap", func(r chi.Router) {
+				r.Use(app.RateLimiterMiddleware)
+
+				r.Get("/posts/{postID}", app.getNoteHandler)
+
+				r.Route("/users/{username}", func(r chi.Router) {
+					r.Use(app.apUserContextMiddleware)
+
+					r.Get("/", app.getActorHandler)
+					r.Get("/outbox", app.getOutboxHandler)
+					r.Post("/inbox", app.postInboxHandler)
+				})
+			})
+		}
+
+		// feature Notifications
+		r.Route("/notifications", func(r chi.Router) {
+			r.Use(app.JwtAuthMiddleware())
+			r.Use(app.RateLimiterMiddleware)
+
+			r.Get("/", app.getNotificationsHandler)
+			r.Get("/unread-count", app.getUnreadNotificationsCountHandler)
+			r.Put("/read", app.markAllNotificationsReadHandler)
+			r.Put("/{notificationID}/read", app.markNotificationReadHandler)
+			r.Get("/preferences", app.getNotificationPreferencesHandler)
+			r.Put("/preferences", app.updateNotificationPreferencesHandler)
+		})
+
+		// feature Stream
+		if app.stream != nil {
+			r.Route("/stream", func(r chi.Router) {
+				r.Use(app.JwtAuthMiddleware())
+				r.Use(app.RateLimiterMiddleware)
+
+				r.Get("/", app.streamHandler)
+			})
+		}
+
+		// feature Webhooks
+		if app.webhooks != nil {
+			r.Route("/webhooks", func(r chi.Router) {
+				r.Use(app.JwtAuthMiddleware())
+				r.Use(app.RateLimiterMiddleware)
+
+				r.Post("/", app.createWebhookHandler)
+				r.Get("/", app.getWebhooksHandler)
+
+				r.Route("/{webhookID}", func(r chi.Router) {
+					r.Use(app.webhooksContextMiddleware)
+
+					r.Get("/", app.getWebhookHandler)
+					r.Delete("/", app.deleteWebhookHandler)
+					r.Put("/enable", app.enableWebhookHandler)
+					r.Get("/deliveries", app.getWebhookDeliveriesHandler)
+					r.Post("/deliveries/{deliveryID}/redeliver", app.redeliverWebhookHandler)
+				})
 			})
+		}
+
+		// feature Digest
+		r.Route("/digest", func(r chi.Router) {
+			r.Use(app.RateLimiterMiddleware)
+
+			r.Get("/unsubscribe", app.unsubscribeDigestPageHandler)
+			r.Post("/unsubscribe", app.unsubscribeDigestHandler)
+		})
+
+		// feature Tags
+		r.Route("/tags", func(r chi.Router) {
+			r.Use(app.JwtAuthMiddleware())
+			r.Use(app.RateLimiterMiddleware)
+
+			r.Get("/trending", app.getTrendingTagsHandler)
+		})
+
+		// feature Admin
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(app.JwtAuthMiddleware())
+			r.Use(app.RateLimiterMiddleware)
+			r.Use(app.RequireRole("admin"))
+
+			r.Get("/scheduler", app.getSchedulerStatusHandler)
+		})
+
+		// feature Search
+		r.Route("/search", func(r chi.Router) {
+			r.Use(app.JwtAuthMiddleware())
+			r.Use(app.RateLimiterMiddleware)
 
+			r.Get("/posts", app.searchPostsHandler)
+			r.Get("/users", app.searchUsersHandler)
 		})
 
 		r.Route("/authentication", func(r chi.Router) {
+			r.Use(app.RateLimit(ratelimiter.PolicyAuth))
+
 			r.Post("/user", app.registerUserHandler)
 			r.Post("/token", app.createTokenHandler)
 		})
@@ -177,7 +400,12 @@ func (app *application) mount() http.Handler {
 func (app *application) run(mux http.Handler) error {
 	// Docs
 	docs.SwaggerInfo.Version = version
-	docs.SwaggerInfo.Host = app.config.apiURL
+	// the docs take the host of EXTERNAL_URL without its scheme
+	host := app.config.apiURL
+	if _, after, ok := strings.Cut(host, "://"); ok {
+		host = after
+	}
+	docs.SwaggerInfo.Host = strings.TrimSuffix(host, "/")
 	docs.SwaggerInfo.BasePath = "/v1"
 
 	srv := &http.Server{
@@ -188,6 +416,50 @@ func (app *application) run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
+	// background workers stop together with the server
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	// workers finish the work in progress before run returns
+	var workers sync.WaitGroup
+	start := func(run func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(ctx)
+		}()
+	}
+
+	if app.config.outbox.Enabled {
+		start(app.outbox.Run)
+	}
+
+	if app.jobs != nil {
+		start(app.jobs.Run)
+	}
+
+	if app.config.ranking.Enabled {
+		start(app.scorer.Run)
+	}
+
+	if app.federation != nil {
+		start(app.federation.Run)
+	}
+
+	if app.scheduler != nil {
+		start(app.scheduler.Run)
+	}
+
+	if app.webhooks != nil {
+		start(app.webhooks.Run)
+	}
+
+	// stopping the broker ends open event streams, so Shutdown does not
+	// wait on them
+	if app.stream != nil {
+		start(app.stream.Run)
+	}
+
 	shutdown := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -199,6 +471,7 @@ func (app *application) run(mux http.Handler) error {
 		defer cancel()
 
 		app.logger.Infow("signal caught", "signal", s.String())
+		stop()
 
 		shutdown <- srv.Shutdown(ctx)
 	}()
@@ -212,6 +485,7 @@ func (app *application) run(mux http.Handler) error {
 	}
 
 	err = <-shutdown
+	workers.Wait()
 
 	app.logger.Infow("Server has stopped", "addr", app.config.addr,
 		"env", app.config.env)
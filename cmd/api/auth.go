@@ -11,7 +11,9 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 
+	"github.com/MohammadTaghipour/social/internal/i18n"
 	"github.com/MohammadTaghipour/social/internal/mailer"
+	"github.com/MohammadTaghipour/social/internal/outbox"
 	"github.com/MohammadTaghipour/social/internal/store"
 )
 
@@ -19,6 +21,8 @@ type RegisterUserPayload struct {
 	Username string `json:"username" validate:"required,max=100"`
 	Email    string `json:"email" validate:"required,email,max=255"`
 	Password string `json:"password" validate:"required,min=3,max=72"`
+	// Locale is optional, emails are sent in the Accept-Language without it
+	Locale string `json:"locale" validate:"max=35"`
 }
 
 type UserWithToken struct {
@@ -55,6 +59,15 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Email:    payload.Email,
 	}
 
+	if payload.Locale != "" {
+		locale, ok := i18n.Lookup(payload.Locale)
+		if !ok {
+			app.statusBadRequestError(w, r, fmt.Errorf("unsupported locale %q", payload.Locale))
+			return
+		}
+		user.Locale = locale.String()
+	}
+
 	// hash the user password
 	if err := user.Password.Set(payload.Password); err != nil {
 		app.statusInternalServerError(w, r, err)
@@ -69,8 +82,27 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	hash := sha256.Sum256([]byte(plainToken))
 	hashToken := hex.EncodeToString(hash[:])
 
+	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken)
+
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.Username,
+		ActivationURL: activationURL,
+	}
+
+	// the activation email is sent by the outbox dispatcher once the user is
+	// stored, the message drops the plaintext token once it was sent
+	invite, err := outbox.NewEmail("user-invitation-"+hashToken, mailer.UserWelcomeTemplate,
+		i18n.Match(user.Locale, r.Header.Get("Accept-Language")).String(), user.Username, user.Email, vars)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
 	// store the user
-	if err := app.store.Users.CreateAndInvite(ctx, user, hashToken, app.config.mail.exp); err != nil {
+	if err := app.store.Users.CreateAndInvite(ctx, user, hashToken, app.config.mail.exp, invite); err != nil {
 		switch err {
 		case store.ErrDuplicateEmail:
 			app.statusBadRequestError(w, r, err)
@@ -87,31 +119,6 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Token: plainToken,
 	}
 
-	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken)
-
-	isProdEnv := app.config.env == "prod"
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      user.Username,
-		ActivationURL: activationURL,
-	}
-
-	// send activation email
-	err := app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
-	if err != nil {
-		app.logger.Errorw("error sending welcome email", "error", err)
-
-		// rollback user creation if email fails (SAGA pattern)
-		if err := app.store.Users.Delete(ctx, user.ID); err != nil {
-			app.logger.Errorw("error deleting user", "error", err)
-		}
-
-		app.statusInternalServerError(w, r, err)
-		return
-	}
-
 	if err := app.jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
@@ -180,6 +187,11 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// signing in holds back digests for the current period
+	if err := app.store.Users.RecordLogin(ctx, user.ID); err != nil {
+		app.logger.Warnw("recording login failed", "user", user.ID, "error", err.Error())
+	}
+
 	// send it to the client
 	if err := app.jsonResponse(w, http.StatusCreated, token); err != nil {
 		app.statusInternalServerError(w, r, err)
@@ -2,18 +2,42 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/MohammadTaghipour/social/internal/notifications"
 	"github.com/MohammadTaghipour/social/internal/store"
+	"github.com/MohammadTaghipour/social/internal/stream"
+	"github.com/MohammadTaghipour/social/internal/webhooks"
+	"github.com/go-chi/chi/v5"
 )
 
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
 type CreateCommentPayload struct {
-	PostID  int64  `json:"post_id" validate:"required"`
-	UserID  int64  `json:"user_id" validate:"required"`
-	Content string `json:"content" validate:"required,max=500"`
+	ParentID *int64 `json:"parent_id" validate:"omitempty,min=1"`
+	Content  string `json:"content" validate:"required,max=500"`
 }
 
+// createCommentHandler godoc
+//
+//	@Summary		Create a comment
+//	@Description	Creates a comment on a post as the authenticated user, optionally as a reply
+//	@Tags			comment
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int						true	"Post ID"
+//	@Param			comment	body		CreateCommentPayload	true	"Comment data"
+//	@Success		201		{object}	store.Comment
+//	@Failure		400		{object}	error	"Invalid request payload"
+//	@Failure		404		{object}	error	"Post not found"
+//	@Failure		500		{object}	error	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postID}/comments [post]
 func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
 	var payload CreateCommentPayload
 
@@ -27,23 +51,389 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
 	comment := store.Comment{
-		Content: payload.Content,
-		PostID:  payload.PostID,
-		UserID:  payload.UserID,
+		Content:  payload.Content,
+		PostID:   post.ID,
+		UserID:   user.ID,
+		ParentID: payload.ParentID,
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	if err := app.store.Comments.Create(ctx, &comment); err != nil {
-		app.statusInternalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusBadRequestError(w, r, errors.New("parent comment not found"))
+		case errors.Is(err, store.ErrMaxCommentDepth):
+			app.statusBadRequestError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
 		return
 	}
 
+	enqueue(ctx, app, notifications.CommentCreatedJob, notifications.CommentArgs{Post: *post, Comment: comment})
+	if app.stream != nil {
+		enqueue(ctx, app, stream.PublishCommentJob, stream.CommentArgs{Post: *post, Comment: comment})
+	}
+	// the post author owns the events of comments on their posts
+	app.triggerWebhooks(ctx, webhooks.EventCommentCreated, post.UserID, comment)
+
 	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
 	}
 
 }
+
+type UpdateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=500"`
+}
+
+// updateCommentHandler godoc
+//
+//	@Summary		Update a comment
+//	@Description	Updates the content of a comment. Only its author or a moderator can do this
+//	@Tags			comment
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int						true	"Post ID"
+//	@Param			commentID	path		int						true	"Comment ID"
+//	@Param			comment		body		UpdateCommentPayload	true	"Updated comment data"
+//	@Success		200			{object}	store.Comment
+//	@Failure		400			{object}	error	"Invalid request payload"
+//	@Failure		403			{object}	error	"Forbidden"
+//	@Failure		404			{object}	error	"Comment not found"
+//	@Failure		409			{object}	error	"Edit conflict"
+//	@Failure		500			{object}	error	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postID}/comments/{commentID} [patch]
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	if comment.IsDeleted {
+		app.statusNotFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	comment.Content = payload.Content
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Comments.Update(ctx, comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusConflictError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// deleteCommentHandler godoc
+//
+//	@Summary		Delete a comment
+//	@Description	Deletes a comment. Comments with replies are kept as a tombstone
+//	@Tags			comment
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path	int	true	"Post ID"
+//	@Param			commentID	path	int	true	"Comment ID"
+//	@Success		204			"No Content"
+//	@Failure		403			{object}	error	"Forbidden"
+//	@Failure		404			{object}	error	"Comment not found"
+//	@Failure		500			{object}	error	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postID}/comments/{commentID} [delete]
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Comments.Delete(ctx, comment.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// getPostCommentsHandler godoc
+//
+//	@Summary		Get post comments
+//	@Description	Returns a cursor paginated page of the top-level comments of a post
+//	@Tags			comment
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int		true	"Post ID"
+//	@Param			limit	query		int		false	"Max items per page"
+//	@Param			sort	query		string	false	"Sort order (newest, oldest or top)"
+//	@Param			cursor	query		string	false	"Cursor returned as next_cursor by the previous page"
+//	@Success		200		{object}	store.CommentsPage
+//	@Failure		400		{object}	error	"Bad Request"
+//	@Failure		404		{object}	error	"Post not found"
+//	@Failure		500		{object}	error	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postID}/comments [get]
+func (app *application) getPostCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	pq, ok := app.parseCommentsQuery(w, r, "newest")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	page, err := app.store.Comments.GetPage(ctx, post.ID, pq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.statusBadRequestError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	page.Total, err = app.store.Comments.CountTopLevel(ctx, post.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// getCommentRepliesHandler godoc
+//
+//	@Summary		Get comment replies
+//	@Description	Returns a cursor paginated page of the direct replies to a comment
+//	@Tags			comment
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int		true	"Post ID"
+//	@Param			commentID	path		int		true	"Comment ID"
+//	@Param			limit		query		int		false	"Max items per page"
+//	@Param			sort		query		string	false	"Sort order (newest, oldest or top)"
+//	@Param			cursor		query		string	false	"Cursor returned as next_cursor by the previous page"
+//	@Success		200			{object}	store.CommentsPage
+//	@Failure		400			{object}	error	"Bad Request"
+//	@Failure		404			{object}	error	"Comment not found"
+//	@Failure		500			{object}	error	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postID}/comments/{commentID}/replies [get]
+func (app *application) getCommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	pq, ok := app.parseCommentsQuery(w, r, "oldest")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	page, err := app.store.Comments.GetReplies(ctx, comment.ID, pq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.statusBadRequestError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	page.Total, err = app.store.Comments.CountReplies(ctx, comment.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// parseCommentsQuery reads and validates the pagination query of the comment
+// listing endpoints, writing a 400 response when it is malformed.
+func (app *application) parseCommentsQuery(w http.ResponseWriter, r *http.Request, defaultSort string) (store.PaginatedCommentsQuery, bool) {
+	pq := store.PaginatedCommentsQuery{
+		Limit: 20,
+		Sort:  defaultSort,
+	}
+
+	pq, err := pq.Parse(r)
+	if err != nil {
+		app.statusBadRequestError(w, r, err)
+		return pq, false
+	}
+
+	if err := validate.Struct(pq); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return pq, false
+	}
+
+	return pq, true
+}
+
+type ReactionPayload struct {
+	Reaction string `json:"reaction" validate:"required,oneof=like love haha wow sad angry"`
+}
+
+// reactCommentHandler godoc
+//
+//	@Summary		React to a comment
+//	@Description	Sets the authenticated user's reaction to a comment, replacing any previous one
+//	@Tags			comment
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path	int					true	"Post ID"
+//	@Param			commentID	path	int					true	"Comment ID"
+//	@Param			reaction	body	ReactionPayload	true	"Reaction"
+//	@Success		204			"Reaction saved"
+//	@Failure		400			{object}	error	"Invalid request payload"
+//	@Failure		404			{object}	error	"Comment not found"
+//	@Failure		500			{object}	error	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postID}/comments/{commentID}/reactions [put]
+func (app *application) reactCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	comment := getCommentFromCtx(r)
+
+	var payload ReactionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	if comment.IsDeleted {
+		app.statusNotFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Comments.React(ctx, comment.ID, user.ID, payload.Reaction); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// unreactCommentHandler godoc
+//
+//	@Summary		Remove a comment reaction
+//	@Description	Removes the authenticated user's reaction to a comment
+//	@Tags			comment
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path	int	true	"Post ID"
+//	@Param			commentID	path	int	true	"Comment ID"
+//	@Success		204			"Reaction removed"
+//	@Failure		404			{object}	error	"Comment not found"
+//	@Failure		500			{object}	error	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postID}/comments/{commentID}/reactions [delete]
+func (app *application) unreactCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	comment := getCommentFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Comments.Unreact(ctx, comment.ID, user.ID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// commentsContextMiddleware loads the comment from the url and makes sure it
+// belongs to the post already loaded by postsContextMiddleware.
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idParam := chi.URLParam(r, "commentID")
+		id, err := strconv.ParseInt(idParam, 10, 64)
+		if err != nil {
+			app.statusBadRequestError(w, r, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		comment, err := app.store.Comments.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.statusNotFoundError(w, r, err)
+			default:
+				app.statusInternalServerError(w, r, err)
+			}
+			return
+		}
+
+		if post := getPostFromCtx(r); post == nil || post.ID != comment.PostID {
+			app.statusNotFoundError(w, r, store.ErrNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromCtx(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value(commentCtx).(*store.Comment)
+	return comment
+}
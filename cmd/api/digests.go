@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/i18n"
+	"github.com/MohammadTaghipour/social/internal/store"
+	"golang.org/x/text/message"
+)
+
+type DigestPreferences struct {
+	Frequency string `json:"frequency" validate:"required,oneof=off daily weekly"`
+}
+
+// getDigestPreferencesHandler godoc
+//
+//	@Summary		Get digest preferences
+//	@Description	Returns how often the activity digest email is sent
+//	@Tags			user
+//	@Produce		json
+//	@Success		200	{object}	DigestPreferences
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/digest [get]
+func (app *application) getDigestPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	frequency, err := app.store.Digests.GetFrequency(ctx, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, DigestPreferences{Frequency: frequency}); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// updateDigestPreferencesHandler godoc
+//
+//	@Summary		Update digest preferences
+//	@Description	Sets how often the activity digest email is sent: off, daily or weekly
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		DigestPreferences	true	"Digest frequency"
+//	@Success		200		{object}	DigestPreferences
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/digest [put]
+func (app *application) updateDigestPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload DigestPreferences
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Digests.SetFrequency(ctx, user.ID, payload.Frequency); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, payload); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+  <meta charset="UTF-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>{{.Title}}</title>
+</head>
+<body>
+  <h1>{{.Title}}</h1>
+  <p>{{.Text}}</p>
+  {{if .Action}}<form method="post" action="{{.Action}}">
+    <button type="submit">{{.Button}}</button>
+  </form>{{end}}
+</body>
+</html>
+`))
+
+type unsubscribePageData struct {
+	Lang   string
+	Title  string
+	Text   string
+	Button string
+	// Action is where the form posts to, empty once unsubscribed
+	Action string
+}
+
+// unsubscribeDigestPageHandler godoc
+//
+//	@Summary		Confirm unsubscribing from digests
+//	@Description	Shows a page asking to confirm the unsubscribe link of a digest email. It changes nothing, so mail scanners opening the link do not unsubscribe anyone
+//	@Tags			user
+//	@Produce		html
+//	@Param			token	query		string	true	"Unsubscribe token from the digest email"
+//	@Success		200		{string}	string	"Confirmation page"
+//	@Failure		400		{object}	error
+//	@Router			/digest/unsubscribe [get]
+func (app *application) unsubscribeDigestPageHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if _, err := app.digest.ParseUnsubscribeToken(token); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	printer, data := unsubscribePageFor(r)
+	data.Text = printer.Sprintf(i18n.MsgDigestUnsubscribeConfirm)
+	data.Button = printer.Sprintf(i18n.MsgDigestUnsubscribeButton)
+	data.Action = "?token=" + url.QueryEscape(token)
+
+	app.writeUnsubscribePage(w, r, data)
+}
+
+// unsubscribeDigestHandler godoc
+//
+//	@Summary		Unsubscribe from digests
+//	@Description	Turns digests off for the user of a signed unsubscribe link, also used by RFC 8058 one-click unsubscribe. Browsers asking for HTML get a page instead of JSON
+//	@Tags			user
+//	@Produce		json
+//	@Param			token	query		string	true	"Unsubscribe token from the digest email"
+//	@Success		200		{object}	DigestPreferences
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/digest/unsubscribe [post]
+func (app *application) unsubscribeDigestHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.digest.ParseUnsubscribeToken(r.URL.Query().Get("token"))
+	if err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Digests.SetFrequency(ctx, userID, store.DigestOff); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the form of the confirmation page, one-click unsubscribes get JSON
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		printer, data := unsubscribePageFor(r)
+		data.Text = printer.Sprintf(i18n.MsgDigestUnsubscribed)
+		app.writeUnsubscribePage(w, r, data)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, DigestPreferences{Frequency: store.DigestOff}); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// unsubscribePageFor returns the printer and the title of the unsubscribe
+// page in the locale of r.
+func unsubscribePageFor(r *http.Request) (*message.Printer, unsubscribePageData) {
+	locale := requestLocale(r)
+	printer := i18n.Printer(locale)
+	return printer, unsubscribePageData{
+		Lang:  locale.String(),
+		Title: printer.Sprintf(i18n.MsgDigestUnsubscribeTitle),
+	}
+}
+
+func (app *application) writeUnsubscribePage(w http.ResponseWriter, r *http.Request, data unsubscribePageData) {
+	buf := new(bytes.Buffer)
+	if err := unsubscribePage.Execute(buf, data); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Language", data.Lang)
+	w.Header().Add("Vary", "Accept-Language")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
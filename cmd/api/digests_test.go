@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/digest"
+	"github.com/MohammadTaghipour/social/internal/store"
+	"go.uber.org/zap"
+)
+
+func TestUnsubscribeDigestOnlyOnPost(t *testing.T) {
+	generator := digest.New(store.Storage{}, digest.Config{Secret: "test"}, zap.NewNop().Sugar())
+	token := generator.UnsubscribeToken(7)
+
+	tests := []struct {
+		name        string
+		method      string
+		token       string
+		accept      string
+		wantStatus  int
+		wantType    string
+		wantBody    string
+		unsubscribe bool
+	}{
+		{
+			name:       "link opened",
+			method:     http.MethodGet,
+			token:      token,
+			wantStatus: http.StatusOK,
+			wantType:   "text/html",
+			wantBody:   `action="?token=` + token + `"`,
+		},
+		{
+			name:       "link with a forged token",
+			method:     http.MethodGet,
+			token:      "7.forged",
+			wantStatus: http.StatusBadRequest,
+			wantType:   "application/json",
+		},
+		{
+			name:        "confirmed on the page",
+			method:      http.MethodPost,
+			token:       token,
+			accept:      "text/html,application/xhtml+xml",
+			wantStatus:  http.StatusOK,
+			wantType:    "text/html",
+			wantBody:    "no longer receive",
+			unsubscribe: true,
+		},
+		{
+			name:        "one-click",
+			method:      http.MethodPost,
+			token:       token,
+			wantStatus:  http.StatusOK,
+			wantType:    "application/json",
+			wantBody:    `"frequency":"off"`,
+			unsubscribe: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digests := &fakeDigests{}
+			app := &application{
+				store:  store.Storage{Digests: digests},
+				digest: generator,
+				logger: zap.NewNop().Sugar(),
+			}
+
+			body := strings.NewReader("List-Unsubscribe=One-Click")
+			r := httptest.NewRequest(tt.method, "/v1/digest/unsubscribe?token="+tt.token, body)
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			if tt.method == http.MethodGet {
+				app.unsubscribeDigestPageHandler(w, r)
+			} else {
+				app.unsubscribeDigestHandler(w, r)
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.wantType) {
+				t.Errorf("Content-Type = %q, want %s", ct, tt.wantType)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body does not contain %q:\n%s", tt.wantBody, w.Body)
+			}
+
+			var want []string
+			if tt.unsubscribe {
+				want = []string{"7:off"}
+			}
+			if strings.Join(digests.set, ",") != strings.Join(want, ",") {
+				t.Errorf("frequencies set %v, want %v", digests.set, want)
+			}
+		})
+	}
+}
+
+// fakeDigests records the frequencies set as "user:frequency".
+type fakeDigests struct {
+	digestsStore
+	set []string
+}
+
+func (f *fakeDigests) SetFrequency(_ context.Context, userID int64, frequency string) error {
+	f.set = append(f.set, strconv.FormatInt(userID, 10)+":"+frequency)
+	return nil
+}
+
+// digestsStore is the method set of store.Storage.Digests, the fake only
+// implements what the handlers use.
+type digestsStore = interface {
+	GetRecipients(ctx context.Context, frequency string, period, inactiveSince time.Time, afterID int64, limit int) ([]store.DigestRecipient, error)
+	GetNewFollowers(ctx context.Context, userID int64, since time.Time, limit int) ([]string, int, error)
+	Record(ctx context.Context, userID int64, frequency string, period time.Time, email *store.OutboxMessage) (bool, error)
+	GetFrequency(ctx context.Context, userID int64) (string, error)
+	SetFrequency(ctx context.Context, userID int64, frequency string) error
+}
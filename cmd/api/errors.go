@@ -1,32 +1,47 @@
 package main
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/i18n"
+	"github.com/go-playground/validator/v10"
 )
 
 func (app *application) statusInternalServerError(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Errorw("Internal error", "method", r.Method, "path", r.URL.Path,
 		"error", err)
-	writeJSONError(w, http.StatusInternalServerError, "Something went wrong in server")
+	writeLocalizedError(w, r, http.StatusInternalServerError, i18n.MsgInternalError)
 }
 
 func (app *application) statusBadRequestError(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warnw("Bad request error", "method", r.Method, "path", r.URL.Path,
 		"error", err)
-	writeJSONError(w, http.StatusBadRequest, err.Error())
+	writeLocalizedErrors(w, r, http.StatusBadRequest, badRequestMessages(err))
 }
 
 func (app *application) statusNotFoundError(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warnw("Not found error", "method", r.Method, "path", r.URL.Path,
 		"error", err)
-	writeJSONError(w, http.StatusNotFound, "Not found")
+	writeLocalizedError(w, r, http.StatusNotFound, i18n.MsgNotFound)
+}
+
+func (app *application) statusConflictError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("Conflict error", "method", r.Method, "path", r.URL.Path,
+		"error", err)
+	writeLocalizedError(w, r, http.StatusConflict, i18n.MsgConflict)
 }
 
 func (app *application) unauthorizedError(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warnw("unauthorized error", "method", r.Method, "path", r.URL.Path,
 		"error", err)
-	writeJSONError(w, http.StatusUnauthorized, "Unauthorized")
+	writeLocalizedError(w, r, http.StatusUnauthorized, i18n.MsgUnauthorized)
 }
 
 func (app *application) unauthorizedBasicError(w http.ResponseWriter, r *http.Request, err error) {
@@ -35,23 +50,117 @@ func (app *application) unauthorizedBasicError(w http.ResponseWriter, r *http.Re
 
 	w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
 
-	writeJSONError(w, http.StatusUnauthorized, "Unauthorized")
+	writeLocalizedError(w, r, http.StatusUnauthorized, i18n.MsgUnauthorized)
 }
 
 func (app *application) unauthorizedJwtError(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warnw("unauthorized token error", "method", r.Method, "path", r.URL.Path,
 		"error", err)
 
-	writeJSONError(w, http.StatusUnauthorized, "Unauthorized")
+	writeLocalizedError(w, r, http.StatusUnauthorized, i18n.MsgUnauthorized)
 }
 
 func (app *application) statusForbiddenError(w http.ResponseWriter, r *http.Request) {
 	app.logger.Warnw("forbidden error", "method", r.Method, "path", r.URL.Path)
-	writeJSONError(w, http.StatusForbidden, "Forbidden")
+	writeLocalizedError(w, r, http.StatusForbidden, i18n.MsgForbidden)
 }
 
-func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter string) {
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
 	app.logger.Warnw("rate limit exeeded", "method", r.Method, "path", r.URL.Path)
-	w.Header().Set("Retry-After", retryAfter)
-	writeJSONError(w, http.StatusTooManyRequests, fmt.Sprintf("Too many requests. wait for %s", retryAfter))
+	seconds := ceilSeconds(retryAfter)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	writeLocalizedError(w, r, http.StatusTooManyRequests, i18n.MsgTooManyRequests, seconds)
+}
+
+// localizedMessage is a message key and its arguments.
+type localizedMessage struct {
+	key  string
+	args []any
+}
+
+// writeLocalizedError writes the message key translated into the locale of
+// the request.
+func writeLocalizedError(w http.ResponseWriter, r *http.Request, status int, key string, args ...any) {
+	writeLocalizedErrors(w, r, status, []localizedMessage{{key: key, args: args}})
+}
+
+// writeLocalizedErrors writes several messages as one error, separated by
+// semicolons.
+func writeLocalizedErrors(w http.ResponseWriter, r *http.Request, status int, msgs []localizedMessage) {
+	locale := requestLocale(r)
+	printer := i18n.Printer(locale)
+
+	translated := make([]string, len(msgs))
+	for i, msg := range msgs {
+		translated[i] = printer.Sprintf(msg.key, msg.args...)
+	}
+
+	w.Header().Set("Content-Language", locale.String())
+	w.Header().Add("Vary", "Accept-Language")
+	writeJSONError(w, status, strings.Join(translated, "; "))
+}
+
+// badRequestMessages maps the errors of decoding and validating a request
+// body to catalog messages. Other errors are described by the handler and
+// keep their text.
+func badRequestMessages(err error) []localizedMessage {
+	var (
+		validationErrs validator.ValidationErrors
+		syntaxErr      *json.SyntaxError
+		typeErr        *json.UnmarshalTypeError
+		maxBytesErr    *http.MaxBytesError
+	)
+
+	switch {
+	case errors.As(err, &validationErrs):
+		msgs := make([]localizedMessage, len(validationErrs))
+		for i, fe := range validationErrs {
+			msgs[i] = fieldMessage(fe)
+		}
+		return msgs
+	case errors.Is(err, io.EOF):
+		return []localizedMessage{{key: i18n.MsgEmptyBody}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return []localizedMessage{{key: i18n.MsgMalformedJSON}}
+	case errors.As(err, &typeErr):
+		return []localizedMessage{{key: i18n.MsgFieldType, args: []any{typeErr.Field}}}
+	case errors.As(err, &maxBytesErr):
+		return []localizedMessage{{key: i18n.MsgBodyTooLarge, args: []any{maxBytesErr.Limit}}}
+	}
+
+	// the decoder reports unknown fields without a type of their own
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return []localizedMessage{{key: i18n.MsgUnknownField, args: []any{field}}}
+	}
+
+	return []localizedMessage{{key: i18n.MsgBadRequest, args: []any{err.Error()}}}
+}
+
+func fieldMessage(fe validator.FieldError) localizedMessage {
+	field := fe.Field()
+	isString := fe.Kind() == reflect.String
+
+	switch fe.Tag() {
+	case "required":
+		return localizedMessage{key: i18n.MsgFieldRequired, args: []any{field}}
+	case "min":
+		if isString {
+			return localizedMessage{key: i18n.MsgFieldMinLength, args: []any{field, fe.Param()}}
+		}
+		return localizedMessage{key: i18n.MsgFieldMin, args: []any{field, fe.Param()}}
+	case "max":
+		if isString {
+			return localizedMessage{key: i18n.MsgFieldMaxLength, args: []any{field, fe.Param()}}
+		}
+		return localizedMessage{key: i18n.MsgFieldMax, args: []any{field, fe.Param()}}
+	case "email":
+		return localizedMessage{key: i18n.MsgFieldEmail, args: []any{field}}
+	case "url", "http_url":
+		return localizedMessage{key: i18n.MsgFieldURL, args: []any{field}}
+	case "oneof":
+		return localizedMessage{key: i18n.MsgFieldOneOf, args: []any{field, strings.Join(strings.Fields(fe.Param()), ", ")}}
+	default:
+		return localizedMessage{key: i18n.MsgFieldInvalid, args: []any{field}}
+	}
 }
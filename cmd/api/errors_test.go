@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBadRequestIsLocalized(t *testing.T) {
+	decode := func(body string) error {
+		var payload RegisterUserPayload
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		return readJSON(httptest.NewRecorder(), r, &payload)
+	}
+	validateBody := func(body string) error {
+		var payload RegisterUserPayload
+		if err := json.Unmarshal([]byte(body), &payload); err != nil {
+			t.Fatal(err)
+		}
+		return validate.Struct(payload)
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		locale string
+		want   string
+	}{
+		{
+			name:   "missing fields",
+			err:    validateBody(`{"username":"gopher"}`),
+			locale: "en",
+			want:   "email is required; password is required",
+		},
+		{
+			name:   "missing fields in German",
+			err:    validateBody(`{"username":"gopher"}`),
+			locale: "de",
+			want:   "email ist erforderlich; password ist erforderlich",
+		},
+		{
+			name:   "too short",
+			err:    validateBody(`{"username":"gopher","email":"gopher@example.com","password":"ab"}`),
+			locale: "de",
+			want:   "password muss mindestens 3 Zeichen lang sein",
+		},
+		{
+			name:   "not an email",
+			err:    validateBody(`{"username":"gopher","email":"gopher","password":"secret"}`),
+			locale: "en",
+			want:   "email must be an email address",
+		},
+		{
+			name:   "malformed json",
+			err:    decode(`{"username":`),
+			locale: "de",
+			want:   "Der Inhalt der Anfrage ist kein gültiges JSON",
+		},
+		{
+			name:   "empty body",
+			err:    decode(``),
+			locale: "en",
+			want:   "Request body must not be empty",
+		},
+		{
+			name:   "wrong type",
+			err:    decode(`{"username":42}`),
+			locale: "en",
+			want:   "username has the wrong type",
+		},
+		{
+			name:   "unknown field",
+			err:    decode(`{"name":"gopher"}`),
+			locale: "de",
+			want:   `Der Inhalt der Anfrage hat ein unbekanntes Feld "name"`,
+		},
+		{
+			name:   "described by the handler",
+			err:    errors.New(`unknown event "post.liked"`),
+			locale: "de",
+			want:   `Ungültige Anfrage: unknown event "post.liked"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Header.Set("Accept-Language", tt.locale)
+			w := httptest.NewRecorder()
+
+			writeLocalizedErrors(w, r, http.StatusBadRequest, badRequestMessages(tt.err))
+
+			var body struct {
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error != tt.want {
+				t.Errorf("error = %q, want %q", body.Error, tt.want)
+			}
+			if got := w.Header().Get("Content-Language"); got != tt.locale {
+				t.Errorf("Content-Language = %q, want %q", got, tt.locale)
+			}
+		})
+	}
+}
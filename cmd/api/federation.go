@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/activitypub"
+	"github.com/MohammadTaghipour/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type apUserKey string
+
+const apUserCtx apUserKey = "apUser"
+
+// webfingerHandler godoc
+//
+//	@Summary		WebFinger discovery
+//	@Description	Resolves an acct:username@domain resource to the user's ActivityPub actor
+//	@Tags			federation
+//	@Produce		json
+//	@Param			resource	query		string	true	"acct:username@domain"
+//	@Success		200			{object}	activitypub.WebFinger
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Router			/.well-known/webfinger [get]
+func (app *application) webfingerHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := app.federation.ParseResource(r.URL.Query().Get("resource"))
+	if !ok {
+		app.statusBadRequestError(w, r, errors.New("resource must be an acct: uri on this server"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := app.store.Users.GetByUsername(ctx, username); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := writeActivityJSON(w, http.StatusOK, activitypub.JRDType, app.federation.WebFinger(username)); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// getActorHandler godoc
+//
+//	@Summary		Get an ActivityPub actor
+//	@Description	Returns the actor document of a user
+//	@Tags			federation
+//	@Produce		json
+//	@Param			username	path		string	true	"Username"
+//	@Success		200			{object}	activitypub.Actor
+//	@Failure		404			{object}	error
+//	@Router			/ap/users/{username} [get]
+func (app *application) getActorHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAPUserFromCtx(r)
+
+	actor, err := app.federation.Actor(r.Context(), user)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := writeActivityJSON(w, http.StatusOK, activitypub.ContentType, actor); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// getOutboxHandler godoc
+//
+//	@Summary		Get an ActivityPub outbox
+//	@Description	Returns the newest posts of a user as Create activities
+//	@Tags			federation
+//	@Produce		json
+//	@Param			username	path		string	true	"Username"
+//	@Success		200			{object}	activitypub.OrderedCollection
+//	@Failure		404			{object}	error
+//	@Router			/ap/users/{username}/outbox [get]
+func (app *application) getOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAPUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	posts, err := app.store.Posts.GetPublicByAuthor(ctx, user.ID, app.config.syndication.itemLimit)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := writeActivityJSON(w, http.StatusOK, activitypub.ContentType, app.federation.Outbox(user, posts)); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// postInboxHandler godoc
+//
+//	@Summary		Post to an ActivityPub inbox
+//	@Description	Accepts Follow, Undo, Create and Like activities signed with an HTTP Signature
+//	@Tags			federation
+//	@Accept			json
+//	@Param			username	path	string	true	"Username"
+//	@Success		202			"Accepted"
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		404			{object}	error
+//	@Router			/ap/users/{username}/inbox [post]
+func (app *application) postInboxHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAPUserFromCtx(r)
+
+	maxBytes := 1048578 // 1MB
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+	if err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := app.federation.HandleInbox(ctx, user, r, body); err != nil {
+		var syntaxErr *json.SyntaxError
+		switch {
+		case errors.Is(err, activitypub.ErrInvalidSignature):
+			app.unauthorizedError(w, r, err)
+		case errors.Is(err, activitypub.ErrUnsupportedActivity), errors.As(err, &syntaxErr):
+			app.statusBadRequestError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// getNoteHandler godoc
+//
+//	@Summary		Get a post as an ActivityPub note
+//	@Description	Returns the Note object of a post
+//	@Tags			federation
+//	@Produce		json
+//	@Param			postID	path		int	true	"Post ID"
+//	@Success		200		{object}	activitypub.Note
+//	@Failure		404		{object}	error
+//	@Router			/ap/posts/{postID} [get]
+func (app *application) getNoteHandler(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+	if err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	post, err := app.store.Posts.GetByID(ctx, postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	author, err := app.getUser(ctx, post.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	note := app.federation.Note(post, author.Username)
+	note.Context = "https://www.w3.org/ns/activitystreams"
+
+	if err := writeActivityJSON(w, http.StatusOK, activitypub.ContentType, note); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// federatePost announces a new post to remote followers. Deliveries are
+// queued, so failing to queue them does not fail the post.
+func (app *application) federatePost(ctx context.Context, user *store.User, post *store.Post) {
+	if app.federation == nil {
+		return
+	}
+
+	if err := app.federation.PostCreated(ctx, user, post); err != nil {
+		app.logger.Warnw("federating post failed", "post", post.ID, "error", err.Error())
+	}
+}
+
+func (app *application) apUserContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		user, err := app.store.Users.GetByUsername(ctx, chi.URLParam(r, "username"))
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.statusNotFoundError(w, r, err)
+			default:
+				app.statusInternalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(r.Context(), apUserCtx, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getAPUserFromCtx(r *http.Request) *store.User {
+	user, _ := r.Context().Value(apUserCtx).(*store.User)
+	return user
+}
+
+// writeActivityJSON writes data unwrapped, as federation peers expect it.
+func writeActivityJSON(w http.ResponseWriter, status int, contentType string, data any) error {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(data)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/MohammadTaghipour/social/internal/store"
@@ -17,57 +19,209 @@ import (
 //	@Accept			json
 //	@Produce		json
 //	@Param			limit	query	int			false	"Max items per page"
-//	@Param			offset	query	int			false	"Pagination offset"
-//	@Param			sort	query	string		false	"Sort order (asc or desc)"
+//	@Param			offset	query	int			false	"Pagination offset (ignored when cursor is set)"
+//	@Param			cursor	query	string		false	"Cursor returned as next_cursor or prev_cursor"
+//	@Param			sort	query	string		false	"Sort order (asc, desc or top)"
 //	@Param			tags	query	[]string	false	"Filter by tags (comma separated)"
-//	@Param			search	query	string		false	"Full-text search in title/content"
-//	@Param			since	query	string		false	"Filter posts created since (RFC3339)"
-//	@Param			until	query	string		false	"Filter posts created until (RFC3339)"
+//	@Param			search	query	string		false	"Full-text search in title/content (same syntax as /search/posts)"
+//	@Param			since	query	string		false	"Filter posts created since (RFC3339 or YYYY-MM-DD)"
+//	@Param			until	query	string		false	"Filter posts created until, inclusive (RFC3339 or YYYY-MM-DD)"
 //	@Success		200		{array}	store.PostWithMetadata
 //	@Failure		400
 //	@Failure		500
 //	@Router			/user/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
-	// default
-	fq := store.PaginatedFeedQuery{
-		Limit:  20,
-		Offset: 0,
-		Sort:   "desc",
-		Tags:   []string{},
-		Search: "",
-		Since:  "",
-		Until:  "",
+	fq, ok := app.parseFeedQuery(w, r)
+	if !ok {
+		return
 	}
 
-	fq, err := fq.Parse(r)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user := getUserFromCtx(r)
+	if user == nil {
+		app.statusInternalServerError(w, r, fmt.Errorf("user not found"))
+		return
+	}
+
+	page, err := app.getUserFeed(ctx, user.ID, fq)
 	if err != nil {
-		app.statusBadRequestError(w, r, err)
+		app.statusInternalServerError(w, r, err)
 		return
+	}
 
+	next, prev := app.writeFeedLinks(w, r, page)
+
+	if err := app.jsonPaginatedResponse(w, http.StatusOK, page.Posts, next, prev); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
 	}
+}
 
-	if err := validate.Struct(fq); err != nil {
-		app.statusBadRequestError(w, r, err)
+// getExploreFeedHandler godoc
+//
+//	@Summary		Get explore feed
+//	@Description	Returns recent posts from every active user (with filters, tags, etc.)
+//	@Tags			feed
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query	int			false	"Max items per page"
+//	@Param			offset	query	int			false	"Pagination offset (ignored when cursor is set)"
+//	@Param			cursor	query	string		false	"Cursor returned as next_cursor or prev_cursor"
+//	@Param			sort	query	string		false	"Sort order (asc, desc or top)"
+//	@Param			tags	query	[]string	false	"Filter by tags (comma separated)"
+//	@Param			search	query	string		false	"Full-text search in title/content (same syntax as /search/posts)"
+//	@Param			since	query	string		false	"Filter posts created since (RFC3339 or YYYY-MM-DD)"
+//	@Param			until	query	string		false	"Filter posts created until, inclusive (RFC3339 or YYYY-MM-DD)"
+//	@Success		200		{array}	store.PostWithMetadata
+//	@Failure		400
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/feed/explore [get]
+func (app *application) getExploreFeedHandler(w http.ResponseWriter, r *http.Request) {
+	fq, ok := app.parseFeedQuery(w, r)
+	if !ok {
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	user := getUserFromCtx(r)
-	if user == nil {
-		app.statusInternalServerError(w, r, fmt.Errorf("user not found"))
+	page, err := app.getExploreFeed(ctx, fq)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
 		return
 	}
 
-	feed, err := app.store.Posts.GetUserFeed(ctx, user.ID, fq)
+	// the page is shared between viewers so blocks are applied afterwards,
+	// which may leave it a little short
+	user := getUserFromCtx(r)
+	blocked, err := app.store.Blocks.GetBlockedIDs(ctx, user.ID)
 	if err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+	posts := slices.DeleteFunc(slices.Clone(page.Posts), func(p store.PostWithMetadata) bool {
+		return slices.Contains(blocked, p.UserID)
+	})
+
+	next, prev := app.writeFeedLinks(w, r, page)
+
+	if err := app.jsonPaginatedResponse(w, http.StatusOK, posts, next, prev); err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
 	}
 }
+
+// getUserFeed serves the newest pages of the feed from the user's Redis
+// timeline, anything it can not answer falls back to Postgres.
+func (app *application) getUserFeed(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) (*store.FeedPage, error) {
+	if app.timeline != nil {
+		page, ok, err := app.timeline.GetFeed(ctx, userID, fq)
+		if err != nil {
+			app.logger.Warnw("reading timeline failed", "user", userID, "error", err.Error())
+		} else if ok {
+			return page, nil
+		}
+	}
+
+	return app.store.Posts.GetUserFeed(ctx, userID, fq)
+}
+
+// getExploreFeed serves the first page of each explore query from the cache,
+// deeper pages always hit the database, and so does every page while the
+// cache is unavailable.
+func (app *application) getExploreFeed(ctx context.Context, fq store.PaginatedFeedQuery) (*store.FeedPage, error) {
+	if !app.config.redis.enabled || fq.Keyset != nil || fq.Offset > 0 {
+		return app.store.Posts.GetExploreFeed(ctx, fq)
+	}
+
+	page, err := app.cache.Feeds.GetExplore(ctx, fq)
+	if err != nil {
+		app.logger.Warnw("reading explore cache failed", "error", err.Error())
+	} else if page != nil {
+		return page, nil
+	}
+
+	page, err = app.store.Posts.GetExploreFeed(ctx, fq)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := app.cache.Feeds.SetExplore(ctx, fq, page); err != nil {
+		app.logger.Warnw("caching explore feed failed", "error", err.Error())
+	}
+
+	return page, nil
+}
+
+// parseFeedQuery reads the filters and pagination shared by the feeds,
+// writing a 400 response when they are malformed.
+func (app *application) parseFeedQuery(w http.ResponseWriter, r *http.Request) (store.PaginatedFeedQuery, bool) {
+	// default
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+		Tags:   []string{},
+		Search: "",
+
+		ScoreDecay: app.config.ranking.Weights.Decay,
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.statusBadRequestError(w, r, err)
+		return fq, false
+	}
+
+	if err := validate.Struct(fq); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return fq, false
+	}
+
+	if fq.Cursor != "" {
+		fq.Keyset, err = store.DecodeFeedCursor(fq.Cursor, app.config.pagination.cursorSecret)
+		if err != nil {
+			app.statusBadRequestError(w, r, err)
+			return fq, false
+		}
+		// a cursor keeps the order of the page it was taken from
+		fq.Sort = fq.Keyset.Sort
+	}
+
+	return fq, true
+}
+
+// writeFeedLinks encodes the neighbour cursors of a feed page and advertises
+// them in the Link header.
+func (app *application) writeFeedLinks(w http.ResponseWriter, r *http.Request, page *store.FeedPage) (next, prev string) {
+	secret := app.config.pagination.cursorSecret
+
+	var links []string
+	if page.Next != nil {
+		next = page.Next.Encode(secret)
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, cursorURL(r, next)))
+	}
+	if page.Prev != nil {
+		prev = page.Prev.Encode(secret)
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, cursorURL(r, prev)))
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	return next, prev
+}
+
+func cursorURL(r *http.Request, cursor string) string {
+	u := *r.URL
+	qs := u.Query()
+	qs.Del("offset")
+	qs.Set("cursor", cursor)
+	u.RawQuery = qs.Encode()
+	return u.RequestURI()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/MohammadTaghipour/social/internal/jobs"
+	"github.com/MohammadTaghipour/social/internal/webhooks"
+)
+
+// enqueue hands a side effect of a request to the job queue, so it is
+// retried and survives restarts. The request already succeeded, so failures
+// are only logged.
+func enqueue[T any](ctx context.Context, app *application, kind jobs.Kind[T], args T) {
+	if _, err := kind.Enqueue(ctx, app.store, args, jobs.Options{}); err != nil {
+		app.logger.Warnw("queueing job failed", "kind", kind.Name, "error", err.Error())
+	}
+}
+
+// triggerWebhooks queues event for the webhooks receiving userID's events.
+func (app *application) triggerWebhooks(ctx context.Context, event string, userID int64, data any) {
+	if app.webhooks == nil {
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		app.logger.Warnw("queueing webhooks failed", "event", event, "error", err.Error())
+		return
+	}
+
+	enqueue(ctx, app, webhooks.TriggerJob, webhooks.TriggerArgs{Event: event, UserID: userID, Data: payload})
+}
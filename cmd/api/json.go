@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"reflect"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -11,6 +13,14 @@ var validate *validator.Validate
 
 func init() {
 	validate = validator.New(validator.WithRequiredStructEnabled())
+	// errors name fields as clients send them
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) error {
@@ -45,3 +55,18 @@ func (app *application) jsonResponse(w http.ResponseWriter, status int, data any
 	}
 	return writeJSON(w, status, &envelop{Data: data, Status: status})
 }
+
+func (app *application) jsonPaginatedResponse(w http.ResponseWriter, status int, data any, nextCursor, prevCursor string) error {
+	type envelop struct {
+		Data       any    `json:"data"`
+		Status     int    `json:"status"`
+		NextCursor string `json:"next_cursor,omitempty"`
+		PrevCursor string `json:"prev_cursor,omitempty"`
+	}
+	return writeJSON(w, status, &envelop{
+		Data:       data,
+		Status:     status,
+		NextCursor: nextCursor,
+		PrevCursor: prevCursor,
+	})
+}
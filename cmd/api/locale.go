@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/text/language"
+
+	"github.com/MohammadTaghipour/social/internal/i18n"
+)
+
+// requestLocale negotiates the locale of a response, the signed in user's
+// preference first and Accept-Language after it.
+func requestLocale(r *http.Request) language.Tag {
+	var preferred string
+	if user := getUserFromCtx(r); user != nil {
+		preferred = user.Locale
+	}
+	return i18n.Match(preferred, r.Header.Get("Accept-Language"))
+}
+
+type UpdateLocalePayload struct {
+	// empty to negotiate the locale per request again
+	Locale string `json:"locale" validate:"max=35"`
+}
+
+// updateUserLocaleHandler godoc
+//
+//	@Summary		Set the preferred locale
+//	@Description	Sets the language of emails and error messages, an empty locale negotiates it from Accept-Language
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateLocalePayload	true	"Locale, e.g. en or de"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/user/locale [put]
+func (app *application) updateUserLocaleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateLocalePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	var locale string
+	if payload.Locale != "" {
+		tag, ok := i18n.Lookup(payload.Locale)
+		if !ok {
+			app.statusBadRequestError(w, r, fmt.Errorf("unsupported locale %q", payload.Locale))
+			return
+		}
+		locale = tag.String()
+	}
+
+	user := getUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Users.SetLocale(ctx, user.ID, locale); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if app.config.redis.enabled {
+		if err := app.cache.Users.Delete(ctx, user.ID); err != nil {
+			app.logger.Warnw("evicting cached user failed", "user", user.ID, "error", err.Error())
+		}
+	}
+
+	updated := *user
+	updated.Locale = locale
+
+	if err := app.jsonResponse(w, http.StatusOK, &updated); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
@@ -2,16 +2,30 @@ package main
 
 import (
 	"expvar"
+	"fmt"
+	"net/http"
+	"os"
 	"runtime"
 	"time"
 
+	"github.com/MohammadTaghipour/social/internal/activitypub"
 	"github.com/MohammadTaghipour/social/internal/auth"
 	"github.com/MohammadTaghipour/social/internal/db"
+	"github.com/MohammadTaghipour/social/internal/digest"
 	"github.com/MohammadTaghipour/social/internal/env"
+	"github.com/MohammadTaghipour/social/internal/jobs"
 	"github.com/MohammadTaghipour/social/internal/mailer"
+	"github.com/MohammadTaghipour/social/internal/notifications"
+	"github.com/MohammadTaghipour/social/internal/outbound"
+	"github.com/MohammadTaghipour/social/internal/outbox"
+	"github.com/MohammadTaghipour/social/internal/ranking"
 	"github.com/MohammadTaghipour/social/internal/ratelimiter"
+	"github.com/MohammadTaghipour/social/internal/scheduler"
 	"github.com/MohammadTaghipour/social/internal/store"
 	"github.com/MohammadTaghipour/social/internal/store/cache"
+	"github.com/MohammadTaghipour/social/internal/stream"
+	"github.com/MohammadTaghipour/social/internal/timeline"
+	"github.com/MohammadTaghipour/social/internal/webhooks"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
@@ -51,9 +65,23 @@ func main() {
 			enabled:  env.GetBool("REDIS_ENABLED", true),
 		},
 		mail: mailConfig{
+			provider: env.GetString("MAIL_PROVIDER", "mailhog"),
 			mailHog: mailHogConfig{
 				addr: env.GetString("MAILHOG_ADDR", "localhost:1025"),
 			},
+			smtp: mailer.SMTPConfig{
+				Addr:     env.GetString("SMTP_ADDR", "localhost:587"),
+				Username: env.GetString("SMTP_USERNAME", ""),
+				Password: env.GetString("SMTP_PASSWORD", ""),
+				TLS:      env.GetString("SMTP_TLS", mailer.TLSStartTLS),
+			},
+			api: mailAPIConfig{
+				url:    env.GetString("MAIL_API_URL", "https://api.sendgrid.com/v3/mail/send"),
+				apiKey: env.GetString("MAIL_API_KEY", ""),
+			},
+			file: mailFileConfig{
+				dir: env.GetString("MAIL_FILE_DIR", "tmp/mail"),
+			},
 			fromEmail: env.GetString("FROM_EMAIL", "gopher@email.com"),
 			exp:       time.Hour * 24 * 3, // 3 days to accept invitations
 		},
@@ -70,16 +98,101 @@ func main() {
 			},
 		},
 		env: env.GetString("ENV", "dev"), ratelimiter: ratelimiter.Config{
-			ReuestsPerTimeFrame: env.GetInt("RATE_LIMITER_REQUESTS_COUNT", 20),
-			TimeFrame:           time.Second * 5,
-			Enabled:             env.GetBool("RATE_LIMITER_ENABLED", true),
+			Policies: map[string]ratelimiter.Rule{
+				ratelimiter.PolicyAuth:  rateLimitRule("AUTH", ratelimiter.SlidingWindow, 10, time.Minute),
+				ratelimiter.PolicyRead:  rateLimitRule("READ", ratelimiter.TokenBucket, 300, time.Minute),
+				ratelimiter.PolicyWrite: rateLimitRule("WRITE", ratelimiter.SlidingWindow, 60, time.Minute),
+			},
+			Enabled: env.GetBool("RATE_LIMITER_ENABLED", true),
+		},
+		comments: commentsConfig{
+			embedLimit: env.GetInt("COMMENTS_EMBED_LIMIT", 20),
+		},
+		pagination: paginationConfig{
+			cursorSecret: env.GetString("PAGINATION_CURSOR_SECRET", "supersecretcursorkey"),
+		},
+		ranking: ranking.Config{
+			Weights: ranking.Weights{
+				Comments:  env.GetFloat("RANKING_WEIGHT_COMMENTS", 2),
+				Reactions: env.GetFloat("RANKING_WEIGHT_REACTIONS", 1),
+				Reposts:   env.GetFloat("RANKING_WEIGHT_REPOSTS", 3),
+				Affinity:  env.GetFloat("RANKING_WEIGHT_AFFINITY", 1),
+				Decay:     env.GetDuration("RANKING_DECAY", time.Hour*12),
+			},
+			RefreshInterval:     env.GetDuration("RANKING_REFRESH_INTERVAL", time.Minute),
+			FullRefreshInterval: env.GetDuration("RANKING_FULL_REFRESH_INTERVAL", time.Hour),
+			AffinityWindow:      time.Hour * 24 * 30,
+			Enabled:             env.GetBool("RANKING_ENABLED", true),
+		},
+		timeline: timeline.Config{
+			MaxLength:          env.GetInt("TIMELINE_MAX_LENGTH", 800),
+			CelebrityThreshold: env.GetInt("TIMELINE_CELEBRITY_THRESHOLD", 10000),
+			Enabled:            env.GetBool("TIMELINE_ENABLED", true),
+		},
+		syndication: syndicationConfig{
+			itemLimit: env.GetInt("SYNDICATION_ITEM_LIMIT", 50),
+		},
+		federation: activitypub.Config{
+			BaseURL:          env.GetString("FEDERATION_BASE_URL", "http://localhost:8080"),
+			DeliveryInterval: env.GetDuration("FEDERATION_DELIVERY_INTERVAL", time.Second*10),
+			MaxAttempts:      env.GetInt("FEDERATION_MAX_ATTEMPTS", 10),
+			// only for federating with servers on the local network
+			AllowPrivate: env.GetBool("FEDERATION_ALLOW_PRIVATE", false),
+			Enabled:      env.GetBool("FEDERATION_ENABLED", false),
+		},
+		stream: stream.Config{
+			Heartbeat:  env.GetDuration("STREAM_HEARTBEAT", time.Second*15),
+			ReplaySize: env.GetInt("STREAM_REPLAY_SIZE", 100),
+			Enabled:    env.GetBool("STREAM_ENABLED", true),
+		},
+		webhooks: webhooks.Config{
+			DeliveryInterval: env.GetDuration("WEBHOOKS_DELIVERY_INTERVAL", time.Second*10),
+			MaxAttempts:      env.GetInt("WEBHOOKS_MAX_ATTEMPTS", 8),
+			DisableAfter:     env.GetInt("WEBHOOKS_DISABLE_AFTER", 20),
+			// only for receivers running next to the api
+			AllowPrivate: env.GetBool("WEBHOOKS_ALLOW_PRIVATE", false),
+			Enabled:      env.GetBool("WEBHOOKS_ENABLED", true),
+		},
+		outbox: outbox.Config{
+			PollInterval: env.GetDuration("OUTBOX_POLL_INTERVAL", time.Second*5),
+			MaxAttempts:  env.GetInt("OUTBOX_MAX_ATTEMPTS", 10),
+			// turn off to leave dispatching to other instances
+			Enabled: env.GetBool("OUTBOX_ENABLED", true),
+		},
+		jobs: jobs.Config{
+			PollInterval: env.GetDuration("JOBS_POLL_INTERVAL", time.Second),
+			Lease:        env.GetDuration("JOBS_LEASE", time.Minute*5),
+			DrainTimeout: env.GetDuration("JOBS_DRAIN_TIMEOUT", time.Second*25),
+			// turn off when jobs run in cmd/worker instead
+			Enabled: env.GetBool("JOBS_ENABLED", true),
+		},
+		scheduler: schedulerConfig{
+			enabled:          env.GetBool("SCHEDULER_ENABLED", true),
+			purgeInvitations: env.GetString("SCHEDULER_PURGE_INVITATIONS", "@hourly"),
+			trendingTags:     env.GetString("SCHEDULER_TRENDING_TAGS", "*/10 * * * *"),
+			purgeJobs:        env.GetString("SCHEDULER_PURGE_JOBS", "@daily"),
+			dailyDigest:      env.GetString("SCHEDULER_DAILY_DIGEST", "0 8 * * *"),
+			weeklyDigest:     env.GetString("SCHEDULER_WEEKLY_DIGEST", "0 8 * * 1"),
+		},
+		digest: digest.Config{
+			Secret:         env.GetString("DIGEST_SECRET", "supersecretdigestkey"),
+			UnsubscribeURL: env.GetString("DIGEST_UNSUBSCRIBE_URL", "http://localhost:8080/v1/digest/unsubscribe"),
+			TopPosts:       env.GetInt("DIGEST_TOP_POSTS", 5),
+			BatchSize:      100,
 		},
 	}
+	cfg.digest.FrontendURL = cfg.frontendURL
+	cfg.digest.ScoreDecay = cfg.ranking.Weights.Decay
 
 	// Logger
 	logger := zap.Must(zap.NewProduction()).Sugar()
 	defer logger.Sync()
 
+	// the single rate limit was replaced by the policies
+	if _, ok := os.LookupEnv("RATE_LIMITER_REQUESTS_COUNT"); ok {
+		logger.Warn("RATE_LIMITER_REQUESTS_COUNT is deprecated and ignored, set RATE_LIMITER_READ_REQUESTS and RATE_LIMITER_WRITE_REQUESTS instead")
+	}
+
 	// Database
 	db, err := db.New(
 		cfg.db.addr,
@@ -95,6 +208,17 @@ func main() {
 	defer db.Close()
 	logger.Info("database connection pool established")
 
+	cfg.jobs.Queues, err = jobs.ParseQueues(env.GetString("JOBS_QUEUES", "default:10,maintenance:1"))
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	// without trusted proxies the address of the peer is the client's
+	cfg.trustedProxies, err = parseTrustedProxies(env.GetString("TRUSTED_PROXIES", ""))
+	if err != nil {
+		logger.Fatal(err)
+	}
+
 	// cache
 	var rdb *redis.Client
 	if cfg.redis.enabled {
@@ -102,16 +226,24 @@ func main() {
 		logger.Info("redis cache connection established")
 	}
 
-	// Rate limiter
-	ratelimiter := ratelimiter.NewFixedWindowRateLimiter(
-		cfg.ratelimiter.ReuestsPerTimeFrame,
-		cfg.ratelimiter.TimeFrame,
-	)
+	// Rate limiter, shared by the replicas through redis when it is enabled
+	ratelimiter, err := ratelimiter.NewPolicies(cfg.ratelimiter.Policies, rdb, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
 	cacheStore := cache.NewStorage(rdb)
 	store := store.NewStorage(db) // TODO: pass a real db connection
 
-	mailer := mailer.NewMailhog(cfg.mail.mailHog.addr, cfg.mail.fromEmail)
+	scorer, err := ranking.NewScorer(store, cfg.ranking, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	mailer, err := newMailer(cfg.mail, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
 	jwtAuthenticator := auth.NewJwtAuthenticator(
 		cfg.auth.jwt.secret,
@@ -127,6 +259,62 @@ func main() {
 		authenticator: jwtAuthenticator,
 		cache:         cacheStore,
 		ratelimiter:   ratelimiter,
+		scorer:        scorer,
+	}
+
+	// emails and other side effects are queued in the outbox
+	app.outbox = outbox.New(store, cfg.outbox, logger)
+	app.outbox.Handle(outbox.TopicEmail, outbox.SendEmail(mailer, cfg.env != "prod"))
+
+	// digests are queued as emails by the scheduler
+	app.digest = digest.New(store, cfg.digest, logger)
+
+	// live events fan out through redis pub/sub
+	var publisher notifications.Publisher
+	if cfg.redis.enabled && cfg.stream.Enabled {
+		app.stream = stream.NewBroker(rdb, cfg.stream, logger)
+		publisher = app.stream
+	}
+	app.notifications = notifications.New(store, publisher)
+
+	// timelines live in redis
+	if cfg.redis.enabled && cfg.timeline.Enabled {
+		app.timeline = timeline.New(rdb, store, cfg.timeline)
+	}
+
+	// Federation
+	if cfg.federation.Enabled {
+		// remote servers pick the urls fetched and posted to
+		client := outbound.NewClient(outbound.Config{
+			Timeout:      10 * time.Second,
+			AllowPrivate: cfg.federation.AllowPrivate,
+		})
+		app.federation, err = activitypub.New(store, client, cfg.federation, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	// Scheduler
+	if cfg.scheduler.enabled {
+		app.scheduler = scheduler.New(store, logger)
+		if err := app.scheduleTasks(); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	// Webhooks
+	if cfg.webhooks.Enabled {
+		app.webhooks = webhooks.New(store, webhooks.NewClient(cfg.webhooks), cfg.webhooks, logger)
+	}
+
+	// Jobs, side effects of requests are queued as jobs
+	if cfg.jobs.Enabled {
+		app.jobs = jobs.NewRunner(store, cfg.jobs, logger)
+		notifications.RegisterJobs(app.jobs, app.notifications)
+		timeline.RegisterJobs(app.jobs, app.timeline)
+		stream.RegisterJobs(app.jobs, app.stream, store)
+		webhooks.RegisterJobs(app.jobs, app.webhooks)
 	}
 
 	// Metrics Collected
@@ -141,3 +329,34 @@ func main() {
 	mux := app.mount()
 	logger.Fatal(app.run(mux))
 }
+
+// rateLimitRule reads the rate limit rule of a policy from the
+// RATE_LIMITER_<name>_* variables.
+func rateLimitRule(name, algorithm string, requests int, window time.Duration) ratelimiter.Rule {
+	prefix := "RATE_LIMITER_" + name + "_"
+	return ratelimiter.Rule{
+		Algorithm: env.GetString(prefix+"ALGORITHM", algorithm),
+		Limit:     env.GetInt(prefix+"REQUESTS", requests),
+		Window:    env.GetDuration(prefix+"WINDOW", window),
+	}
+}
+
+func newMailer(cfg mailConfig, logger *zap.SugaredLogger) (mailer.Client, error) {
+	if err := mailer.LoadTemplates(); err != nil {
+		return nil, err
+	}
+
+	switch cfg.provider {
+	case "mailhog":
+		return mailer.NewMailhog(cfg.mailHog.addr, cfg.fromEmail), nil
+	case "smtp":
+		return mailer.NewSMTP(cfg.smtp, cfg.fromEmail, logger)
+	case "api":
+		client := &http.Client{Timeout: 10 * time.Second}
+		return mailer.NewAPI(cfg.api.url, cfg.api.apiKey, cfg.fromEmail, client), nil
+	case "file":
+		return mailer.NewFile(cfg.file.dir, cfg.fromEmail), nil
+	default:
+		return nil, fmt.Errorf("unknown mail provider %q", cfg.provider)
+	}
+}
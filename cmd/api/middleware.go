@@ -4,10 +4,15 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/MohammadTaghipour/social/internal/ratelimiter"
 	"github.com/MohammadTaghipour/social/internal/store"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -124,6 +129,51 @@ func (app *application) CheckPostOwnership(requiredRole string, next http.Handle
 	}
 }
 
+func (app *application) CheckCommentOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromCtx(r)
+		comment := getCommentFromCtx(r)
+
+		// if it belongs to user
+		if user.ID == comment.UserID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// role check
+		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		if err != nil {
+			app.statusInternalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			app.statusForbiddenError(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// RequireRole lets through users whose role is at least requiredRole.
+func (app *application) RequireRole(requiredRole string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, err := app.checkRolePrecedence(r.Context(), getUserFromCtx(r), requiredRole)
+			if err != nil {
+				app.statusInternalServerError(w, r, err)
+				return
+			}
+			if !allowed {
+				app.statusForbiddenError(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (app *application) checkRolePrecedence(ctx context.Context,
 	user *store.User, requiredRole string) (bool, error) {
 	role, err := app.store.Roles.GetByName(ctx, requiredRole)
@@ -159,15 +209,155 @@ func (app *application) getUser(ctx context.Context, userID int64) (*store.User,
 	return user, err
 }
 
+// RateLimiterMiddleware limits GET requests under the read policy and the
+// others under the write policy. Behind JwtAuthMiddleware it counts per user.
 func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.config.ratelimiter.Enabled {
-			if allow, rettyAfter := app.ratelimiter.Allow(r.RemoteAddr); !allow {
-				app.rateLimitExceededResponse(w, r, rettyAfter.String())
-				return
-			}
+		policy := ratelimiter.PolicyWrite
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			policy = ratelimiter.PolicyRead
 		}
 
-		next.ServeHTTP(w, r)
+		app.rateLimit(w, r, next, policy)
 	})
 }
+
+// RateLimit limits every request of a route group under policy.
+func (app *application) RateLimit(policy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			app.rateLimit(w, r, next, policy)
+		})
+	}
+}
+
+func (app *application) rateLimit(w http.ResponseWriter, r *http.Request, next http.Handler, policy string) {
+	if app.config.ratelimiter.Enabled {
+		res := app.ratelimiter.Allow(policy, rateLimitKey(r))
+		setRateLimitHeaders(w, res)
+		if !res.Allowed {
+			app.rateLimitExceededResponse(w, r, res.RetryAfter)
+			return
+		}
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// setRateLimitHeaders sends the quota in the RateLimit-* headers of the IETF
+// RateLimit header fields draft. Policies without a rule send none.
+func setRateLimitHeaders(w http.ResponseWriter, res ratelimiter.Result) {
+	if res.Limit == 0 {
+		return
+	}
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+}
+
+// ceilSeconds rounds d up to whole seconds, so clients waiting that long are
+// never early.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// rateLimitKey identifies the client of r: the signed in user, or the IP
+// address before signing in.
+func rateLimitKey(r *http.Request) string {
+	if user := getUserFromCtx(r); user != nil {
+		return "user:" + strconv.FormatInt(user.ID, 10)
+	}
+	return "ip:" + clientIP(r)
+}
+
+func clientIP(r *http.Request) string {
+	// realIP leaves the address without a port
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// realIP replaces the remote address with the client address forwarded by a
+// trusted proxy. Forwarding headers of anyone else are ignored, or clients
+// could pick the address they are rate limited by.
+func realIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip, ok := forwardedFor(r, trusted); ok {
+				r.RemoteAddr = ip
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedFor returns the client address of a request sent by a trusted
+// proxy. X-Forwarded-For is read from the right, where the proxies append,
+// up to the first address that is not a proxy: what comes before it was sent
+// by the client.
+func forwardedFor(r *http.Request, trusted []netip.Prefix) (string, bool) {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil || !isTrustedProxy(peer.Addr(), trusted) {
+		return "", false
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return "", false
+		}
+		if i == 0 || !isTrustedProxy(addr, trusted) {
+			return addr.Unmap().String(), true
+		}
+	}
+
+	if addr, err := netip.ParseAddr(r.Header.Get("X-Real-IP")); err == nil {
+		return addr.Unmap().String(), true
+	}
+	return "", false
+}
+
+func isTrustedProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses a comma separated list of addresses and CIDR
+// ranges, such as "10.0.0.0/8,192.168.1.10".
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", field, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", field, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedForTrustsOnlyProxies(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{
+			name:      "direct client can not spoof",
+			peer:      "203.0.113.7:5000",
+			forwarded: "198.51.100.1",
+			realIP:    "198.51.100.2",
+			want:      "203.0.113.7",
+		},
+		{
+			name:      "behind a proxy",
+			peer:      "10.0.0.2:5000",
+			forwarded: "203.0.113.7",
+			want:      "203.0.113.7",
+		},
+		{
+			name:      "client prepended an address",
+			peer:      "10.0.0.2:5000",
+			forwarded: "198.51.100.1, 203.0.113.7",
+			want:      "203.0.113.7",
+		},
+		{
+			name:      "through two proxies",
+			peer:      "10.0.0.2:5000",
+			forwarded: "203.0.113.7, 192.168.1.10",
+			want:      "203.0.113.7",
+		},
+		{
+			name:   "real ip header of a proxy",
+			peer:   "192.168.1.10:5000",
+			realIP: "203.0.113.7",
+			want:   "203.0.113.7",
+		},
+		{
+			name:      "malformed header",
+			peer:      "10.0.0.2:5000",
+			forwarded: "203.0.113.7, not-an-ip",
+			want:      "10.0.0.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/authentication/token", nil)
+			r.RemoteAddr = tt.peer
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if ip, ok := forwardedFor(r, trusted); ok {
+				r.RemoteAddr = ip
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("client ip = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+	if _, err := parseTrustedProxies("10.0.0.0/8,proxy.internal"); err == nil {
+		t.Error("parseTrustedProxies accepted a host name")
+	}
+}
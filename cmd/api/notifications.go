@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type NotificationsPage struct {
+	Notifications []store.NotificationGroup `json:"notifications"`
+	UnreadCount   int                       `json:"unread_count"`
+}
+
+// getNotificationsHandler godoc
+//
+//	@Summary		List notifications
+//	@Description	Returns the authenticated user's notifications grouped by type and post, newest first
+//	@Tags			notifications
+//	@Produce		json
+//	@Param			limit	query		int		false	"Max groups per page"
+//	@Param			offset	query		int		false	"Pagination offset"
+//	@Param			unread	query		bool	false	"Only unread notifications"
+//	@Success		200		{object}	NotificationsPage
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications [get]
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	nq := store.PaginatedNotificationsQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	nq, err := nq.Parse(r)
+	if err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(nq); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	groups, err := app.notifications.List(ctx, user.ID, nq)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	unread, err := app.store.Notifications.CountUnread(ctx, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	page := NotificationsPage{Notifications: groups, UnreadCount: unread}
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// getUnreadNotificationsCountHandler godoc
+//
+//	@Summary		Count unread notifications
+//	@Description	Returns how many notifications the authenticated user has not read
+//	@Tags			notifications
+//	@Produce		json
+//	@Success		200	{object}	int
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/unread-count [get]
+func (app *application) getUnreadNotificationsCountHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	unread, err := app.store.Notifications.CountUnread(ctx, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, unread); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// markNotificationReadHandler godoc
+//
+//	@Summary		Mark a notification as read
+//	@Description	Marks a notification group as read, identified by the id it was listed with
+//	@Tags			notifications
+//	@Param			notificationID	path	int	true	"Notification ID"
+//	@Success		204				"Marked as read"
+//	@Failure		400				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/{notificationID}/read [put]
+func (app *application) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	notificationID, err := strconv.ParseInt(chi.URLParam(r, "notificationID"), 10, 64)
+	if err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Notifications.MarkGroupRead(ctx, user.ID, notificationID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// markAllNotificationsReadHandler godoc
+//
+//	@Summary		Mark all notifications as read
+//	@Description	Marks every notification of the authenticated user as read
+//	@Tags			notifications
+//	@Success		204	"Marked as read"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/read [put]
+func (app *application) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Notifications.MarkAllRead(ctx, user.ID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// getNotificationPreferencesHandler godoc
+//
+//	@Summary		Get notification preferences
+//	@Description	Returns whether each notification type is enabled
+//	@Tags			notifications
+//	@Produce		json
+//	@Success		200	{object}	map[string]bool
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [get]
+func (app *application) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	prefs, err := app.store.Notifications.GetPreferences(ctx, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// updateNotificationPreferencesHandler godoc
+//
+//	@Summary		Update notification preferences
+//	@Description	Enables or disables notification types, types left out are unchanged
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			preferences	body		map[string]bool	true	"Enabled per type (follow, comment, reply, mention, reaction)"
+//	@Success		200			{object}	map[string]bool
+//	@Failure		400			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [put]
+func (app *application) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload map[string]bool
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	for t := range payload {
+		if !slices.Contains(store.NotificationTypes, t) {
+			app.statusBadRequestError(w, r, fmt.Errorf("unknown notification type %q", t))
+			return
+		}
+	}
+
+	user := getUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Notifications.SetPreferences(ctx, user.ID, payload); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	prefs, err := app.store.Notifications.GetPreferences(ctx, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
@@ -8,7 +8,11 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/MohammadTaghipour/social/internal/notifications"
 	"github.com/MohammadTaghipour/social/internal/store"
+	"github.com/MohammadTaghipour/social/internal/stream"
+	"github.com/MohammadTaghipour/social/internal/timeline"
+	"github.com/MohammadTaghipour/social/internal/webhooks"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -68,6 +72,17 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	app.federatePost(ctx, user, &post)
+
+	enqueue(ctx, app, notifications.PostCreatedJob, notifications.PostArgs{Post: post})
+	if app.timeline != nil {
+		enqueue(ctx, app, timeline.PostCreatedJob, timeline.PostArgs{Post: post})
+	}
+	if app.stream != nil {
+		enqueue(ctx, app, stream.PublishPostJob, stream.PostArgs{Post: post})
+	}
+	app.triggerWebhooks(ctx, webhooks.EventPostCreated, user.ID, post)
+
 	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
@@ -77,7 +92,8 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 // getPostHandler godoc
 //
 //	@Summary		Get a post
-//	@Description	Returns a single post with metadata and comments
+//	@Description	Returns a single post with metadata and its first comments
+//	@Description	Use GET /post/{postID}/comments to page through all of them
 //	@Tags			post
 //	@Accept			json
 //	@Produce		json
@@ -92,7 +108,7 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	comments, err := app.store.Comments.GetByPostID(ctx, post.ID)
+	comments, err := app.store.Comments.GetByPostID(ctx, post.ID, app.config.comments.embedLimit)
 	if err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
@@ -141,6 +157,12 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	post := getPostFromCtx(r)
+	if app.timeline != nil {
+		enqueue(ctx, app, timeline.PostDeletedJob, timeline.PostArgs{Post: *post})
+	}
+	app.triggerWebhooks(ctx, webhooks.EventPostDeleted, post.UserID, post)
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.statusInternalServerError(w, r, err)
 		return
@@ -203,6 +225,145 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// reactPostHandler godoc
+//
+//	@Summary		React to a post
+//	@Description	Sets the authenticated user's reaction to a post, replacing any previous one
+//	@Tags			post
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path	int				true	"Post ID"
+//	@Param			reaction	body	ReactionPayload	true	"Reaction"
+//	@Success		204			"Reaction saved"
+//	@Failure		400			{object}	error	"Invalid request payload"
+//	@Failure		404			{object}	error	"Post not found"
+//	@Failure		500			{object}	error	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postID}/reactions [put]
+func (app *application) reactPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
+	var payload ReactionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	inserted, err := app.store.Posts.React(ctx, post.ID, user.ID, payload.Reaction)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	// changing a reaction does not notify again
+	if inserted {
+		enqueue(ctx, app, notifications.PostReactedJob, notifications.ReactionArgs{Post: *post, UserID: user.ID})
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// unreactPostHandler godoc
+//
+//	@Summary		Remove a post reaction
+//	@Description	Removes the authenticated user's reaction to a post
+//	@Tags			post
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path	int	true	"Post ID"
+//	@Success		204		"Reaction removed"
+//	@Failure		404		{object}	error	"Post not found"
+//	@Failure		500		{object}	error	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postID}/reactions [delete]
+func (app *application) unreactPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Posts.Unreact(ctx, post.ID, user.ID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// repostHandler godoc
+//
+//	@Summary		Repost a post
+//	@Description	Reposts a post as the authenticated user
+//	@Tags			post
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path	int	true	"Post ID"
+//	@Success		204		"Post reposted"
+//	@Failure		404		{object}	error	"Post not found"
+//	@Failure		500		{object}	error	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postID}/repost [put]
+func (app *application) repostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Posts.Repost(ctx, post.ID, user.ID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// unrepostHandler godoc
+//
+//	@Summary		Undo a repost
+//	@Description	Removes the authenticated user's repost of a post
+//	@Tags			post
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path	int	true	"Post ID"
+//	@Success		204		"Repost removed"
+//	@Failure		404		{object}	error	"Post not found"
+//	@Failure		500		{object}	error	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/post/{postID}/repost [delete]
+func (app *application) unrepostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	post := getPostFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Posts.Unrepost(ctx, post.ID, user.ID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		idParam := chi.URLParam(r, "postID")
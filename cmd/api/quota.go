@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/MohammadTaghipour/social/internal/ratelimiter"
+)
+
+type Quota struct {
+	Enabled  bool          `json:"enabled"`
+	Policies []PolicyQuota `json:"policies"`
+}
+
+// PolicyQuota is the quota left under a rate limit policy. Reset and Window
+// are in seconds.
+type PolicyQuota struct {
+	Policy    string `json:"policy"`
+	Algorithm string `json:"algorithm"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	Reset     int    `json:"reset"`
+	Window    int    `json:"window"`
+}
+
+// getQuotaHandler godoc
+//
+//	@Summary		Get the rate limit quota
+//	@Description	Returns the requests left under each rate limit policy without counting towards them
+//	@Tags			user
+//	@Produce		json
+//	@Success		200	{object}	Quota
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/me/quota [get]
+func (app *application) getQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	quota := Quota{
+		Enabled:  app.config.ratelimiter.Enabled,
+		Policies: []PolicyQuota{},
+	}
+
+	if quota.Enabled {
+		for policy, rule := range app.ratelimiter.Rules() {
+			// signing in is limited before there is a user to count
+			key := rateLimitKey(r)
+			if policy == ratelimiter.PolicyAuth {
+				key = "ip:" + clientIP(r)
+			}
+
+			res := app.ratelimiter.Peek(policy, key)
+			quota.Policies = append(quota.Policies, PolicyQuota{
+				Policy:    policy,
+				Algorithm: rule.Algorithm,
+				Limit:     res.Limit,
+				Remaining: res.Remaining,
+				Reset:     ceilSeconds(res.Reset),
+				Window:    ceilSeconds(rule.Window),
+			})
+		}
+
+		slices.SortFunc(quota.Policies, func(a, b PolicyQuota) int {
+			return strings.Compare(a.Policy, b.Policy)
+		})
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, quota); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/jobs"
+	"github.com/MohammadTaghipour/social/internal/scheduler"
+	"github.com/MohammadTaghipour/social/internal/store"
+)
+
+type schedulerConfig struct {
+	enabled          bool
+	purgeInvitations string
+	trendingTags     string
+	purgeJobs        string
+	dailyDigest      string
+	weeklyDigest     string
+}
+
+// trendingWindow is how far back posts count towards trending tags.
+const trendingWindow = time.Hour * 24
+
+// scheduleTasks registers the recurring tasks of the API.
+func (app *application) scheduleTasks() error {
+	tasks := []struct {
+		name     string
+		schedule string
+		run      func(ctx context.Context) error
+	}{
+		{"purge_invitations", app.config.scheduler.purgeInvitations, app.purgeInvitationsTask},
+		{"trending_tags", app.config.scheduler.trendingTags, app.trendingTagsTask},
+		{"purge_jobs", app.config.scheduler.purgeJobs, app.purgeJobsTask},
+		{"daily_digest", app.config.scheduler.dailyDigest, app.digestTask(store.DigestDaily)},
+		{"weekly_digest", app.config.scheduler.weeklyDigest, app.digestTask(store.DigestWeekly)},
+	}
+
+	for _, t := range tasks {
+		if err := app.scheduler.Add(scheduler.Task{Name: t.name, Schedule: t.schedule, Run: t.run}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (app *application) purgeInvitationsTask(ctx context.Context) error {
+	count, err := app.store.Users.DeleteExpiredInvitations(ctx)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Infow("purged expired invitations", "count", count)
+	return nil
+}
+
+func (app *application) trendingTagsTask(ctx context.Context) error {
+	return app.store.Tags.RecomputeTrending(ctx, time.Now().Add(-trendingWindow), 50)
+}
+
+// purgeJobsTask queues the purge, so it runs wherever the maintenance queue
+// is worked on.
+func (app *application) purgeJobsTask(ctx context.Context) error {
+	_, err := jobs.PurgeJobs.Enqueue(ctx, app.store, jobs.PurgeJobsArgs{
+		OlderThan: time.Hour * 24 * 7,
+	}, jobs.Options{UniqueKey: "purge_jobs"})
+	return err
+}
+
+// digestTask queues the digests at frequency, the outbox sends them.
+func (app *application) digestTask(frequency string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		count, err := app.digest.Send(ctx, frequency, time.Now())
+		if err != nil {
+			return err
+		}
+
+		app.logger.Infow("queued digests", "frequency", frequency, "count", count)
+		return nil
+	}
+}
+
+// getSchedulerStatusHandler godoc
+//
+//	@Summary		Scheduled tasks status
+//	@Description	Returns every scheduled task with its schedule, next run and last run on any instance, including its last error
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		scheduler.TaskStatus
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/scheduler [get]
+func (app *application) getSchedulerStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if app.scheduler == nil {
+		app.statusNotFoundError(w, r, errors.New("scheduler is disabled"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	statuses, err := app.scheduler.Status(ctx)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, statuses); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
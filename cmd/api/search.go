@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+)
+
+// searchPostsHandler godoc
+//
+//	@Summary		Search posts
+//	@Description	Full-text search over posts ranked by relevance, with highlighted snippets.
+//	@Description	Supports "exact phrases", prefix* matches and -excluded terms
+//	@Tags			search
+//	@Accept			json
+//	@Produce		json
+//	@Param			q		query	string	true	"Search query"
+//	@Param			limit	query	int		false	"Max items per page"
+//	@Param			offset	query	int		false	"Pagination offset"
+//	@Success		200		{array}	store.PostSearchResult
+//	@Failure		400		{object}	error	"Bad Request"
+//	@Failure		500		{object}	error	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/search/posts [get]
+func (app *application) searchPostsHandler(w http.ResponseWriter, r *http.Request) {
+	sq := store.PaginatedSearchQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	sq, err := sq.Parse(r)
+	if err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(sq); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	results, err := app.store.Posts.Search(ctx, user.ID, sq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrEmptySearch):
+			app.statusBadRequestError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
+
+// searchUsersHandler godoc
+//
+//	@Summary		Search users
+//	@Description	Finds active users by username prefix or fuzzy match
+//	@Tags			search
+//	@Accept			json
+//	@Produce		json
+//	@Param			q		query	string	true	"Username to look for"
+//	@Param			limit	query	int		false	"Max items per page"
+//	@Param			offset	query	int		false	"Pagination offset"
+//	@Success		200		{array}	store.UserCard
+//	@Failure		400		{object}	error	"Bad Request"
+//	@Failure		500		{object}	error	"Internal Server Error"
+//	@Security		ApiKeyAuth
+//	@Router			/search/users [get]
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	sq := store.PaginatedSearchQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	sq, err := sq.Parse(r)
+	if err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(sq); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	users, err := app.store.Users.Search(ctx, user.ID, sq)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+}
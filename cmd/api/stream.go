@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/stream"
+)
+
+// streamHandler godoc
+//
+//	@Summary		Stream live events
+//	@Description	Server-Sent Events stream of new feed posts and notifications for the authenticated user
+//	@Description	Pass post to also receive the comments of that post. Reconnecting clients send
+//	@Description	Last-Event-ID to receive the events they missed. EventSource clients that can not set
+//	@Description	headers may pass the JWT as access_token
+//	@Tags			stream
+//	@Produce		text/event-stream
+//	@Param			post			query	int		false	"Also stream the comments of this post"
+//	@Param			access_token	query	string	false	"JWT, when the Authorization header can not be set"
+//	@Param			Last-Event-ID	header	string	false	"Id of the last event received"
+//	@Success		200				"Event stream"
+//	@Failure		400				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/stream [get]
+func (app *application) streamHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	topics := []string{stream.UserTopic(user.ID)}
+	if param := r.URL.Query().Get("post"); param != "" {
+		postID, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			app.statusBadRequestError(w, r, err)
+			return
+		}
+		topics = append(topics, stream.PostTopic(postID))
+	}
+
+	// the stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	// subscribe before replaying so nothing published in between is lost
+	sub := app.stream.Subscribe(topics...)
+	defer sub.Close()
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+
+	var missed []stream.Event
+	if lastEventID != "" {
+		var err error
+		missed, err = app.stream.Replay(r.Context(), topics, lastEventID)
+		if err != nil {
+			app.statusInternalServerError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds()); err != nil {
+		return
+	}
+
+	for _, event := range missed {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+		lastEventID = event.ID
+	}
+
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(app.stream.Heartbeat())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// shutting down, or the client fell behind
+				return
+			}
+			if lastEventID != "" && !stream.After(event.ID, lastEventID) {
+				// already replayed
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			lastEventID = event.ID
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// streamRetry is how long clients wait before reconnecting.
+const streamRetry = 3 * time.Second
+
+func writeEvent(w http.ResponseWriter, event stream.Event) error {
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
+
+// streamPath is where event streams are served.
+const streamPath = "/v1/stream"
+
+func isStreamRequest(r *http.Request) bool {
+	return strings.TrimSuffix(r.URL.Path, "/") == streamPath
+}
+
+// streamTokenMiddleware lets EventSource clients, which can not set headers,
+// authenticate with an access_token query parameter. The token is moved to
+// the Authorization header and removed from the url before the request is
+// logged.
+func streamTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if !isStreamRequest(r) || !query.Has("access_token") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if token := query.Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		query.Del("access_token")
+		r.URL.RawQuery = query.Encode()
+		r.RequestURI = r.URL.RequestURI()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unlessStreaming applies mw to every request except those to the event
+// stream, which is meant to stay open.
+func unlessStreaming(mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isStreamRequest(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			wrapped.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+	"github.com/MohammadTaghipour/social/internal/store/cache"
+	"github.com/MohammadTaghipour/social/internal/syndication"
+	"github.com/go-chi/chi/v5"
+)
+
+type syndicationFormat struct {
+	contentType string
+	render      func(syndication.Feed) ([]byte, error)
+}
+
+var (
+	rssFormat = syndicationFormat{
+		contentType: "application/rss+xml; charset=utf-8",
+		render:      syndication.Feed.RSS,
+	}
+	atomFormat = syndicationFormat{
+		contentType: "application/atom+xml; charset=utf-8",
+		render:      syndication.Feed.Atom,
+	}
+)
+
+// getUserPostsRSSHandler godoc
+//
+//	@Summary		Get a user's posts as RSS
+//	@Description	Returns the newest posts of a user as an RSS 2.0 feed
+//	@Tags			syndication
+//	@Produce		xml
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		200
+//	@Success		304		"Not Modified"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/user/{userID}/posts.rss [get]
+func (app *application) getUserPostsRSSHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveUserPostsFeed(w, r, rssFormat)
+}
+
+// getUserPostsAtomHandler godoc
+//
+//	@Summary		Get a user's posts as Atom
+//	@Description	Returns the newest posts of a user as an Atom 1.0 feed
+//	@Tags			syndication
+//	@Produce		xml
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		200
+//	@Success		304		"Not Modified"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/user/{userID}/posts.atom [get]
+func (app *application) getUserPostsAtomHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveUserPostsFeed(w, r, atomFormat)
+}
+
+// getTagPostsRSSHandler godoc
+//
+//	@Summary		Get the posts of a tag as RSS
+//	@Description	Returns the newest posts carrying a tag as an RSS 2.0 feed
+//	@Tags			syndication
+//	@Produce		xml
+//	@Param			tag	path	string	true	"Tag"
+//	@Success		200
+//	@Success		304	"Not Modified"
+//	@Failure		500	{object}	error
+//	@Router			/tag/{tag}/posts.rss [get]
+func (app *application) getTagPostsRSSHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveTagPostsFeed(w, r, rssFormat)
+}
+
+// getTagPostsAtomHandler godoc
+//
+//	@Summary		Get the posts of a tag as Atom
+//	@Description	Returns the newest posts carrying a tag as an Atom 1.0 feed
+//	@Tags			syndication
+//	@Produce		xml
+//	@Param			tag	path	string	true	"Tag"
+//	@Success		200
+//	@Success		304	"Not Modified"
+//	@Failure		500	{object}	error
+//	@Router			/tag/{tag}/posts.atom [get]
+func (app *application) getTagPostsAtomHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveTagPostsFeed(w, r, atomFormat)
+}
+
+func (app *application) serveUserPostsFeed(w http.ResponseWriter, r *http.Request, format syndicationFormat) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	app.serveSyndicationFeed(w, r, format, func(ctx context.Context) (syndication.Feed, error) {
+		user, err := app.getUser(ctx, userID)
+		if err != nil {
+			return syndication.Feed{}, err
+		}
+
+		posts, err := app.store.Posts.GetPublicByAuthor(ctx, userID, app.config.syndication.itemLimit)
+		if err != nil {
+			return syndication.Feed{}, err
+		}
+
+		return app.syndicationFeed(r,
+			fmt.Sprintf("Posts by %s", user.Username),
+			fmt.Sprintf("%s/user/%d", app.config.frontendURL, user.ID),
+			posts,
+		)
+	})
+}
+
+func (app *application) serveTagPostsFeed(w http.ResponseWriter, r *http.Request, format syndicationFormat) {
+	tag := chi.URLParam(r, "tag")
+
+	app.serveSyndicationFeed(w, r, format, func(ctx context.Context) (syndication.Feed, error) {
+		posts, err := app.store.Posts.GetPublicByTag(ctx, tag, app.config.syndication.itemLimit)
+		if err != nil {
+			return syndication.Feed{}, err
+		}
+
+		return app.syndicationFeed(r,
+			fmt.Sprintf("Posts tagged %s", tag),
+			fmt.Sprintf("%s/tag/%s", app.config.frontendURL, url.PathEscape(tag)),
+			posts,
+		)
+	})
+}
+
+// serveSyndicationFeed renders the feed returned by load, caching the output
+// and answering conditional requests with 304 Not Modified.
+func (app *application) serveSyndicationFeed(
+	w http.ResponseWriter,
+	r *http.Request,
+	format syndicationFormat,
+	load func(ctx context.Context) (syndication.Feed, error),
+) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rendered, err := app.getSyndicationFeed(ctx, r.URL.Path, format, load)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("ETag", rendered.ETag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cache.SyndicationExpTime.Seconds())))
+
+	// handles If-None-Match and If-Modified-Since
+	http.ServeContent(w, r, "", rendered.LastModified, bytes.NewReader(rendered.Body))
+}
+
+func (app *application) getSyndicationFeed(
+	ctx context.Context,
+	key string,
+	format syndicationFormat,
+	load func(ctx context.Context) (syndication.Feed, error),
+) (*cache.SyndicationFeed, error) {
+	if app.config.redis.enabled {
+		rendered, err := app.cache.Syndication.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if rendered != nil {
+			return rendered, nil
+		}
+	}
+
+	feed, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := format.render(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(body)
+	rendered := &cache.SyndicationFeed{
+		Body:         body,
+		ETag:         `"` + hex.EncodeToString(hash[:16]) + `"`,
+		LastModified: feed.Updated,
+	}
+
+	if app.config.redis.enabled {
+		if err := app.cache.Syndication.Set(ctx, key, rendered); err != nil {
+			return nil, err
+		}
+	}
+
+	return rendered, nil
+}
+
+// syndicationFeed builds a feed of posts linking to the frontend. The feed is
+// as recent as its most recently updated post.
+func (app *application) syndicationFeed(r *http.Request, title, link string, posts []store.Post) (syndication.Feed, error) {
+	feed := syndication.Feed{
+		Title:       title,
+		Description: title + " on GopherSocial",
+		Link:        link,
+		Self:        app.externalURL(r.URL.Path),
+	}
+
+	for _, p := range posts {
+		published, err := time.Parse(time.RFC3339Nano, p.CreatedAt)
+		if err != nil {
+			return feed, err
+		}
+		updated, err := time.Parse(time.RFC3339Nano, p.UpdatedAt)
+		if err != nil {
+			return feed, err
+		}
+
+		if updated.After(feed.Updated) {
+			feed.Updated = updated
+		}
+
+		feed.Items = append(feed.Items, syndication.Item{
+			Title:      p.Title,
+			Link:       fmt.Sprintf("%s/post/%d", app.config.frontendURL, p.ID),
+			Content:    p.Content,
+			Author:     p.User.Username,
+			Categories: p.Tags,
+			Published:  published,
+			Updated:    updated,
+		})
+	}
+
+	return feed, nil
+}
+
+// externalURL is the absolute url of path on the api. It is built from
+// EXTERNAL_URL rather than the Host and X-Forwarded-Proto headers, which the
+// client picks. EXTERNAL_URL may leave out the scheme, http is assumed then.
+func (app *application) externalURL(path string) string {
+	base := app.config.apiURL
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
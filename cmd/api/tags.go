@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// getTrendingTagsHandler godoc
+//
+//	@Summary		Trending tags
+//	@Description	Returns the tags used by the most authors over the last day, recomputed periodically
+//	@Tags			feed
+//	@Produce		json
+//	@Success		200	{array}		store.TrendingTag
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tags/trending [get]
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tags, err := app.store.Tags.GetTrending(ctx, 20)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
@@ -7,7 +7,10 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/MohammadTaghipour/social/internal/notifications"
 	"github.com/MohammadTaghipour/social/internal/store"
+	"github.com/MohammadTaghipour/social/internal/timeline"
+	"github.com/MohammadTaghipour/social/internal/webhooks"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -77,7 +80,8 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	ctx, cancel := context.WithTimeout(r.Context(), time.Second*10)
 	defer cancel()
 
-	if err := app.store.Users.Activate(ctx, token); err != nil {
+	user, err := app.store.Users.Activate(ctx, token)
+	if err != nil {
 		switch err {
 		case store.ErrNotFound:
 			app.statusBadRequestError(w, r, err)
@@ -87,6 +91,8 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	app.triggerWebhooks(ctx, webhooks.EventUserActivated, user.ID, user)
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.statusInternalServerError(w, r, err)
 	}
@@ -118,7 +124,12 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 
 	if err := app.store.Followers.Follow(ctx, followerUser.ID, followedID); err != nil {
 		app.statusInternalServerError(w, r, err)
+		return
+	}
 
+	enqueue(ctx, app, notifications.FollowedJob, notifications.FollowArgs{UserID: followerUser.ID, FollowedID: followedID})
+	if app.timeline != nil {
+		enqueue(ctx, app, timeline.FollowedJob, timeline.FollowArgs{UserID: followerUser.ID, FollowedID: followedID})
 	}
 
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
@@ -151,7 +162,88 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 
 	if err := app.store.Followers.UnFollow(ctx, followerUser.ID, followedID); err != nil {
 		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if app.timeline != nil {
+		enqueue(ctx, app, timeline.UnfollowedJob, timeline.FollowArgs{UserID: followerUser.ID, FollowedID: followedID})
+	}
 
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// BlockUser godoc
+//
+//	@Summary		Blocks a user
+//	@Description	Blocks a user by ID and removes any follow between both users
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204		"User blocked"
+//	@Failure		400		{object}	error	"Invalid user"
+//	@Security		ApiKeyAuth
+//	@Router			/user/{userID}/block [put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	blockedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	if blockedID == user.ID {
+		app.statusBadRequestError(w, r, errors.New("you can not block yourself"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+
+	if err := app.store.Blocks.Block(ctx, user.ID, blockedID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	// blocking drops the follows both ways
+	if app.timeline != nil {
+		enqueue(ctx, app, timeline.UnfollowedJob, timeline.FollowArgs{UserID: user.ID, FollowedID: blockedID})
+		enqueue(ctx, app, timeline.UnfollowedJob, timeline.FollowArgs{UserID: blockedID, FollowedID: user.ID})
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// UnblockUser godoc
+//
+//	@Summary		Unblocks a user
+//	@Description	Unblocks a user by ID
+//	@Tags			user
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204		"User unblocked"
+//	@Failure		400		{object}	error	"Invalid user"
+//	@Security		ApiKeyAuth
+//	@Router			/user/{userID}/unblock [put]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	blockedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+
+	if err := app.store.Blocks.Unblock(ctx, user.ID, blockedID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
 	}
 
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+	"github.com/MohammadTaghipour/social/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+)
+
+type webhookKey string
+
+const webhookCtx webhookKey = "webhook"
+
+type CreateWebhookPayload struct {
+	URL    string   `json:"url" validate:"required,http_url,max=2048"`
+	Events []string `json:"events" validate:"required,min=1,dive,required"`
+	// Global webhooks receive every user's events and need the admin role
+	Global bool `json:"global"`
+}
+
+// createWebhookHandler godoc
+//
+//	@Summary		Register a webhook
+//	@Description	Registers a URL that events are posted to, signed with the returned secret
+//	@Description	Events: post.created, post.deleted, comment.created, user.activated
+//	@Description	Each request carries X-Webhook-Timestamp and X-Webhook-Signature, the hex
+//	@Description	HMAC-SHA256 of "<timestamp>.<body>" prefixed with "sha256="
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateWebhookPayload	true	"Webhook"
+//	@Success		201		{object}	store.Webhook
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks [post]
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	for _, event := range payload.Events {
+		if !webhooks.ValidEvent(event) {
+			app.statusBadRequestError(w, r, fmt.Errorf("unknown event %q", event))
+			return
+		}
+	}
+
+	// https only outside dev, and never to the network of the api
+	if err := app.webhooks.CheckURL(payload.URL); err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if payload.Global {
+		allowed, err := app.checkRolePrecedence(ctx, user, "admin")
+		if err != nil {
+			app.statusInternalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			app.statusForbiddenError(w, r)
+			return
+		}
+	}
+
+	webhook := &store.Webhook{
+		UserID: user.ID,
+		URL:    payload.URL,
+		Secret: webhooks.NewSecret(),
+		Events: payload.Events,
+		Global: payload.Global,
+	}
+
+	if err := app.store.Webhooks.Create(ctx, webhook); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	// the secret is only shown once
+	if err := app.jsonResponse(w, http.StatusCreated, webhook); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// getWebhooksHandler godoc
+//
+//	@Summary		List webhooks
+//	@Description	Returns the webhooks registered by the authenticated user
+//	@Tags			webhooks
+//	@Produce		json
+//	@Success		200	{array}		store.Webhook
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks [get]
+func (app *application) getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	hooks, err := app.store.Webhooks.GetByUserID(ctx, user.ID)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, hooks); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// getWebhookHandler godoc
+//
+//	@Summary		Get a webhook
+//	@Description	Returns a webhook, including whether it was disabled after repeated failures
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			webhookID	path		int	true	"Webhook ID"
+//	@Success		200			{object}	store.Webhook
+//	@Failure		404			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID} [get]
+func (app *application) getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook := getWebhookFromCtx(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, webhook); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// deleteWebhookHandler godoc
+//
+//	@Summary		Delete a webhook
+//	@Description	Deletes a webhook together with its delivery log
+//	@Tags			webhooks
+//	@Param			webhookID	path	int	true	"Webhook ID"
+//	@Success		204			"Webhook deleted"
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID} [delete]
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook := getWebhookFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Webhooks.Delete(ctx, webhook.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// enableWebhookHandler godoc
+//
+//	@Summary		Re-enable a webhook
+//	@Description	Re-enables a webhook that was disabled after repeated failures
+//	@Tags			webhooks
+//	@Param			webhookID	path	int	true	"Webhook ID"
+//	@Success		204			"Webhook enabled"
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID}/enable [put]
+func (app *application) enableWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook := getWebhookFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := app.store.Webhooks.Enable(ctx, webhook.ID); err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// getWebhookDeliveriesHandler godoc
+//
+//	@Summary		List webhook deliveries
+//	@Description	Returns the newest deliveries of a webhook with their attempts and last response
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			webhookID	path		int	true	"Webhook ID"
+//	@Success		200			{array}		store.WebhookDelivery
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID}/deliveries [get]
+func (app *application) getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	webhook := getWebhookFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deliveries, err := app.store.Webhooks.GetDeliveries(ctx, webhook.ID, 50)
+	if err != nil {
+		app.statusInternalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, deliveries); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// redeliverWebhookHandler godoc
+//
+//	@Summary		Redeliver a webhook event
+//	@Description	Queues a past delivery to be sent again as a new delivery
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			webhookID	path		int	true	"Webhook ID"
+//	@Param			deliveryID	path		int	true	"Delivery ID"
+//	@Success		202			{object}	store.WebhookDelivery
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver [post]
+func (app *application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	deliveryID, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+	if err != nil {
+		app.statusBadRequestError(w, r, err)
+		return
+	}
+
+	webhook := getWebhookFromCtx(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	delivery, err := app.store.Webhooks.Redeliver(ctx, webhook.ID, deliveryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.statusNotFoundError(w, r, err)
+		default:
+			app.statusInternalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, delivery); err != nil {
+		app.statusInternalServerError(w, r, err)
+	}
+}
+
+// webhooksContextMiddleware loads the webhook of the route, which only its
+// owner or an admin can manage.
+func (app *application) webhooksContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+		if err != nil {
+			app.statusBadRequestError(w, r, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		webhook, err := app.store.Webhooks.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.statusNotFoundError(w, r, err)
+			default:
+				app.statusInternalServerError(w, r, err)
+			}
+			return
+		}
+
+		user := getUserFromCtx(r)
+		if webhook.UserID != user.ID {
+			allowed, err := app.checkRolePrecedence(ctx, user, "admin")
+			if err != nil {
+				app.statusInternalServerError(w, r, err)
+				return
+			}
+			if !allowed {
+				// do not reveal other users' webhooks
+				app.statusNotFoundError(w, r, store.ErrNotFound)
+				return
+			}
+		}
+
+		ctx = context.WithValue(r.Context(), webhookCtx, webhook)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getWebhookFromCtx(r *http.Request) *store.Webhook {
+	webhook, _ := r.Context().Value(webhookCtx).(*store.Webhook)
+	return webhook
+}
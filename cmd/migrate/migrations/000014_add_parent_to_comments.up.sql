@@ -0,0 +1,10 @@
+ALTER TABLE comments
+ADD COLUMN parent_id BIGINT REFERENCES comments(id) ON DELETE CASCADE;
+
+ALTER TABLE comments
+ADD COLUMN depth INT NOT NULL DEFAULT 0;
+
+ALTER TABLE comments
+ADD COLUMN deleted_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id);
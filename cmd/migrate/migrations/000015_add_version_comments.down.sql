@@ -0,0 +1,5 @@
+ALTER TABLE comments
+DROP COLUMN updated_at;
+
+ALTER TABLE comments
+DROP COLUMN version;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comments_post_id_created_at;
+
+DROP TABLE IF EXISTS comment_reactions;
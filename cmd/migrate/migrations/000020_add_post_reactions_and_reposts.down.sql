@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_comments_created_at;
+
+DROP TABLE IF EXISTS reposts;
+DROP TABLE IF EXISTS post_reactions;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_affinities;
+DROP TABLE IF EXISTS post_scores;
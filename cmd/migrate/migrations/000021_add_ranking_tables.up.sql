@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS post_scores (
+    post_id BIGINT PRIMARY KEY REFERENCES posts (id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS user_affinities (
+    user_id BIGINT NOT NULL,
+    author_id BIGINT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (user_id, author_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_scores_score ON post_scores (score);
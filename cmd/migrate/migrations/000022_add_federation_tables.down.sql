@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS federation_deliveries;
+DROP TABLE IF EXISTS inbox_activities;
+DROP TABLE IF EXISTS remote_followers;
+DROP TABLE IF EXISTS user_keys;
@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS user_keys (
+    user_id BIGINT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    public_key TEXT NOT NULL,
+    private_key TEXT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS remote_followers (
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    actor_id TEXT NOT NULL,
+    inbox TEXT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (user_id, actor_id)
+);
+
+-- activities received in inboxes, the id makes redelivered activities a no-op
+CREATE TABLE IF NOT EXISTS inbox_activities (
+    id TEXT PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    actor_id TEXT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    object TEXT NOT NULL DEFAULT '',
+    payload JSONB NOT NULL,
+    received_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS federation_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    inbox TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMP(0) WITH TIME ZONE,
+    failed_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_inbox_activities_user_id ON inbox_activities (user_id);
+CREATE INDEX IF NOT EXISTS idx_federation_deliveries_pending ON federation_deliveries (next_attempt_at)
+    WHERE delivered_at IS NULL AND failed_at IS NULL;
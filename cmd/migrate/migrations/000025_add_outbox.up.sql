@@ -0,0 +1,19 @@
+-- messages written in the same transaction as the change they announce and
+-- delivered by a background dispatcher
+CREATE TABLE IF NOT EXISTS outbox_messages (
+    id BIGSERIAL PRIMARY KEY,
+    topic VARCHAR(100) NOT NULL,
+    -- idempotency key, enqueueing the same key twice is a no-op
+    key TEXT NOT NULL UNIQUE,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+    processed_at TIMESTAMP(0) WITH TIME ZONE,
+    -- dead letters ran out of attempts and need a human
+    dead_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_pending ON outbox_messages (next_attempt_at)
+    WHERE processed_at IS NULL AND dead_at IS NULL;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGSERIAL PRIMARY KEY,
+    queue VARCHAR(100) NOT NULL,
+    kind VARCHAR(100) NOT NULL,
+    args JSONB NOT NULL,
+    -- at most one pending or running job per key
+    unique_key TEXT,
+    -- pending, running, completed or failed
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    run_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+    -- a running job whose lease expired is picked up again
+    locked_until TIMESTAMP(0) WITH TIME ZONE,
+    finished_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_unique_key ON jobs (unique_key)
+    WHERE unique_key IS NOT NULL AND status IN ('pending', 'running');
+CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs (queue, run_at)
+    WHERE status IN ('pending', 'running');
+CREATE INDEX IF NOT EXISTS idx_jobs_finished_at ON jobs (finished_at)
+    WHERE finished_at IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_user_invitations_expiry;
+DROP TABLE IF EXISTS trending_tags;
+DROP TABLE IF EXISTS scheduled_tasks;
@@ -0,0 +1,18 @@
+-- the last run of every scheduled task, shared by all API instances
+CREATE TABLE IF NOT EXISTS scheduled_tasks (
+    name VARCHAR(100) PRIMARY KEY,
+    scheduled_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    started_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP(0) WITH TIME ZONE,
+    last_error TEXT NOT NULL DEFAULT '',
+    last_success_at TIMESTAMP(0) WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS trending_tags (
+    tag VARCHAR(100) PRIMARY KEY,
+    post_count INT NOT NULL,
+    author_count INT NOT NULL,
+    computed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_invitations_expiry ON user_invitations (expiry);
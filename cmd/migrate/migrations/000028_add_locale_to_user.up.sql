@@ -0,0 +1,3 @@
+-- empty means the locale is negotiated from Accept-Language
+ALTER TABLE users
+ADD COLUMN locale VARCHAR(35) NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS digest_sends;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS last_login_at;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS digest_frequency;
@@ -0,0 +1,18 @@
+-- digests are opt in, existing and new users start without them
+ALTER TABLE users
+ADD COLUMN digest_frequency VARCHAR(10) NOT NULL DEFAULT 'off'
+    CHECK (digest_frequency IN ('off', 'daily', 'weekly'));
+
+-- digests only go to users who did not sign in during the digest period
+ALTER TABLE users
+ADD COLUMN last_login_at TIMESTAMP(0) WITH TIME ZONE;
+
+-- one row per digest sent, so a period is never sent twice
+CREATE TABLE IF NOT EXISTS digest_sends (
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    frequency VARCHAR(10) NOT NULL,
+    period_start TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    sent_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (user_id, frequency, period_start)
+);
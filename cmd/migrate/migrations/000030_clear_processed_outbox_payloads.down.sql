@@ -0,0 +1,3 @@
+-- irreversible: the payloads cleared by the up migration are gone, there is
+-- nothing to restore
+SELECT 1;
@@ -0,0 +1,6 @@
+-- processed and dead messages no longer keep their payload, activation
+-- emails carry the plaintext token. This can not be undone, the down
+-- migration leaves the cleared payloads as they are.
+UPDATE outbox_messages
+SET payload = '{}'
+WHERE processed_at IS NOT NULL OR dead_at IS NOT NULL;
@@ -0,0 +1,204 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+)
+
+const (
+	// ContentType is what actors, objects and activities are served as.
+	ContentType   = "application/activity+json"
+	JRDType       = "application/jrd+json"
+	ldContentType = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+
+	activityStreams = "https://www.w3.org/ns/activitystreams"
+	securityV1      = "https://w3id.org/security/v1"
+	// Public addresses an activity to everyone.
+	Public = activityStreams + "#Public"
+)
+
+type Actor struct {
+	Context           any       `json:"@context"`
+	ID                string    `json:"id"`
+	Type              string    `json:"type"`
+	PreferredUsername string    `json:"preferredUsername"`
+	Name              string    `json:"name"`
+	Inbox             string    `json:"inbox"`
+	Outbox            string    `json:"outbox"`
+	URL               string    `json:"url,omitempty"`
+	Published         string    `json:"published,omitempty"`
+	PublicKey         PublicKey `json:"publicKey"`
+}
+
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+type Note struct {
+	Context      any      `json:"@context,omitempty"`
+	ID           string   `json:"id"`
+	Type         string   `json:"type"`
+	AttributedTo string   `json:"attributedTo"`
+	Content      string   `json:"content"`
+	Published    string   `json:"published"`
+	Updated      string   `json:"updated,omitempty"`
+	To           []string `json:"to"`
+	Tag          []Tag    `json:"tag,omitempty"`
+}
+
+type Tag struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type Activity struct {
+	Context   any      `json:"@context,omitempty"`
+	ID        string   `json:"id"`
+	Type      string   `json:"type"`
+	Actor     string   `json:"actor"`
+	Object    any      `json:"object"`
+	To        []string `json:"to,omitempty"`
+	Published string   `json:"published,omitempty"`
+}
+
+// incomingActivity is an activity posted to an inbox. The object is either an
+// id or an embedded object depending on the sending server.
+type incomingActivity struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+}
+
+// objectRef reads the id and type of an object that may be given inline or
+// as a bare id.
+func objectRef(raw json.RawMessage) (id, typ string) {
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id, ""
+	}
+
+	var obj struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	}
+	_ = json.Unmarshal(raw, &obj)
+	return obj.ID, obj.Type
+}
+
+type OrderedCollection struct {
+	Context      any    `json:"@context"`
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	TotalItems   int    `json:"totalItems"`
+	OrderedItems any    `json:"orderedItems"`
+}
+
+// WebFinger is the JRD document returned by /.well-known/webfinger.
+type WebFinger struct {
+	Subject string          `json:"subject"`
+	Aliases []string        `json:"aliases,omitempty"`
+	Links   []WebFingerLink `json:"links"`
+}
+
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href"`
+}
+
+// remoteActor is the part of a remote actor document needed to talk to it.
+type remoteActor struct {
+	ID        string    `json:"id"`
+	Inbox     string    `json:"inbox"`
+	PublicKey PublicKey `json:"publicKey"`
+}
+
+func (s *Service) ActorURL(username string) string {
+	return fmt.Sprintf("%s/v1/ap/users/%s", s.config.BaseURL, username)
+}
+
+func (s *Service) NoteURL(postID int64) string {
+	return fmt.Sprintf("%s/v1/ap/posts/%d", s.config.BaseURL, postID)
+}
+
+// WebFinger resolves acct:username@domain resources to the actor of username.
+func (s *Service) WebFinger(username string) WebFinger {
+	actorURL := s.ActorURL(username)
+	return WebFinger{
+		Subject: fmt.Sprintf("acct:%s@%s", username, s.domain),
+		Aliases: []string{actorURL},
+		Links: []WebFingerLink{
+			{Rel: "self", Type: ContentType, Href: actorURL},
+		},
+	}
+}
+
+// ParseResource returns the username of an acct: resource on this server.
+func (s *Service) ParseResource(resource string) (string, bool) {
+	acct, ok := strings.CutPrefix(resource, "acct:")
+	if !ok {
+		return "", false
+	}
+
+	username, domain, ok := strings.Cut(acct, "@")
+	if !ok || username == "" || !strings.EqualFold(domain, s.domain) {
+		return "", false
+	}
+
+	return username, true
+}
+
+func (s *Service) Note(post *store.Post, username string) Note {
+	var content strings.Builder
+	content.WriteString("<p><strong>" + html.EscapeString(post.Title) + "</strong></p>")
+	for _, paragraph := range strings.Split(post.Content, "\n\n") {
+		content.WriteString("<p>" + html.EscapeString(paragraph) + "</p>")
+	}
+
+	note := Note{
+		ID:           s.NoteURL(post.ID),
+		Type:         "Note",
+		AttributedTo: s.ActorURL(username),
+		Content:      content.String(),
+		Published:    formatTime(post.CreatedAt),
+		To:           []string{Public},
+	}
+	if post.UpdatedAt != post.CreatedAt {
+		note.Updated = formatTime(post.UpdatedAt)
+	}
+	for _, tag := range post.Tags {
+		note.Tag = append(note.Tag, Tag{Type: "Hashtag", Name: "#" + tag})
+	}
+
+	return note
+}
+
+// createActivity wraps a post in the Create activity announcing it.
+func (s *Service) createActivity(post *store.Post, username string) Activity {
+	note := s.Note(post, username)
+	return Activity{
+		Context:   activityStreams,
+		ID:        note.ID + "/activity",
+		Type:      "Create",
+		Actor:     note.AttributedTo,
+		Object:    note,
+		To:        note.To,
+		Published: note.Published,
+	}
+}
+
+// formatTime normalizes a database timestamp to RFC3339 in UTC.
+func formatTime(value string) string {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return value
+	}
+	return t.UTC().Format(time.RFC3339)
+}
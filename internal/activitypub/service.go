@@ -0,0 +1,372 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+	"go.uber.org/zap"
+)
+
+var ErrUnsupportedActivity = errors.New("unsupported activity")
+
+type Config struct {
+	// BaseURL is the public url of the api, actor and object ids are built on it.
+	BaseURL string
+	// DeliveryInterval is how often pending deliveries are picked up.
+	DeliveryInterval time.Duration
+	// MaxAttempts is how many times a delivery is tried before it is given up.
+	MaxAttempts int
+	// AllowPrivate lets actors and inboxes use plain http and private and
+	// loopback addresses, for federating with local servers in dev.
+	AllowPrivate bool
+	Enabled      bool
+}
+
+// Service federates local users with other ActivityPub servers.
+type Service struct {
+	store  store.Storage
+	client *http.Client
+	config Config
+	logger *zap.SugaredLogger
+	domain string
+}
+
+func New(store store.Storage, client *http.Client, config Config, logger *zap.SugaredLogger) (*Service, error) {
+	u, err := url.Parse(config.BaseURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid federation base url %q", config.BaseURL)
+	}
+
+	return &Service{
+		store:  store,
+		client: client,
+		config: config,
+		logger: logger,
+		domain: u.Host,
+	}, nil
+}
+
+// key returns the key pair of a user, generating it on first use.
+func (s *Service) key(ctx context.Context, userID int64) (*store.UserKey, error) {
+	key, err := s.store.Federation.GetKey(ctx, userID)
+	if !errors.Is(err, store.ErrNotFound) {
+		return key, err
+	}
+
+	public, private, err := generateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Federation.CreateKey(ctx, &store.UserKey{
+		UserID:     userID,
+		PublicKey:  public,
+		PrivateKey: private,
+	}); err != nil {
+		return nil, err
+	}
+
+	// a concurrent request may have stored its key first
+	return s.store.Federation.GetKey(ctx, userID)
+}
+
+func (s *Service) Actor(ctx context.Context, user *store.User) (*Actor, error) {
+	key, err := s.key(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	actorURL := s.ActorURL(user.Username)
+	return &Actor{
+		Context:           []string{activityStreams, securityV1},
+		ID:                actorURL,
+		Type:              "Person",
+		PreferredUsername: user.Username,
+		Name:              user.Username,
+		Inbox:             actorURL + "/inbox",
+		Outbox:            actorURL + "/outbox",
+		Published:         formatTime(user.CreatedAt),
+		PublicKey: PublicKey{
+			ID:           actorURL + "#main-key",
+			Owner:        actorURL,
+			PublicKeyPem: key.PublicKey,
+		},
+	}, nil
+}
+
+// Outbox lists the given posts of user as Create activities.
+func (s *Service) Outbox(user *store.User, posts []store.Post) OrderedCollection {
+	activities := make([]Activity, len(posts))
+	for i := range posts {
+		activities[i] = s.createActivity(&posts[i], user.Username)
+		activities[i].Context = nil
+	}
+
+	return OrderedCollection{
+		Context:      activityStreams,
+		ID:           s.ActorURL(user.Username) + "/outbox",
+		Type:         "OrderedCollection",
+		TotalItems:   len(activities),
+		OrderedItems: activities,
+	}
+}
+
+// HandleInbox verifies and processes an activity posted to user's inbox.
+// Follow and Undo of a Follow change the user's remote followers, Create and
+// Like are recorded.
+func (s *Service) HandleInbox(ctx context.Context, user *store.User, r *http.Request, body []byte) error {
+	var signer *remoteActor
+	if _, err := Verify(r, body, func(keyID string) (*rsa.PublicKey, error) {
+		actor, err := s.fetchActor(ctx, keyID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+		}
+		if actor.PublicKey.ID != keyID {
+			return nil, fmt.Errorf("%w: unknown key %s", ErrInvalidSignature, keyID)
+		}
+		signer = actor
+		return parsePublicKey(actor.PublicKey.PublicKeyPem)
+	}); err != nil {
+		return err
+	}
+
+	var activity incomingActivity
+	if err := json.Unmarshal(body, &activity); err != nil {
+		return err
+	}
+
+	if activity.ID == "" || activity.Actor != signer.ID {
+		return fmt.Errorf("%w: activity is not by the signing actor", ErrInvalidSignature)
+	}
+
+	seen, err := s.store.Federation.HasActivity(ctx, activity.ID)
+	if err != nil || seen {
+		return err
+	}
+
+	if err := s.apply(ctx, user, signer, &activity, body); err != nil {
+		return err
+	}
+
+	objectID, _ := objectRef(activity.Object)
+
+	// recorded only once processed, so a redelivery retries a failure
+	return s.store.Federation.RecordActivity(ctx, &store.InboxActivity{
+		ID:      activity.ID,
+		UserID:  user.ID,
+		ActorID: activity.Actor,
+		Type:    activity.Type,
+		Object:  objectID,
+		Payload: body,
+	})
+}
+
+// apply processes an activity sent to user by signer.
+func (s *Service) apply(ctx context.Context, user *store.User, signer *remoteActor, activity *incomingActivity, body []byte) error {
+	objectID, objectType := objectRef(activity.Object)
+
+	switch activity.Type {
+	case "Follow":
+		if objectID != s.ActorURL(user.Username) {
+			return ErrUnsupportedActivity
+		}
+		if err := s.store.Federation.AddRemoteFollower(ctx, &store.RemoteFollower{
+			UserID:  user.ID,
+			ActorID: signer.ID,
+			Inbox:   signer.Inbox,
+		}); err != nil {
+			return err
+		}
+		return s.enqueue(ctx, user.ID, []string{signer.Inbox}, Activity{
+			Context: activityStreams,
+			ID:      fmt.Sprintf("%s#accepts/%d", s.ActorURL(user.Username), time.Now().UnixNano()),
+			Type:    "Accept",
+			Actor:   s.ActorURL(user.Username),
+			Object:  json.RawMessage(body),
+		})
+	case "Undo":
+		if objectType != "" && objectType != "Follow" {
+			// undoing anything but a follow is only recorded
+			return nil
+		}
+		return s.store.Federation.RemoveRemoteFollower(ctx, user.ID, signer.ID)
+	case "Create", "Like":
+		return nil
+	default:
+		return ErrUnsupportedActivity
+	}
+}
+
+// PostCreated announces a new post to the remote followers of its author.
+func (s *Service) PostCreated(ctx context.Context, user *store.User, post *store.Post) error {
+	followers, err := s.store.Federation.GetRemoteFollowers(ctx, user.ID)
+	if err != nil || len(followers) == 0 {
+		return err
+	}
+
+	var inboxes []string
+	for _, f := range followers {
+		if !slices.Contains(inboxes, f.Inbox) {
+			inboxes = append(inboxes, f.Inbox)
+		}
+	}
+
+	return s.enqueue(ctx, user.ID, inboxes, s.createActivity(post, user.Username))
+}
+
+func (s *Service) enqueue(ctx context.Context, userID int64, inboxes []string, activity Activity) error {
+	payload, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	return s.store.Federation.EnqueueDeliveries(ctx, userID, inboxes, payload)
+}
+
+// fetchActor loads the actor owning keyID from its server.
+func (s *Service) fetchActor(ctx context.Context, keyID string) (*remoteActor, error) {
+	actorURL, _, _ := strings.Cut(keyID, "#")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, actorURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ContentType+", "+ldContentType)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching actor %s: unexpected status %d", actorURL, resp.StatusCode)
+	}
+
+	var actor remoteActor
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&actor); err != nil {
+		return nil, err
+	}
+
+	if actor.ID != actorURL || actor.Inbox == "" {
+		return nil, fmt.Errorf("fetching actor %s: invalid actor document", actorURL)
+	}
+
+	return &actor, nil
+}
+
+// Run delivers queued activities every DeliveryInterval until ctx is done.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.DeliveryInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Deliver(ctx); err != nil {
+			s.logger.Errorw("error delivering activities", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Deliver posts the due activities to their inboxes, rescheduling failures
+// with exponential backoff.
+func (s *Service) Deliver(ctx context.Context) error {
+	deliveries, err := s.store.Federation.ClaimDeliveries(ctx, 50, time.Minute*5)
+	if err != nil {
+		return err
+	}
+
+	// on shutdown the delivery in progress finishes, the rest are claimed
+	// again once their lease expires
+	stop := ctx
+	ctx = context.WithoutCancel(ctx)
+
+	for _, d := range deliveries {
+		if stop.Err() != nil {
+			return nil
+		}
+
+		if err := s.deliver(ctx, d); err != nil {
+			var retryAt *time.Time
+			if d.Attempts < s.config.MaxAttempts {
+				next := time.Now().Add(backoff(d.Attempts))
+				retryAt = &next
+			}
+
+			s.logger.Warnw("activity delivery failed", "inbox", d.Inbox, "attempt", d.Attempts, "error", err.Error())
+			if err := s.store.Federation.MarkFailed(ctx, d.ID, err.Error(), retryAt); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := s.store.Federation.MarkDelivered(ctx, d.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) deliver(ctx context.Context, d store.FederationDelivery) error {
+	user, err := s.store.Users.GetByID(ctx, d.UserID)
+	if err != nil {
+		return err
+	}
+
+	key, err := s.key(ctx, d.UserID)
+	if err != nil {
+		return err
+	}
+	privateKey, err := parsePrivateKey(key.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Inbox, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	if err := Sign(req, s.ActorURL(user.Username)+"#main-key", privateKey, d.Payload); err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// backoff doubles the wait after every attempt, starting at a minute and
+// capped at a day.
+func backoff(attempts int) time.Duration {
+	wait := time.Minute << min(attempts-1, 11)
+	return min(wait, time.Hour*24)
+}
@@ -0,0 +1,367 @@
+package activitypub
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/outbound"
+	"github.com/MohammadTaghipour/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// instance is a federating server backed by an in-memory store.
+type instance struct {
+	service    *Service
+	server     *httptest.Server
+	federation *fakeFederation
+	user       *store.User
+}
+
+func newInstance(t *testing.T, user *store.User) *instance {
+	t.Helper()
+
+	in := &instance{federation: newFakeFederation(), user: user}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/ap/users/{username}", func(w http.ResponseWriter, r *http.Request) {
+		actor, err := in.service.Actor(r.Context(), in.user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		json.NewEncoder(w).Encode(actor)
+	})
+	mux.HandleFunc("POST /v1/ap/users/{username}/inbox", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		err := in.service.HandleInbox(r.Context(), in.user, r, body)
+		switch {
+		case err == nil:
+			w.WriteHeader(http.StatusAccepted)
+		case errors.Is(err, ErrInvalidSignature):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	})
+
+	in.server = httptest.NewServer(mux)
+	t.Cleanup(in.server.Close)
+
+	// both instances listen on loopback over plain http
+	client := outbound.NewClient(outbound.Config{Timeout: 5 * time.Second, AllowPrivate: true})
+
+	var err error
+	in.service, err = New(store.Storage{
+		Federation: in.federation,
+		Users:      fakeUsers{user: user},
+	}, client, Config{BaseURL: in.server.URL, MaxAttempts: 3}, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return in
+}
+
+func (in *instance) inbox() string {
+	return in.service.ActorURL(in.user.Username) + "/inbox"
+}
+
+func TestFederationBetweenInstances(t *testing.T) {
+	ctx := context.Background()
+	local := newInstance(t, &store.User{ID: 1, Username: "alice", CreatedAt: "2024-03-10T12:00:00Z"})
+	remote := newInstance(t, &store.User{ID: 2, Username: "bob", CreatedAt: "2024-03-10T12:00:00Z"})
+
+	follow := Activity{
+		Context: activityStreams,
+		ID:      remote.service.ActorURL("bob") + "#follows/1",
+		Type:    "Follow",
+		Actor:   remote.service.ActorURL("bob"),
+		Object:  local.service.ActorURL("alice"),
+	}
+
+	// the remote server signs and posts the follow, the local one fetches
+	// bob's actor to verify it
+	if err := remote.service.enqueue(ctx, 2, []string{local.inbox()}, follow); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.service.Deliver(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := remote.federation.status(); got != "delivered=1" {
+		t.Fatalf("remote deliveries %s, want the follow delivered", got)
+	}
+
+	followers, _ := local.federation.GetRemoteFollowers(ctx, 1)
+	if len(followers) != 1 || followers[0].Inbox != remote.inbox() {
+		t.Fatalf("local followers = %+v, want bob with inbox %s", followers, remote.inbox())
+	}
+
+	// a redelivered follow is processed once
+	if err := remote.service.enqueue(ctx, 2, []string{local.inbox()}, follow); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.service.Deliver(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := local.federation.status(); got != "pending=1" {
+		t.Fatalf("local deliveries %s, want a single accept queued", got)
+	}
+
+	// new posts reach the remote follower, signed the other way around
+	post := &store.Post{
+		ID:        10,
+		Title:     "Hello",
+		Content:   "from alice",
+		CreatedAt: "2024-03-10T13:00:00Z",
+		UpdatedAt: "2024-03-10T13:00:00Z",
+	}
+	if err := local.service.PostCreated(ctx, local.user, post); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.service.Deliver(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	create := local.service.NoteURL(10) + "/activity"
+	if seen, _ := remote.federation.HasActivity(ctx, create); !seen {
+		t.Errorf("remote did not receive %s", create)
+	}
+}
+
+func TestInboxRejectsForgedActivity(t *testing.T) {
+	ctx := context.Background()
+	local := newInstance(t, &store.User{ID: 1, Username: "alice", CreatedAt: "2024-03-10T12:00:00Z"})
+	remote := newInstance(t, &store.User{ID: 2, Username: "bob", CreatedAt: "2024-03-10T12:00:00Z"})
+
+	// bob signs a follow claiming to come from someone else
+	if err := remote.service.enqueue(ctx, 2, []string{local.inbox()}, Activity{
+		ID:     "https://elsewhere.example/follows/1",
+		Type:   "Follow",
+		Actor:  "https://elsewhere.example/users/mallory",
+		Object: local.service.ActorURL("alice"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.service.Deliver(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := remote.federation.status(); got != "pending=1" {
+		t.Errorf("remote deliveries %s, want the forged follow rejected and retried", got)
+	}
+	if followers, _ := local.federation.GetRemoteFollowers(ctx, 1); len(followers) != 0 {
+		t.Errorf("local followers = %+v, want none", followers)
+	}
+}
+
+func TestFetchActorRefusesPrivateAddresses(t *testing.T) {
+	remote := newInstance(t, &store.User{ID: 2, Username: "bob", CreatedAt: "2024-03-10T12:00:00Z"})
+
+	service, err := New(store.Storage{}, outbound.NewClient(outbound.Config{Timeout: 5 * time.Second}), Config{
+		BaseURL: "https://local.example",
+	}, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a key id may point anywhere, including the network of the api
+	_, err = service.fetchActor(context.Background(), remote.service.ActorURL("bob")+"#main-key")
+	if !errors.Is(err, outbound.ErrInsecureURL) {
+		t.Errorf("fetchActor error = %v, want ErrInsecureURL", err)
+	}
+
+	tls := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tls.Close()
+	_, err = service.fetchActor(context.Background(), tls.URL+"/v1/ap/users/bob#main-key")
+	if !errors.Is(err, outbound.ErrForbiddenAddress) {
+		t.Errorf("fetchActor error = %v, want ErrForbiddenAddress", err)
+	}
+}
+
+type fakeUsers struct {
+	usersStore
+	user *store.User
+}
+
+func (f fakeUsers) GetByID(_ context.Context, userID int64) (*store.User, error) {
+	if userID != f.user.ID {
+		return nil, store.ErrNotFound
+	}
+	return f.user, nil
+}
+
+// usersStore is the method set of store.Storage.Users, the fake only
+// implements what the service uses.
+type usersStore = interface {
+	Create(ctx context.Context, tx *sql.Tx, user *store.User) error
+	CreateAndInvite(ctx context.Context, user *store.User, token string, invitationsExpDate time.Duration, invite *store.OutboxMessage) error
+	GetByID(ctx context.Context, userID int64) (*store.User, error)
+	GetByEmail(ctx context.Context, email string) (*store.User, error)
+	GetByUsername(ctx context.Context, username string) (*store.User, error)
+	Activate(ctx context.Context, token string) (*store.User, error)
+	SetLocale(ctx context.Context, userID int64, locale string) error
+	RecordLogin(ctx context.Context, userID int64) error
+	Delete(ctx context.Context, userID int64) error
+	Search(ctx context.Context, viewerID int64, sq store.PaginatedSearchQuery) ([]store.UserCard, error)
+	DeleteExpiredInvitations(ctx context.Context) (int64, error)
+}
+
+type fakeDelivery struct {
+	store.FederationDelivery
+	state string
+}
+
+type fakeFederation struct {
+	mu         sync.Mutex
+	keys       map[int64]*store.UserKey
+	followers  map[string]store.RemoteFollower
+	activities map[string]store.InboxActivity
+	deliveries []*fakeDelivery
+}
+
+func newFakeFederation() *fakeFederation {
+	return &fakeFederation{
+		keys:       map[int64]*store.UserKey{},
+		followers:  map[string]store.RemoteFollower{},
+		activities: map[string]store.InboxActivity{},
+	}
+}
+
+// status counts the deliveries by state, e.g. "delivered=1 pending=1".
+func (f *fakeFederation) status() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	counts := map[string]int{}
+	for _, d := range f.deliveries {
+		counts[d.state]++
+	}
+
+	var parts []string
+	for _, state := range []string{"delivered", "failed", "pending"} {
+		if counts[state] > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", state, counts[state]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (f *fakeFederation) GetKey(_ context.Context, userID int64) (*store.UserKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, ok := f.keys[userID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return key, nil
+}
+
+func (f *fakeFederation) CreateKey(_ context.Context, key *store.UserKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.keys[key.UserID]; !ok {
+		f.keys[key.UserID] = key
+	}
+	return nil
+}
+
+func (f *fakeFederation) AddRemoteFollower(_ context.Context, follower *store.RemoteFollower) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.followers[follower.ActorID] = *follower
+	return nil
+}
+
+func (f *fakeFederation) RemoveRemoteFollower(_ context.Context, _ int64, actorID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.followers, actorID)
+	return nil
+}
+
+func (f *fakeFederation) GetRemoteFollowers(_ context.Context, userID int64) ([]store.RemoteFollower, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var followers []store.RemoteFollower
+	for _, follower := range f.followers {
+		if follower.UserID == userID {
+			followers = append(followers, follower)
+		}
+	}
+	return followers, nil
+}
+
+func (f *fakeFederation) HasActivity(_ context.Context, activityID string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.activities[activityID]
+	return ok, nil
+}
+
+func (f *fakeFederation) RecordActivity(_ context.Context, activity *store.InboxActivity) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.activities[activity.ID] = *activity
+	return nil
+}
+
+func (f *fakeFederation) EnqueueDeliveries(_ context.Context, userID int64, inboxes []string, payload []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, inbox := range inboxes {
+		f.deliveries = append(f.deliveries, &fakeDelivery{
+			FederationDelivery: store.FederationDelivery{
+				ID:      int64(len(f.deliveries) + 1),
+				UserID:  userID,
+				Inbox:   inbox,
+				Payload: payload,
+			},
+			state: "pending",
+		})
+	}
+	return nil
+}
+
+// ClaimDeliveries hands out every pending delivery, retries are due at once.
+func (f *fakeFederation) ClaimDeliveries(_ context.Context, limit int, _ time.Duration) ([]store.FederationDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var claimed []store.FederationDelivery
+	for _, d := range f.deliveries {
+		if d.state == "pending" && len(claimed) < limit {
+			d.Attempts++
+			d.state = "running"
+			claimed = append(claimed, d.FederationDelivery)
+		}
+	}
+	return claimed, nil
+}
+
+func (f *fakeFederation) MarkDelivered(_ context.Context, deliveryID int64) error {
+	return f.setState(deliveryID, "delivered")
+}
+
+func (f *fakeFederation) MarkFailed(_ context.Context, deliveryID int64, _ string, retryAt *time.Time) error {
+	if retryAt == nil {
+		return f.setState(deliveryID, "failed")
+	}
+	return f.setState(deliveryID, "pending")
+}
+
+func (f *fakeFederation) setState(deliveryID int64, state string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deliveries[deliveryID-1].state = state
+	return nil
+}
@@ -0,0 +1,166 @@
+package activitypub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSignature = errors.New("invalid http signature")
+
+// signedHeaders are the headers covered by outgoing signatures and required
+// on incoming ones.
+var signedHeaders = []string{"(request-target)", "host", "date", "digest"}
+
+// maxClockSkew is how far the Date of a signed request may drift from ours.
+const maxClockSkew = time.Hour
+
+// Sign adds Date, Digest and a draft-cavage Signature header to req.
+func Sign(req *http.Request, keyID string, key *rsa.PrivateKey, body []byte) error {
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("Digest", digest(body))
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+
+	hash := sha256.Sum256([]byte(signingString(req, signedHeaders)))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID,
+		strings.Join(signedHeaders, " "),
+		base64.StdEncoding.EncodeToString(signature),
+	))
+	return nil
+}
+
+// Verify checks the Signature header of r against the key returned by
+// lookup and returns the id of the key that signed it.
+func Verify(r *http.Request, body []byte, lookup func(keyID string) (*rsa.PublicKey, error)) (string, error) {
+	params := parseSignature(r.Header.Get("Signature"))
+	keyID, headers, signature := params["keyId"], strings.Fields(params["headers"]), params["signature"]
+	if keyID == "" || signature == "" {
+		return "", ErrInvalidSignature
+	}
+
+	for _, h := range signedHeaders {
+		if !slices.Contains(headers, h) {
+			return "", fmt.Errorf("%w: %s is not signed", ErrInvalidSignature, h)
+		}
+	}
+
+	if r.Header.Get("Digest") != digest(body) {
+		return "", fmt.Errorf("%w: digest mismatch", ErrInvalidSignature)
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil || time.Since(date).Abs() > maxClockSkew {
+		return "", fmt.Errorf("%w: date out of range", ErrInvalidSignature)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	key, err := lookup(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(signingString(r, headers)))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], decoded); err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	return keyID, nil
+}
+
+func signingString(r *http.Request, headers []string) string {
+	lines := make([]string, len(headers))
+	for i, h := range headers {
+		switch h {
+		case "(request-target)":
+			lines[i] = fmt.Sprintf("%s: %s %s", h, strings.ToLower(r.Method), r.URL.RequestURI())
+		case "host":
+			lines[i] = h + ": " + r.Host
+		default:
+			lines[i] = h + ": " + strings.Join(r.Header.Values(h), ", ")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseSignature splits a Signature header into its key="value" parameters.
+func parseSignature(header string) map[string]string {
+	params := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[key] = strings.Trim(value, `"`)
+		}
+	}
+	return params
+}
+
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// generateKey returns a new PEM encoded RSA key pair.
+func generateKey() (publicPEM, privatePEM string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	publicPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+	privatePEM = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	return publicPEM, privatePEM, nil
+}
+
+func parsePublicKey(value string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+func parsePrivateKey(value string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
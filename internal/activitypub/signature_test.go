@@ -0,0 +1,129 @@
+package activitypub
+
+import (
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	public, private, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := parsePrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := parsePublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const keyID = "https://remote.example/v1/ap/users/bob#main-key"
+	body := []byte(`{"type":"Follow"}`)
+
+	tests := []struct {
+		name    string
+		tamper  func(r *http.Request) []byte
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			tamper: func(*http.Request) []byte { return body },
+		},
+		{
+			name:    "body changed",
+			tamper:  func(*http.Request) []byte { return []byte(`{"type":"Undo"}`) },
+			wantErr: true,
+		},
+		{
+			name: "path changed",
+			tamper: func(r *http.Request) []byte {
+				r.URL.Path = "/v1/ap/users/carol/inbox"
+				return body
+			},
+			wantErr: true,
+		},
+		{
+			name: "date out of range",
+			tamper: func(r *http.Request) []byte {
+				r.Header.Set("Date", time.Now().Add(-2*maxClockSkew).UTC().Format(http.TimeFormat))
+				return body
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsigned",
+			tamper: func(r *http.Request) []byte {
+				r.Header.Del("Signature")
+				return body
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := http.NewRequest(http.MethodPost, "https://local.example/v1/ap/users/alice/inbox", strings.NewReader(string(body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Sign(out, keyID, privateKey, body); err != nil {
+				t.Fatal(err)
+			}
+
+			// the request as the receiving server sees it
+			in := httptest.NewRequest(out.Method, out.URL.String(), nil)
+			in.Header = out.Header.Clone()
+			received := tt.tamper(in)
+
+			got, err := Verify(in, received, func(id string) (*rsa.PublicKey, error) {
+				if id != keyID {
+					t.Errorf("looked up key %q, want %q", id, keyID)
+				}
+				return publicKey, nil
+			})
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSignature) {
+					t.Errorf("Verify error = %v, want ErrInvalidSignature", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if got != keyID {
+				t.Errorf("Verify = %q, want %q", got, keyID)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsOtherKey(t *testing.T) {
+	_, private, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, _ := parsePrivateKey(private)
+	otherKey, _ := parsePublicKey(other)
+
+	body := []byte(`{}`)
+	r := httptest.NewRequest(http.MethodPost, "https://local.example/v1/ap/users/alice/inbox", nil)
+	if err := Sign(r, "https://remote.example/v1/ap/users/bob#main-key", privateKey, body); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Verify(r, body, func(string) (*rsa.PublicKey, error) { return otherKey, nil })
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify error = %v, want ErrInvalidSignature", err)
+	}
+}
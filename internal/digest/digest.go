@@ -0,0 +1,240 @@
+package digest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/i18n"
+	"github.com/MohammadTaghipour/social/internal/mailer"
+	"github.com/MohammadTaghipour/social/internal/outbox"
+	"github.com/MohammadTaghipour/social/internal/store"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidToken = errors.New("invalid unsubscribe token")
+
+type Config struct {
+	// Secret signs unsubscribe tokens.
+	Secret string
+	// UnsubscribeURL is the endpoint of unsubscribe links, the token is
+	// added as the token query parameter.
+	UnsubscribeURL string
+	// FrontendURL is where the links to posts and the feed point.
+	FrontendURL string
+	// ScoreDecay is the ranking decay, see store.PaginatedFeedQuery.
+	ScoreDecay time.Duration
+	TopPosts   int
+	BatchSize  int
+}
+
+// Post is a post in a digest.
+type Post struct {
+	Title    string
+	Author   string
+	URL      string
+	Comments string
+}
+
+// Digest is the data of the digest template. Counts come as localized
+// sentences so the templates need no plural rules.
+type Digest struct {
+	Username             string
+	Frequency            string
+	Posts                []Post
+	NewFollowers         []string
+	NewFollowersSummary  string
+	NotificationsSummary string
+	FeedURL              string
+	UnsubscribeURL       string
+}
+
+// Generator builds digests of the activity users missed and queues them as
+// emails.
+type Generator struct {
+	store  store.Storage
+	config Config
+	logger *zap.SugaredLogger
+}
+
+func New(store store.Storage, config Config, logger *zap.SugaredLogger) *Generator {
+	return &Generator{store: store, config: config, logger: logger}
+}
+
+// Period returns the start of the digest period at frequency that contains
+// t, and the length of the period. Daily periods start at midnight UTC,
+// weekly ones on Monday.
+func Period(frequency string, t time.Time) (time.Time, time.Duration, error) {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch frequency {
+	case store.DigestDaily:
+		return day, time.Hour * 24, nil
+	case store.DigestWeekly:
+		sinceMonday := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -sinceMonday), time.Hour * 24 * 7, nil
+	default:
+		return time.Time{}, 0, fmt.Errorf("no digest period for frequency %q", frequency)
+	}
+}
+
+// Send queues the digests at frequency for the period that contains now.
+// Each digest covers the period before it and goes to users who did not sign
+// in during that time and have something to read. It returns how many
+// digests it queued.
+func (g *Generator) Send(ctx context.Context, frequency string, now time.Time) (int, error) {
+	period, length, err := Period(frequency, now)
+	if err != nil {
+		return 0, err
+	}
+	since := period.Add(-length)
+
+	var (
+		afterID int64
+		queued  int
+	)
+	for {
+		recipients, err := g.store.Digests.GetRecipients(ctx, frequency, period, since, afterID, g.config.BatchSize)
+		if err != nil {
+			return queued, err
+		}
+
+		for _, r := range recipients {
+			afterID = r.ID
+
+			ok, err := g.send(ctx, r, frequency, since, period)
+			if err != nil {
+				if ctx.Err() != nil {
+					return queued, ctx.Err()
+				}
+				// one broken digest must not hold back the others
+				g.logger.Warnw("building digest failed", "user", r.ID, "frequency", frequency, "error", err.Error())
+				continue
+			}
+			if ok {
+				queued++
+			}
+		}
+
+		if len(recipients) < g.config.BatchSize {
+			return queued, nil
+		}
+	}
+}
+
+func (g *Generator) send(ctx context.Context, r store.DigestRecipient, frequency string, since, period time.Time) (bool, error) {
+	digest, err := g.Build(ctx, r, frequency, since, period)
+	if err != nil || digest == nil {
+		return false, err
+	}
+
+	key := fmt.Sprintf("digest-%d-%s-%d", r.ID, frequency, period.Unix())
+	email, err := outbox.NewEmail(key, mailer.DigestTemplate, r.Locale, r.Username, r.Email, digest)
+	if err != nil {
+		return false, err
+	}
+
+	return g.store.Digests.Record(ctx, r.ID, frequency, period, email)
+}
+
+// Build collects the activity of r between since and until: the top posts
+// of the users they follow, new followers and unread notifications. It
+// returns nil when there is nothing to tell.
+func (g *Generator) Build(ctx context.Context, r store.DigestRecipient, frequency string, since, until time.Time) (*Digest, error) {
+	// the feed includes the user's own posts, fetch extra to make up for them
+	page, err := g.store.Posts.GetUserFeed(ctx, r.ID, store.PaginatedFeedQuery{
+		Limit:      g.config.TopPosts * 2,
+		Sort:       "top",
+		Tags:       []string{},
+		Since:      &since,
+		Until:      &until,
+		ScoreDecay: g.config.ScoreDecay,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	followers, followersCount, err := g.store.Digests.GetNewFollowers(ctx, r.ID, since, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	unread, err := g.store.Notifications.CountUnread(ctx, r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	printer := i18n.Printer(i18n.Match(r.Locale))
+
+	digest := &Digest{
+		Username:       r.Username,
+		Frequency:      frequency,
+		NewFollowers:   followers,
+		FeedURL:        g.config.FrontendURL + "/feed",
+		UnsubscribeURL: g.config.UnsubscribeURL + "?token=" + url.QueryEscape(g.UnsubscribeToken(r.ID)),
+	}
+
+	for _, p := range page.Posts {
+		if p.UserID == r.ID {
+			continue
+		}
+		if len(digest.Posts) == g.config.TopPosts {
+			break
+		}
+		digest.Posts = append(digest.Posts, Post{
+			Title:    p.Title,
+			Author:   p.User.Username,
+			URL:      fmt.Sprintf("%s/post/%d", g.config.FrontendURL, p.ID),
+			Comments: printer.Sprintf(i18n.MsgDigestComments, p.CommentCount),
+		})
+	}
+
+	if followersCount > 0 {
+		digest.NewFollowersSummary = printer.Sprintf(i18n.MsgDigestNewFollowers, followersCount)
+	}
+	if unread > 0 {
+		digest.NotificationsSummary = printer.Sprintf(i18n.MsgDigestNotifications, unread)
+	}
+
+	if len(digest.Posts) == 0 && followersCount == 0 && unread == 0 {
+		return nil, nil
+	}
+
+	return digest, nil
+}
+
+// UnsubscribeToken returns the token of userID's unsubscribe link. It does
+// not expire, links in old digests keep working.
+func (g *Generator) UnsubscribeToken(userID int64) string {
+	id := strconv.FormatInt(userID, 10)
+	return id + "." + g.sign(id)
+}
+
+// ParseUnsubscribeToken returns the user an unsubscribe token belongs to.
+func (g *Generator) ParseUnsubscribeToken(token string) (int64, error) {
+	id, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(g.sign(id))) {
+		return 0, ErrInvalidToken
+	}
+
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	return userID, nil
+}
+
+func (g *Generator) sign(id string) string {
+	mac := hmac.New(sha256.New, []byte(g.config.Secret))
+	mac.Write([]byte("digest-unsubscribe:" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
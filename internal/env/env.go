@@ -3,6 +3,7 @@ package env
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 func GetString(key, defaul string) string {
@@ -36,3 +37,27 @@ func GetBool(key string, defaul bool) bool {
 
 	return valAsBool
 }
+
+func GetFloat(key string, defaul float64) float64 {
+	value, isOK := os.LookupEnv(key)
+
+	valAsFloat, err := strconv.ParseFloat(value, 64)
+
+	if err != nil || !isOK {
+		return defaul
+	}
+
+	return valAsFloat
+}
+
+func GetDuration(key string, defaul time.Duration) time.Duration {
+	value, isOK := os.LookupEnv(key)
+
+	valAsDuration, err := time.ParseDuration(value)
+
+	if err != nil || !isOK {
+		return defaul
+	}
+
+	return valAsDuration
+}
@@ -0,0 +1,63 @@
+package i18n
+
+import (
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+// Supported lists the locales with translations. The first one is the
+// fallback for everything else.
+var Supported = []language.Tag{
+	language.English,
+	language.German,
+}
+
+var (
+	matcher  = language.NewMatcher(Supported)
+	messages = catalog.NewBuilder(catalog.Fallback(Supported[0]))
+)
+
+// Match returns the supported locale that best fits the preferences, most
+// preferred first. A preference is a locale such as "de-AT" or a whole
+// Accept-Language header; empty and malformed ones are skipped.
+func Match(preferences ...string) language.Tag {
+	tag, _ := match(preferences...)
+	return tag
+}
+
+// Lookup returns the supported locale for locale, and false when there is no
+// translation close to it.
+func Lookup(locale string) (language.Tag, bool) {
+	return match(locale)
+}
+
+func match(preferences ...string) (language.Tag, bool) {
+	var tags []language.Tag
+	for _, p := range preferences {
+		if p == "" {
+			continue
+		}
+		parsed, _, err := language.ParseAcceptLanguage(p)
+		if err != nil {
+			continue
+		}
+		tags = append(tags, parsed...)
+	}
+
+	_, index, confidence := matcher.Match(tags...)
+	return Supported[index], confidence != language.No
+}
+
+// Printer formats and translates messages into locale. Keys without a
+// translation print as the English key itself.
+func Printer(locale language.Tag) *message.Printer {
+	return message.NewPrinter(locale, message.Catalog(messages))
+}
+
+func set(locale language.Tag, key string, msg ...catalog.Message) {
+	// messages are static, a failing one is a programming error
+	if err := messages.Set(locale, key, msg...); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,105 @@
+package i18n
+
+import (
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message/catalog"
+)
+
+// Message keys are the English messages. A key only needs an English entry
+// when it is pluralized.
+const (
+	MsgInternalError   = "Something went wrong in server"
+	MsgNotFound        = "Not found"
+	MsgConflict        = "Resource was modified by another request"
+	MsgUnauthorized    = "Unauthorized"
+	MsgForbidden       = "Forbidden"
+	MsgTooManyRequests = "Too many requests, try again in %d seconds"
+
+	// bad requests, %s is the JSON name of the field
+	MsgBadRequest     = "Invalid request: %s"
+	MsgEmptyBody      = "Request body must not be empty"
+	MsgMalformedJSON  = "Request body is not valid JSON"
+	MsgBodyTooLarge   = "Request body must not be larger than %d bytes"
+	MsgUnknownField   = "Request body has an unknown field %s"
+	MsgFieldType      = "%s has the wrong type"
+	MsgFieldRequired  = "%s is required"
+	MsgFieldMinLength = "%s must be at least %s characters long"
+	MsgFieldMaxLength = "%s must be at most %s characters long"
+	MsgFieldMin       = "%s must be at least %s"
+	MsgFieldMax       = "%s must be at most %s"
+	MsgFieldEmail     = "%s must be an email address"
+	MsgFieldURL       = "%s must be a URL"
+	MsgFieldOneOf     = "%s must be one of %s"
+	MsgFieldInvalid   = "%s is invalid"
+
+	MsgDigestComments      = "%d comments"
+	MsgDigestNewFollowers  = "%d people started following you"
+	MsgDigestNotifications = "You have %d unread notifications"
+
+	// the unsubscribe page of digest emails
+	MsgDigestUnsubscribeTitle   = "Unsubscribe from digests"
+	MsgDigestUnsubscribeConfirm = "Stop receiving activity digest emails? You can turn them on again in your settings."
+	MsgDigestUnsubscribeButton  = "Unsubscribe"
+	MsgDigestUnsubscribed       = "You will no longer receive activity digest emails."
+)
+
+func init() {
+	set(language.English, MsgTooManyRequests, plural.Selectf(1, "%d",
+		"=1", "Too many requests, try again in %d second",
+		"other", "Too many requests, try again in %d seconds",
+	))
+	set(language.English, MsgDigestComments, plural.Selectf(1, "%d",
+		"=1", "%d comment",
+		"other", "%d comments",
+	))
+	set(language.English, MsgDigestNewFollowers, plural.Selectf(1, "%d",
+		"=1", "%d person started following you",
+		"other", "%d people started following you",
+	))
+	set(language.English, MsgDigestNotifications, plural.Selectf(1, "%d",
+		"=1", "You have %d unread notification",
+		"other", "You have %d unread notifications",
+	))
+
+	set(language.German, MsgInternalError, catalog.String("Auf dem Server ist ein Fehler aufgetreten"))
+	set(language.German, MsgNotFound, catalog.String("Nicht gefunden"))
+	set(language.German, MsgConflict, catalog.String("Die Ressource wurde von einer anderen Anfrage geändert"))
+	set(language.German, MsgUnauthorized, catalog.String("Nicht angemeldet"))
+	set(language.German, MsgForbidden, catalog.String("Zugriff verweigert"))
+	set(language.German, MsgTooManyRequests, plural.Selectf(1, "%d",
+		"=1", "Zu viele Anfragen, bitte in %d Sekunde erneut versuchen",
+		"other", "Zu viele Anfragen, bitte in %d Sekunden erneut versuchen",
+	))
+	set(language.German, MsgBadRequest, catalog.String("Ungültige Anfrage: %s"))
+	set(language.German, MsgEmptyBody, catalog.String("Der Inhalt der Anfrage darf nicht leer sein"))
+	set(language.German, MsgMalformedJSON, catalog.String("Der Inhalt der Anfrage ist kein gültiges JSON"))
+	set(language.German, MsgBodyTooLarge, catalog.String("Der Inhalt der Anfrage darf höchstens %d Bytes groß sein"))
+	set(language.German, MsgUnknownField, catalog.String("Der Inhalt der Anfrage hat ein unbekanntes Feld %s"))
+	set(language.German, MsgFieldType, catalog.String("%s hat den falschen Typ"))
+	set(language.German, MsgFieldRequired, catalog.String("%s ist erforderlich"))
+	set(language.German, MsgFieldMinLength, catalog.String("%s muss mindestens %s Zeichen lang sein"))
+	set(language.German, MsgFieldMaxLength, catalog.String("%s darf höchstens %s Zeichen lang sein"))
+	set(language.German, MsgFieldMin, catalog.String("%s muss mindestens %s sein"))
+	set(language.German, MsgFieldMax, catalog.String("%s darf höchstens %s sein"))
+	set(language.German, MsgFieldEmail, catalog.String("%s muss eine E-Mail-Adresse sein"))
+	set(language.German, MsgFieldURL, catalog.String("%s muss eine URL sein"))
+	set(language.German, MsgFieldOneOf, catalog.String("%s muss einer der Werte %s sein"))
+	set(language.German, MsgFieldInvalid, catalog.String("%s ist ungültig"))
+	set(language.German, MsgDigestComments, plural.Selectf(1, "%d",
+		"=1", "%d Kommentar",
+		"other", "%d Kommentare",
+	))
+	set(language.German, MsgDigestNewFollowers, plural.Selectf(1, "%d",
+		"=1", "%d Person folgt dir jetzt",
+		"other", "%d Personen folgen dir jetzt",
+	))
+	set(language.German, MsgDigestNotifications, plural.Selectf(1, "%d",
+		"=1", "Du hast %d ungelesene Benachrichtigung",
+		"other", "Du hast %d ungelesene Benachrichtigungen",
+	))
+	set(language.German, MsgDigestUnsubscribeTitle, catalog.String("Zusammenfassungen abbestellen"))
+	set(language.German, MsgDigestUnsubscribeConfirm, catalog.String("Keine Zusammenfassungen deiner Aktivitäten mehr per E-Mail erhalten? Du kannst sie in deinen Einstellungen wieder einschalten."))
+	set(language.German, MsgDigestUnsubscribeButton, catalog.String("Abbestellen"))
+	set(language.German, MsgDigestUnsubscribed, catalog.String("Du erhältst keine Zusammenfassungen deiner Aktivitäten mehr per E-Mail."))
+}
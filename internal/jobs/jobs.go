@@ -0,0 +1,250 @@
+package jobs
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+	"go.uber.org/zap"
+)
+
+const defaultMaxAttempts = 10
+
+type Config struct {
+	// Queues maps every queue worked on to how many of its jobs run at once.
+	// Jobs of other queues stay pending.
+	Queues       map[string]int
+	PollInterval time.Duration
+	// Lease is how long a job may run before it is cancelled and another
+	// worker may take it over.
+	Lease time.Duration
+	// DrainTimeout is how long running jobs get to finish on shutdown.
+	DrainTimeout time.Duration
+	Enabled      bool
+}
+
+// Kind is a type of job taking arguments T, e.g.
+//
+//	var SendDigest = jobs.Kind[DigestArgs]{Name: "send_digest", Queue: "default"}
+type Kind[T any] struct {
+	Name  string
+	Queue string
+	// MaxAttempts defaults to 10
+	MaxAttempts int
+}
+
+type Options struct {
+	// RunAt delays the job, it runs right away when zero
+	RunAt time.Time
+	// UniqueKey keeps a job from being queued while another job with the
+	// same key is pending or running
+	UniqueKey string
+}
+
+// Enqueue queues a job of kind k. It reports false when it was deduplicated
+// by its unique key.
+func (k Kind[T]) Enqueue(ctx context.Context, s store.Storage, args T, opts Options) (bool, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return false, err
+	}
+
+	return s.Jobs.Enqueue(ctx, &store.Job{
+		Queue:       k.Queue,
+		Kind:        k.Name,
+		Args:        data,
+		UniqueKey:   opts.UniqueKey,
+		MaxAttempts: cmp.Or(k.MaxAttempts, defaultMaxAttempts),
+		RunAt:       opts.RunAt,
+	})
+}
+
+type handler func(ctx context.Context, job store.Job) error
+
+// Handle registers fn to run the jobs of kind k. It must be called before Run.
+func Handle[T any](r *Runner, k Kind[T], fn func(ctx context.Context, args T) error) {
+	r.handlers[k.Name] = func(ctx context.Context, job store.Job) error {
+		var args T
+		if err := json.Unmarshal(job.Args, &args); err != nil {
+			return err
+		}
+		return fn(ctx, args)
+	}
+}
+
+// Runner works on the jobs of the configured queues.
+type Runner struct {
+	store    store.Storage
+	config   Config
+	logger   *zap.SugaredLogger
+	handlers map[string]handler
+}
+
+// NewRunner returns a runner handling the jobs of this package, the packages
+// owning the other kinds register them with Handle. The API and cmd/worker
+// both register every kind, so either can run any job.
+func NewRunner(store store.Storage, config Config, logger *zap.SugaredLogger) *Runner {
+	r := &Runner{
+		store:    store,
+		config:   config,
+		logger:   logger,
+		handlers: make(map[string]handler),
+	}
+
+	Handle(r, PurgeJobs, r.purgeJobs)
+
+	return r
+}
+
+// Run claims and runs jobs until ctx is done, then waits up to the drain
+// timeout for running jobs before cancelling them.
+func (r *Runner) Run(ctx context.Context) {
+	// running jobs outlive ctx until they are drained
+	work, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	var (
+		pollers sync.WaitGroup
+		running sync.WaitGroup
+	)
+	for queue, concurrency := range r.config.Queues {
+		pollers.Add(1)
+		go func() {
+			defer pollers.Done()
+			r.poll(ctx, work, queue, concurrency, &running)
+		}()
+	}
+	pollers.Wait()
+
+	drained := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(r.config.DrainTimeout):
+		r.logger.Warnw("cancelling jobs still running after drain timeout", "timeout", r.config.DrainTimeout.String())
+		cancel()
+		<-drained
+	}
+}
+
+func (r *Runner) poll(ctx, work context.Context, queue string, concurrency int, running *sync.WaitGroup) {
+	slots := make(chan struct{}, concurrency)
+
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if free := concurrency - len(slots); free > 0 {
+			jobs, err := r.store.Jobs.Claim(ctx, queue, free, r.config.Lease)
+			if err != nil && ctx.Err() == nil {
+				r.logger.Errorw("error claiming jobs", "queue", queue, "error", err)
+			}
+
+			for _, job := range jobs {
+				slots <- struct{}{}
+				running.Add(1)
+				go func() {
+					defer func() {
+						<-slots
+						running.Done()
+					}()
+					r.run(work, job)
+				}()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Runner) run(work context.Context, job store.Job) {
+	ctx, cancel := context.WithTimeout(work, r.config.Lease)
+	defer cancel()
+
+	err := r.execute(ctx, job)
+
+	// record the outcome even when the job was cancelled
+	ctx, cancel = context.WithTimeout(context.WithoutCancel(work), 5*time.Second)
+	defer cancel()
+
+	if err == nil {
+		if err := r.store.Jobs.Complete(ctx, &job); err != nil {
+			r.logOutcomeError("error completing job", job, err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	if job.Attempts < job.MaxAttempts {
+		next := time.Now().Add(backoff(job.Attempts))
+		retryAt = &next
+	}
+
+	r.logger.Warnw("job failed", "job", job.ID, "kind", job.Kind, "attempt", job.Attempts, "error", err.Error())
+	if err := r.store.Jobs.Fail(ctx, &job, err.Error(), retryAt); err != nil {
+		r.logOutcomeError("error failing job", job, err)
+	}
+}
+
+func (r *Runner) logOutcomeError(msg string, job store.Job, err error) {
+	if errors.Is(err, store.ErrLeaseLost) {
+		r.logger.Warnw("job outcome dropped, its lease expired and it was claimed again", "job", job.ID, "attempt", job.Attempts)
+		return
+	}
+	r.logger.Errorw(msg, "job", job.ID, "error", err)
+}
+
+func (r *Runner) execute(ctx context.Context, job store.Job) (err error) {
+	h, ok := r.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler for job kind %q", job.Kind)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+
+	return h(ctx, job)
+}
+
+// ParseQueues parses a "queue:concurrency,..." list, e.g. "default:10,maintenance:1".
+func ParseQueues(s string) (map[string]int, error) {
+	queues := make(map[string]int)
+	for _, part := range strings.Split(s, ",") {
+		name, concurrency, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("queue %q is not name:concurrency", part)
+		}
+
+		n, err := strconv.Atoi(concurrency)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("queue %q needs a positive concurrency", name)
+		}
+		queues[name] = n
+	}
+	return queues, nil
+}
+
+// backoff doubles the wait after every attempt, starting at 15 seconds and
+// capped at 6 hours.
+func backoff(attempts int) time.Duration {
+	wait := time.Second * 15 << min(attempts-1, 11)
+	return min(wait, time.Hour*6)
+}
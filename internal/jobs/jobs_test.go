@@ -0,0 +1,266 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var echoJob = Kind[echoArgs]{Name: "echo", Queue: "default"}
+
+type echoArgs struct {
+	Err   string `json:"err"`
+	Panic bool   `json:"panic"`
+}
+
+func TestRunnerRecordsOutcome(t *testing.T) {
+	tests := []struct {
+		name     string
+		job      store.Job
+		wantFail string
+		// wantRetry is the expected backoff, zero when the job is given up on
+		wantRetry time.Duration
+	}{
+		{
+			name: "completed",
+			job:  store.Job{Kind: "echo", Args: []byte(`{}`), Attempts: 1, MaxAttempts: 3},
+		},
+		{
+			name:      "retried",
+			job:       store.Job{Kind: "echo", Args: []byte(`{"err":"boom"}`), Attempts: 2, MaxAttempts: 3},
+			wantFail:  "boom",
+			wantRetry: 30 * time.Second,
+		},
+		{
+			name:     "out of attempts",
+			job:      store.Job{Kind: "echo", Args: []byte(`{"err":"boom"}`), Attempts: 3, MaxAttempts: 3},
+			wantFail: "boom",
+		},
+		{
+			name:      "panicked",
+			job:       store.Job{Kind: "echo", Args: []byte(`{"panic":true}`), Attempts: 1, MaxAttempts: 3},
+			wantFail:  "job panicked: echo",
+			wantRetry: 15 * time.Second,
+		},
+		{
+			name:      "unknown kind",
+			job:       store.Job{Kind: "missing", Args: []byte(`{}`), Attempts: 1, MaxAttempts: 3},
+			wantFail:  `no handler for job kind "missing"`,
+			wantRetry: 15 * time.Second,
+		},
+		{
+			name:      "invalid arguments",
+			job:       store.Job{Kind: "echo", Args: []byte(`[]`), Attempts: 1, MaxAttempts: 3},
+			wantFail:  "json: cannot unmarshal",
+			wantRetry: 15 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := &fakeJobs{}
+			r := newTestRunner(jobs, zap.NewNop().Sugar())
+
+			start := time.Now()
+			r.run(context.Background(), tt.job)
+
+			if tt.wantFail == "" {
+				if jobs.completed != 1 || jobs.failed != 0 {
+					t.Fatalf("completed %d and failed %d times, want one completion", jobs.completed, jobs.failed)
+				}
+				return
+			}
+
+			if jobs.completed != 0 || jobs.failed != 1 {
+				t.Fatalf("completed %d and failed %d times, want one failure", jobs.completed, jobs.failed)
+			}
+			if !strings.HasPrefix(jobs.reason, tt.wantFail) {
+				t.Errorf("failed with %q, want %q", jobs.reason, tt.wantFail)
+			}
+			switch {
+			case tt.wantRetry == 0 && jobs.retryAt != nil:
+				t.Errorf("retried at %v, want the job given up on", jobs.retryAt)
+			case tt.wantRetry != 0 && jobs.retryAt == nil:
+				t.Errorf("job given up on, want a retry after %v", tt.wantRetry)
+			case tt.wantRetry != 0 && (jobs.retryAt.Before(start.Add(tt.wantRetry)) || jobs.retryAt.After(time.Now().Add(tt.wantRetry))):
+				t.Errorf("retried at %v, want %v after %v", jobs.retryAt, tt.wantRetry, start)
+			}
+		})
+	}
+}
+
+func TestRunnerDropsOutcomeOfLostLease(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want zapcore.Level
+	}{
+		{name: "lease lost", err: store.ErrLeaseLost, want: zapcore.WarnLevel},
+		{name: "database error", err: errors.New("connection reset"), want: zapcore.ErrorLevel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			r := newTestRunner(&fakeJobs{completeErr: tt.err}, zap.New(core).Sugar())
+
+			r.run(context.Background(), store.Job{ID: 1, Kind: "echo", Args: []byte(`{}`), Attempts: 1, MaxAttempts: 3})
+
+			entries := logs.All()
+			if len(entries) != 1 || entries[0].Level != tt.want {
+				t.Errorf("logged %v, want a single %s", entries, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunnerRunsClaimedJobs(t *testing.T) {
+	jobs := &fakeJobs{pending: []store.Job{
+		{ID: 1, Queue: "default", Kind: "echo", Args: []byte(`{}`), Attempts: 1, MaxAttempts: 3},
+		{ID: 2, Queue: "default", Kind: "echo", Args: []byte(`{}`), Attempts: 1, MaxAttempts: 3},
+		{ID: 3, Queue: "default", Kind: "echo", Args: []byte(`{}`), Attempts: 1, MaxAttempts: 3},
+	}}
+	r := newTestRunner(jobs, zap.NewNop().Sugar())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for jobs.completedCount() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if got := jobs.completedCount(); got != 3 {
+		t.Errorf("completed %d jobs, want 3", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 15 * time.Second},
+		{2, 30 * time.Second},
+		{3, time.Minute},
+		{5, 4 * time.Minute},
+		{10, 128 * time.Minute},
+		{11, 256 * time.Minute},
+		{12, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueues(t *testing.T) {
+	queues, err := ParseQueues("default:10, maintenance:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queues) != 2 || queues["default"] != 10 || queues["maintenance"] != 1 {
+		t.Errorf("ParseQueues = %v", queues)
+	}
+
+	for _, s := range []string{"", "default", ":1", "default:0", "default:x"} {
+		if _, err := ParseQueues(s); err == nil {
+			t.Errorf("ParseQueues(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func newTestRunner(jobs *fakeJobs, logger *zap.SugaredLogger) *Runner {
+	r := NewRunner(store.Storage{Jobs: jobs}, Config{
+		Queues:       map[string]int{"default": 2},
+		PollInterval: time.Millisecond,
+		Lease:        time.Minute,
+		DrainTimeout: time.Second,
+	}, logger)
+
+	Handle(r, echoJob, func(ctx context.Context, args echoArgs) error {
+		if args.Panic {
+			panic("echo")
+		}
+		if args.Err != "" {
+			return errors.New(args.Err)
+		}
+		return nil
+	})
+
+	return r
+}
+
+// fakeJobs hands out the pending jobs once and records their outcomes.
+type fakeJobs struct {
+	jobsStore
+
+	mu          sync.Mutex
+	pending     []store.Job
+	completed   int
+	completeErr error
+	failed      int
+	reason      string
+	retryAt     *time.Time
+}
+
+func (f *fakeJobs) Claim(_ context.Context, _ string, limit int, _ time.Duration) ([]store.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := min(limit, len(f.pending))
+	claimed := f.pending[:n]
+	f.pending = f.pending[n:]
+	return claimed, nil
+}
+
+func (f *fakeJobs) Complete(_ context.Context, _ *store.Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.completed++
+	return f.completeErr
+}
+
+func (f *fakeJobs) Fail(_ context.Context, _ *store.Job, reason string, retryAt *time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failed++
+	f.reason = reason
+	f.retryAt = retryAt
+	return nil
+}
+
+func (f *fakeJobs) completedCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.completed
+}
+
+// jobsStore is the method set of store.Storage.Jobs, the fake only
+// implements what the runner uses.
+type jobsStore = interface {
+	Enqueue(ctx context.Context, job *store.Job) (bool, error)
+	Claim(ctx context.Context, queue string, limit int, lease time.Duration) ([]store.Job, error)
+	Complete(ctx context.Context, job *store.Job) error
+	Fail(ctx context.Context, job *store.Job, reason string, retryAt *time.Time) error
+	DeleteFinished(ctx context.Context, before time.Time) (int64, error)
+}
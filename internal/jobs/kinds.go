@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"context"
+	"time"
+)
+
+type PurgeJobsArgs struct {
+	// OlderThan is how long finished jobs are kept
+	OlderThan time.Duration `json:"older_than"`
+}
+
+// PurgeJobs deletes finished jobs.
+var PurgeJobs = Kind[PurgeJobsArgs]{Name: "purge_jobs", Queue: "maintenance", MaxAttempts: 3}
+
+func (r *Runner) purgeJobs(ctx context.Context, args PurgeJobsArgs) error {
+	count, err := r.store.Jobs.DeleteFinished(ctx, time.Now().Add(-args.OlderThan))
+	if err != nil {
+		return err
+	}
+
+	r.logger.Infow("purged finished jobs", "count", count)
+	return nil
+}
@@ -0,0 +1,118 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// apiTimeout bounds a send, including reading the response, unless ctx
+// ends sooner.
+const apiTimeout = 10 * time.Second
+
+// APIMailer delivers through an HTTP API that takes SendGrid v3 style
+// /mail/send requests.
+type APIMailer struct {
+	url       string
+	apiKey    string
+	fromEmail string
+	client    *http.Client
+}
+
+func NewAPI(url, apiKey, fromEmail string, client *http.Client) *APIMailer {
+	return &APIMailer{
+		url:       url,
+		apiKey:    apiKey,
+		fromEmail: fromEmail,
+		client:    client,
+	}
+}
+
+type apiAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type apiContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type apiPersonalization struct {
+	To []apiAddress `json:"to"`
+}
+
+type apiRequest struct {
+	Personalizations []apiPersonalization `json:"personalizations"`
+	From             apiAddress           `json:"from"`
+	Subject          string               `json:"subject"`
+	Content          []apiContent         `json:"content"`
+	Headers          map[string]string    `json:"headers,omitempty"`
+	MailSettings     struct {
+		SandboxMode struct {
+			Enable bool `json:"enable"`
+		} `json:"sandbox_mode"`
+	} `json:"mail_settings"`
+}
+
+func (m *APIMailer) Send(ctx context.Context, templateFile, locale, username, email string, data any, isSandbox bool) error {
+	msg, err := newMessage(m.fromEmail, templateFile, locale, username, email, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(m.request(msg, isSandbox))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("mail api responded %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+
+	return nil
+}
+
+// request builds the request body. In sandbox mode the API validates the
+// request without delivering it.
+func (m *APIMailer) request(msg *Message, isSandbox bool) apiRequest {
+	var r apiRequest
+	r.Personalizations = []apiPersonalization{
+		{To: []apiAddress{{Email: msg.To, Name: msg.ToName}}},
+	}
+	r.From = apiAddress{Email: msg.From, Name: msg.FromName}
+	r.Subject = msg.Subject
+	r.Content = []apiContent{
+		{Type: "text/plain", Value: msg.Text},
+		{Type: "text/html", Value: msg.HTML},
+	}
+	for _, h := range msg.listHeaders() {
+		if r.Headers == nil {
+			r.Headers = make(map[string]string)
+		}
+		r.Headers[h[0]] = h[1]
+	}
+	r.MailSettings.SandboxMode.Enable = isSandbox
+	return r
+}
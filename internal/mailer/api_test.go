@@ -0,0 +1,139 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIMailerSend(t *testing.T) {
+	tests := []struct {
+		name      string
+		isSandbox bool
+	}{
+		{name: "live", isSandbox: false},
+		{name: "sandbox", isSandbox: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got    apiRequest
+				header http.Header
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header.Clone()
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("decoding request: %v", err)
+				}
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer server.Close()
+
+			m := NewAPI(server.URL, "test-key", "noreply@gophersocial.test", server.Client())
+			err := m.Send(context.Background(), UserWelcomeTemplate, "de", "jörg", "joerg@example.com", struct {
+				Username      string
+				ActivationURL string
+			}{"jörg", "https://gophersocial.test/confirm/token"}, tt.isSandbox)
+			if err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			if auth := header.Get("Authorization"); auth != "Bearer test-key" {
+				t.Errorf("Authorization = %q, want %q", auth, "Bearer test-key")
+			}
+			if ct := header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+
+			if len(got.Personalizations) != 1 || len(got.Personalizations[0].To) != 1 {
+				t.Fatalf("personalizations = %+v, want a single recipient", got.Personalizations)
+			}
+			if to := got.Personalizations[0].To[0]; to != (apiAddress{Email: "joerg@example.com", Name: "jörg"}) {
+				t.Errorf("to = %+v", to)
+			}
+			if got.From != (apiAddress{Email: "noreply@gophersocial.test", Name: FromName}) {
+				t.Errorf("from = %+v", got.From)
+			}
+			if got.Subject != "Aktiviere dein GopherSocial-Konto" {
+				t.Errorf("subject = %q, want the German subject", got.Subject)
+			}
+			if len(got.Content) != 2 || got.Content[0].Type != "text/plain" || got.Content[1].Type != "text/html" {
+				t.Fatalf("content = %+v, want plain text then HTML", got.Content)
+			}
+			if !strings.Contains(got.Content[0].Value, "https://gophersocial.test/confirm/token") {
+				t.Errorf("text part misses the activation url: %q", got.Content[0].Value)
+			}
+			if got.MailSettings.SandboxMode.Enable != tt.isSandbox {
+				t.Errorf("sandbox_mode.enable = %v, want %v", got.MailSettings.SandboxMode.Enable, tt.isSandbox)
+			}
+		})
+	}
+}
+
+func TestAPIMailerSendErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		http.Error(w, `{"errors":[{"message":"invalid api key"}]}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	m := NewAPI(server.URL, "wrong-key", "noreply@gophersocial.test", server.Client())
+	err := m.Send(context.Background(), UserWelcomeTemplate, "en", "gopher", "gopher@example.com", struct {
+		Username      string
+		ActivationURL string
+	}{"gopher", "https://gophersocial.test/confirm/token"}, false)
+	if err == nil {
+		t.Fatal("Send succeeded on a 401 response")
+	}
+	for _, want := range []string{"401", "invalid api key"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestAPIMailerSendGivesUpWithContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	m := NewAPI(server.URL, "test-key", "noreply@gophersocial.test", server.Client())
+	err := m.Send(ctx, UserWelcomeTemplate, "en", "gopher", "gopher@example.com", struct {
+		Username      string
+		ActivationURL string
+	}{"gopher", "https://gophersocial.test/confirm/token"}, false)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send = %v, want it to give up at the deadline of ctx", err)
+	}
+}
+
+func TestAPIMailerRequestListUnsubscribe(t *testing.T) {
+	m := NewAPI("https://mail.test", "test-key", "noreply@gophersocial.test", http.DefaultClient)
+
+	if r := m.request(&Message{}, false); r.Headers != nil {
+		t.Errorf("headers = %v, want none without an unsubscribe URL", r.Headers)
+	}
+
+	r := m.request(&Message{ListUnsubscribe: "https://gophersocial.test/v1/digest/unsubscribe?token=abc"}, false)
+	want := map[string]string{
+		"List-Unsubscribe":      "<https://gophersocial.test/v1/digest/unsubscribe?token=abc>",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+	if !maps.Equal(r.Headers, want) {
+		t.Errorf("headers = %v, want %v", r.Headers, want)
+	}
+}
@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileMailer writes every email to an .eml file instead of sending it, for
+// local development. The files open in any mail client.
+type FileMailer struct {
+	dir       string
+	fromEmail string
+}
+
+func NewFile(dir, fromEmail string) *FileMailer {
+	return &FileMailer{dir: dir, fromEmail: fromEmail}
+}
+
+func (m *FileMailer) Send(ctx context.Context, templateFile, locale, username, email string, data any, isSandbox bool) error {
+	msg, err := newMessage(m.fromEmail, templateFile, locale, username, email, data)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	recipient := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, msg.To)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), recipient)
+
+	// write then rename so watchers never see a partial file
+	tmp, err := os.CreateTemp(m.dir, ".eml-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(msg.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(m.dir, name))
+}
@@ -1,16 +1,49 @@
 package mailer
 
-import "embed"
+import (
+	"context"
+	"embed"
+	"errors"
+	"strings"
+	"time"
+)
 
 const (
 	FromName            = "GopherSocial"
-	maxRetries          = 3
 	UserWelcomeTemplate = "user_invitation.tmpl"
+	DigestTemplate      = "digest.tmpl"
+	// DefaultLocale is the locale of the templates in the root directory
+	DefaultLocale = "en"
 )
 
 //go:embed "templates"
 var FS embed.FS
 
+// Client sends templated emails. In sandbox mode providers that reach real
+// inboxes do not deliver. A send gives up once ctx is done.
 type Client interface {
-	Send(templateFile, username, email string, data any, isSandbox bool) error
+	Send(ctx context.Context, templateFile, locale, username, email string, data any, isSandbox bool) error
+}
+
+// newMessage renders templateFile in locale into a message from fromEmail to
+// email.
+func newMessage(fromEmail, templateFile, locale, username, email string, data any) (*Message, error) {
+	// addresses end up in headers and SMTP commands as they are
+	if strings.ContainsAny(fromEmail+email, "\r\n") {
+		return nil, errors.New("email address contains a line break")
+	}
+
+	msg, err := render(templateFile, locale, data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.FromName = FromName
+	msg.From = fromEmail
+	msg.ToName = username
+	msg.To = email
+	msg.Date = time.Now()
+	msg.MessageID = newMessageID(fromEmail)
+
+	return msg, nil
 }
@@ -1,13 +1,11 @@
 package mailer
 
 import (
-	"bytes"
-	"fmt"
-	"net/smtp"
-	"text/template"
-	"time"
+	"context"
 )
 
+// MailHogMailer delivers to a local MailHog, which never forwards mail, so it
+// delivers in sandbox mode too.
 type MailHogMailer struct {
 	addr      string
 	fromEmail string
@@ -20,52 +18,14 @@ func NewMailhog(addr, fromEmail string) *MailHogMailer {
 	}
 }
 
-func (m *MailHogMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
-
-	// parse and buid templates
-	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
+func (m *MailHogMailer) Send(ctx context.Context, templateFile, locale, username, email string, data any, isSandbox bool) error {
+	msg, err := newMessage(m.fromEmail, templateFile, locale, username, email, data)
 	if err != nil {
 		return err
 	}
 
-	subject := new(bytes.Buffer)
-	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
-		return err
-	}
-
-	body := new(bytes.Buffer)
-	if err := tmpl.ExecuteTemplate(body, "body", data); err != nil {
-		return err
-	}
-
-	// build message
-	msg := []byte(fmt.Sprintf(
-		"From: %s\r\n"+
-			"To: %s\r\n"+
-			"Subject: %s\r\n"+
-			"\r\n%s\r\n",
-		m.fromEmail,
-		email,
-		subject,
-		body,
-	))
-	if isSandbox {
-		fmt.Println("Sandbox mode is enabled")
-		fmt.Println(string(msg))
-		return nil
-	}
-
-	// send
-	var retryError error
-	for i := 0; i < maxRetries; i++ {
-		retryError := smtp.SendMail(m.addr, nil, m.fromEmail, []string{email}, msg)
-		if retryError != nil {
-			time.Sleep(time.Second * time.Duration(i+1))
-			continue
-		}
-		return nil
-	}
-
-	return fmt.Errorf("failed to send email after %d attempts, error: %v", maxRetries, retryError)
-
+	// MailHog speaks plain SMTP without authentication. Failures are retried
+	// by the caller, e.g. the outbox.
+	relay := SMTPMailer{config: SMTPConfig{Addr: m.addr, TLS: TLSNone}}
+	return relay.deliver(ctx, msg)
 }
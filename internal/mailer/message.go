@@ -0,0 +1,110 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is a rendered email.
+type Message struct {
+	FromName  string
+	From      string
+	ToName    string
+	To        string
+	Subject   string
+	Text      string
+	HTML      string
+	Locale    string
+	Date      time.Time
+	MessageID string
+	// ListUnsubscribe is the one-click unsubscribe URL of bulk mail such as
+	// digests, empty for transactional mail.
+	ListUnsubscribe string
+}
+
+// newMessageID returns a unique RFC 5322 message id in the sender's domain.
+func newMessageID(fromEmail string) string {
+	domain := "localhost"
+	if i := strings.LastIndex(fromEmail, "@"); i >= 0 && i < len(fromEmail)-1 {
+		domain = fromEmail[i+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", strings.ToLower(rand.Text()), domain)
+}
+
+// Bytes formats the message as RFC 5322 multipart/alternative for SMTP and
+// .eml files, with a plain text and an HTML part. The output only depends on
+// the message, so the same message always formats the same way.
+func (m *Message) Bytes() []byte {
+	buf := new(bytes.Buffer)
+
+	from := mail.Address{Name: m.FromName, Address: m.From}
+	to := mail.Address{Name: m.ToName, Address: m.To}
+
+	// derived from the message id, so it is stable and never in the content
+	sum := sha256.Sum256([]byte(m.MessageID))
+	boundary := "alt-" + hex.EncodeToString(sum[:12])
+
+	writeHeader(buf, "From", from.String())
+	writeHeader(buf, "To", to.String())
+	writeHeader(buf, "Subject", mime.QEncoding.Encode("UTF-8", m.Subject))
+	writeHeader(buf, "Date", m.Date.Format(time.RFC1123Z))
+	writeHeader(buf, "Message-ID", m.MessageID)
+	if m.Locale != "" {
+		writeHeader(buf, "Content-Language", m.Locale)
+	}
+	for _, h := range m.listHeaders() {
+		writeHeader(buf, h[0], h[1])
+	}
+	writeHeader(buf, "MIME-Version", "1.0")
+	writeHeader(buf, "Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": boundary}))
+	buf.WriteString("\r\n")
+
+	w := multipart.NewWriter(buf)
+	// the boundary is valid, SetBoundary can not fail
+	_ = w.SetBoundary(boundary)
+
+	// clients show the last part they can display, so HTML goes last
+	writePart(w, "text/plain", m.Text)
+	writePart(w, "text/html", m.HTML)
+	w.Close()
+
+	return buf.Bytes()
+}
+
+// listHeaders returns the RFC 8058 one-click unsubscribe headers, receivers
+// unsubscribe by POSTing to the URL.
+func (m *Message) listHeaders() [][2]string {
+	if m.ListUnsubscribe == "" {
+		return nil
+	}
+	return [][2]string{
+		{"List-Unsubscribe", "<" + m.ListUnsubscribe + ">"},
+		{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"},
+	}
+}
+
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	fmt.Fprintf(buf, "%s: %s\r\n", name, value)
+}
+
+func writePart(w *multipart.Writer, contentType, body string) {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"charset": "UTF-8"}))
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	// writes go to a bytes.Buffer and can not fail
+	part, _ := w.CreatePart(header)
+	qp := quotedprintable.NewWriter(part)
+	qp.Write([]byte(body))
+	qp.Close()
+}
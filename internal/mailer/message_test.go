@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+type invitationData struct {
+	Username      string
+	ActivationURL string
+}
+
+// digestPost and digestData mirror digest.Post and digest.Digest, which can
+// not be imported here without a cycle.
+type digestPost struct {
+	Title    string
+	Author   string
+	URL      string
+	Comments string
+}
+
+type digestData struct {
+	Username             string
+	Frequency            string
+	Posts                []digestPost
+	NewFollowers         []string
+	NewFollowersSummary  string
+	NotificationsSummary string
+	FeedURL              string
+	UnsubscribeURL       string
+}
+
+func TestMessageBytesGolden(t *testing.T) {
+	invitation := invitationData{
+		Username:      "jörg",
+		ActivationURL: "https://gophersocial.test/confirm/4f1c2d8e-7b1a-4c55-9a3e-2b7d9c0e6f11",
+	}
+	digest := digestData{
+		Username:  "jörg",
+		Frequency: "weekly",
+		Posts: []digestPost{
+			{Title: "Grüße aus München", Author: "zoë", URL: "https://gophersocial.test/post/42", Comments: "3 comments"},
+		},
+		NewFollowers:         []string{"anaïs", "mia"},
+		NewFollowersSummary:  "2 new followers",
+		NotificationsSummary: "5 unread notifications",
+		FeedURL:              "https://gophersocial.test/feed",
+		UnsubscribeURL:       "https://gophersocial.test/v1/digests/unsubscribe?token=abc",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		locale   string
+		data     any
+	}{
+		{name: "user_invitation.en", template: UserWelcomeTemplate, locale: "en", data: invitation},
+		{name: "user_invitation.de", template: UserWelcomeTemplate, locale: "de", data: invitation},
+		{name: "digest.en", template: DigestTemplate, locale: "en", data: digest},
+		// the German subject is not ASCII and has to be encoded
+		{name: "digest.de", template: DigestTemplate, locale: "de", data: digest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := newMessage("noreply@gophersocial.test", tt.template, tt.locale, "jörg", "joerg@example.com", tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// fixed so the output is reproducible
+			msg.Date = time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+			msg.MessageID = "<golden@gophersocial.test>"
+
+			got := msg.Bytes()
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.MkdirAll("testdata", 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v, run go test -update to create it", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Bytes() differs from %s, run go test -update if the change is intended\ngot:\n%s", golden, got)
+			}
+
+			// every line of the message is 7 bit and CRLF terminated
+			for i, line := range strings.Split(strings.TrimSuffix(string(got), "\r\n"), "\r\n") {
+				if strings.Contains(line, "\n") {
+					t.Errorf("line %d has a bare LF", i+1)
+				}
+				for _, r := range line {
+					if r > 127 {
+						t.Errorf("line %d is not 7 bit: %q", i+1, line)
+						break
+					}
+				}
+			}
+		})
+	}
+}
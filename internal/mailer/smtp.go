@@ -0,0 +1,143 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// TLSStartTLS upgrades the connection and fails when the server can not
+	TLSStartTLS = "starttls"
+	// TLSImplicit connects over TLS, usually on port 465
+	TLSImplicit = "tls"
+	// TLSNone sends in plain text, and refuses to authenticate
+	TLSNone = "none"
+)
+
+type SMTPConfig struct {
+	// Addr is host:port
+	Addr     string
+	Username string
+	Password string
+	TLS      string
+}
+
+// SMTPMailer delivers through an SMTP relay with PLAIN authentication.
+type SMTPMailer struct {
+	config    SMTPConfig
+	fromEmail string
+	logger    *zap.SugaredLogger
+}
+
+func NewSMTP(config SMTPConfig, fromEmail string, logger *zap.SugaredLogger) (*SMTPMailer, error) {
+	switch config.TLS {
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return nil, fmt.Errorf("unknown smtp tls mode %q", config.TLS)
+	}
+
+	if _, _, err := net.SplitHostPort(config.Addr); err != nil {
+		return nil, fmt.Errorf("smtp addr: %w", err)
+	}
+
+	return &SMTPMailer{config: config, fromEmail: fromEmail, logger: logger}, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, templateFile, locale, username, email string, data any, isSandbox bool) error {
+	msg, err := newMessage(m.fromEmail, templateFile, locale, username, email, data)
+	if err != nil {
+		return err
+	}
+
+	if isSandbox {
+		m.logger.Infow("sandbox mode, email not sent", "template", templateFile, "locale", locale)
+		return nil
+	}
+
+	return m.deliver(ctx, msg)
+}
+
+// deliver sends msg within a minute, or before ctx ends when that is sooner.
+func (m *SMTPMailer) deliver(ctx context.Context, msg *Message) error {
+	host, _, _ := net.SplitHostPort(m.config.Addr)
+	tlsConfig := &tls.Config{ServerName: host}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if m.config.TLS == TLSImplicit {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", m.config.Addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", m.config.Addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(time.Minute)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if m.config.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if m.config.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support AUTH")
+		}
+		// PlainAuth refuses to send credentials over an unencrypted connection
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, host)
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(msg.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
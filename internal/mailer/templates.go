@@ -0,0 +1,141 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"golang.org/x/text/language"
+)
+
+// Templates in the root directory are in DefaultLocale, translations live in
+// a directory per locale, such as templates/de/user_invitation.tmpl.
+//
+// A template file defines three blocks: "subject" and "text" render as plain
+// text, "body" renders as HTML with its values escaped. Bulk mail also
+// defines "unsubscribe", its one-click unsubscribe URL.
+type templateSet struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// templates parses every template in FS on first use. LoadTemplates lets
+// callers do that at startup instead.
+var templates = sync.OnceValues(func() (map[string]*templateSet, error) {
+	return parseTemplates(FS, "templates")
+})
+
+// LoadTemplates parses the embedded templates, so a broken template fails at
+// startup instead of on the first send.
+func LoadTemplates() error {
+	_, err := templates()
+	return err
+}
+
+func parseTemplates(fsys fs.FS, root string) (map[string]*templateSet, error) {
+	sets := map[string]*templateSet{}
+
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".tmpl" {
+			return err
+		}
+
+		text, err := texttemplate.ParseFS(fsys, p)
+		if err != nil {
+			return err
+		}
+		html, err := htmltemplate.ParseFS(fsys, p)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range []string{"subject", "text"} {
+			if text.Lookup(name) == nil {
+				return fmt.Errorf("%s: missing %q template", p, name)
+			}
+		}
+		if html.Lookup("body") == nil {
+			return fmt.Errorf("%s: missing %q template", p, "body")
+		}
+
+		sets[strings.TrimPrefix(p, root+"/")] = &templateSet{text: text, html: html}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sets, nil
+}
+
+// lookup finds the template of templateFile in locale, falling back to its
+// parent locales and then to the default template in the root directory.
+func lookup(sets map[string]*templateSet, templateFile, locale string) (*templateSet, string, error) {
+	if tag, err := language.Parse(locale); err == nil {
+		for ; tag != language.Und; tag = tag.Parent() {
+			if set, ok := sets[tag.String()+"/"+templateFile]; ok {
+				return set, tag.String(), nil
+			}
+		}
+	}
+
+	set, ok := sets[templateFile]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown email template %q", templateFile)
+	}
+	return set, DefaultLocale, nil
+}
+
+// render executes the subject, plain text and HTML parts of templateFile in
+// locale.
+func render(templateFile, locale string, data any) (*Message, error) {
+	sets, err := templates()
+	if err != nil {
+		return nil, err
+	}
+
+	set, locale, err := lookup(sets, templateFile, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{Locale: locale}
+
+	buf := new(bytes.Buffer)
+	if err := set.text.ExecuteTemplate(buf, "subject", data); err != nil {
+		return nil, err
+	}
+	// a subject is a single header line
+	msg.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err := set.text.ExecuteTemplate(buf, "text", data); err != nil {
+		return nil, err
+	}
+	msg.Text = strings.TrimSpace(buf.String()) + "\n"
+
+	buf.Reset()
+	if err := set.html.ExecuteTemplate(buf, "body", data); err != nil {
+		return nil, err
+	}
+	msg.HTML = buf.String()
+
+	if set.text.Lookup("unsubscribe") != nil {
+		buf.Reset()
+		if err := set.text.ExecuteTemplate(buf, "unsubscribe", data); err != nil {
+			return nil, err
+		}
+		// the URL ends up in a header as it is
+		msg.ListUnsubscribe = strings.TrimSpace(buf.String())
+		if strings.ContainsAny(msg.ListUnsubscribe, "\r\n<>") {
+			return nil, fmt.Errorf("%s: unsubscribe URL %q does not fit in a header", templateFile, msg.ListUnsubscribe)
+		}
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,52 @@
+package notifications
+
+import (
+	"context"
+
+	"github.com/MohammadTaghipour/social/internal/jobs"
+	"github.com/MohammadTaghipour/social/internal/store"
+)
+
+// FollowArgs is UserID starting to follow FollowedID.
+type FollowArgs struct {
+	UserID     int64 `json:"user_id"`
+	FollowedID int64 `json:"followed_id"`
+}
+
+type PostArgs struct {
+	Post store.Post `json:"post"`
+}
+
+// ReactionArgs is UserID reacting to Post.
+type ReactionArgs struct {
+	Post   store.Post `json:"post"`
+	UserID int64      `json:"user_id"`
+}
+
+type CommentArgs struct {
+	Post    store.Post    `json:"post"`
+	Comment store.Comment `json:"comment"`
+}
+
+var (
+	FollowedJob       = jobs.Kind[FollowArgs]{Name: "notify_followed", Queue: "default", MaxAttempts: 3}
+	PostCreatedJob    = jobs.Kind[PostArgs]{Name: "notify_post_created", Queue: "default", MaxAttempts: 3}
+	PostReactedJob    = jobs.Kind[ReactionArgs]{Name: "notify_post_reacted", Queue: "default", MaxAttempts: 3}
+	CommentCreatedJob = jobs.Kind[CommentArgs]{Name: "notify_comment_created", Queue: "default", MaxAttempts: 3}
+)
+
+// RegisterJobs adds the handlers of the notification jobs to r.
+func RegisterJobs(r *jobs.Runner, s *Service) {
+	jobs.Handle(r, FollowedJob, func(ctx context.Context, args FollowArgs) error {
+		return s.Followed(ctx, args.UserID, args.FollowedID)
+	})
+	jobs.Handle(r, PostCreatedJob, func(ctx context.Context, args PostArgs) error {
+		return s.PostCreated(ctx, &args.Post)
+	})
+	jobs.Handle(r, PostReactedJob, func(ctx context.Context, args ReactionArgs) error {
+		return s.PostReacted(ctx, &args.Post, args.UserID)
+	})
+	jobs.Handle(r, CommentCreatedJob, func(ctx context.Context, args CommentArgs) error {
+		return s.CommentCreated(ctx, &args.Post, &args.Comment)
+	})
+}
@@ -0,0 +1,202 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+	"github.com/MohammadTaghipour/social/internal/stream"
+)
+
+// maxMentions caps the users notified by a single post or comment.
+const maxMentions = 10
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w+)`)
+
+// Publisher pushes new notifications to their recipients while they are
+// connected.
+type Publisher interface {
+	PublishToUser(ctx context.Context, userID int64, typ string, data any) error
+}
+
+// Service turns user activity into notifications for the users it concerns.
+type Service struct {
+	store     store.Storage
+	publisher Publisher
+}
+
+// New creates a Service. publisher may be nil when nothing is streamed.
+func New(store store.Storage, publisher Publisher) *Service {
+	return &Service{store: store, publisher: publisher}
+}
+
+func (s *Service) Followed(ctx context.Context, followerID, followedID int64) error {
+	return s.create(ctx, &store.Notification{
+		UserID:  followedID,
+		ActorID: followerID,
+		Type:    store.NotificationFollow,
+	})
+}
+
+// CommentCreated notifies the post author, the author of the comment replied
+// to and everyone mentioned in it. Each of them is notified once, a post
+// author mentioned in a comment only gets the comment notification.
+func (s *Service) CommentCreated(ctx context.Context, post *store.Post, comment *store.Comment) error {
+	notified := make(map[int64]bool)
+	notify := func(userID int64, typ string) error {
+		if notified[userID] {
+			return nil
+		}
+		notified[userID] = true
+
+		return s.create(ctx, &store.Notification{
+			UserID:    userID,
+			ActorID:   comment.UserID,
+			Type:      typ,
+			PostID:    &post.ID,
+			CommentID: &comment.ID,
+		})
+	}
+
+	if err := notify(post.UserID, store.NotificationComment); err != nil {
+		return err
+	}
+
+	if comment.ParentID != nil {
+		parent, err := s.store.Comments.GetByID(ctx, *comment.ParentID)
+		if err != nil {
+			return err
+		}
+		if err := notify(parent.UserID, store.NotificationReply); err != nil {
+			return err
+		}
+	}
+
+	return s.mentions(ctx, comment.Content, func(userID int64) error {
+		return notify(userID, store.NotificationMention)
+	})
+}
+
+// PostCreated notifies everyone mentioned in a new post.
+func (s *Service) PostCreated(ctx context.Context, post *store.Post) error {
+	return s.mentions(ctx, post.Title+"\n"+post.Content, func(userID int64) error {
+		return s.create(ctx, &store.Notification{
+			UserID:  userID,
+			ActorID: post.UserID,
+			Type:    store.NotificationMention,
+			PostID:  &post.ID,
+		})
+	})
+}
+
+func (s *Service) PostReacted(ctx context.Context, post *store.Post, userID int64) error {
+	return s.create(ctx, &store.Notification{
+		UserID:  post.UserID,
+		ActorID: userID,
+		Type:    store.NotificationReaction,
+		PostID:  &post.ID,
+	})
+}
+
+// create stores n and publishes it unless it was filtered out.
+func (s *Service) create(ctx context.Context, n *store.Notification) error {
+	if err := s.store.Notifications.Create(ctx, n); err != nil {
+		return err
+	}
+
+	if n.ID == 0 || s.publisher == nil {
+		return nil
+	}
+
+	return s.publisher.PublishToUser(ctx, n.UserID, stream.EventNotification, n)
+}
+
+// List returns a page of grouped notifications with their messages.
+func (s *Service) List(ctx context.Context, userID int64, nq store.PaginatedNotificationsQuery) ([]store.NotificationGroup, error) {
+	groups, err := s.store.Notifications.GetGroups(ctx, userID, nq)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range groups {
+		groups[i].Message = Message(groups[i])
+	}
+
+	return groups, nil
+}
+
+// mentions calls notify with every existing user mentioned in text.
+func (s *Service) mentions(ctx context.Context, text string, notify func(userID int64) error) error {
+	var seen []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		username := match[1]
+		if len(seen) == maxMentions {
+			break
+		}
+		if containsFold(seen, username) {
+			continue
+		}
+		seen = append(seen, username)
+
+		user, err := s.store.Users.GetByUsername(ctx, username)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := notify(user.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Message describes a notification group, e.g. "alice and 2 others
+// commented on your post".
+func Message(g store.NotificationGroup) string {
+	var action string
+	switch g.Type {
+	case store.NotificationFollow:
+		action = "followed you"
+	case store.NotificationComment:
+		action = "commented on your post"
+	case store.NotificationReply:
+		action = "replied to your comment"
+	case store.NotificationMention:
+		action = "mentioned you"
+	case store.NotificationReaction:
+		action = "reacted to your post"
+	default:
+		action = g.Type
+	}
+
+	return actors(g) + " " + action
+}
+
+func actors(g store.NotificationGroup) string {
+	names := g.Actors
+	switch {
+	case len(names) == 0:
+		return "Someone"
+	case g.ActorCount == 1:
+		return names[0]
+	case g.ActorCount == 2 && len(names) == 2:
+		return names[0] + " and " + names[1]
+	default:
+		return fmt.Sprintf("%s and %d others", names[0], g.ActorCount-1)
+	}
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
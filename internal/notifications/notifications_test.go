@@ -0,0 +1,183 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+)
+
+func TestMessage(t *testing.T) {
+	tests := []struct {
+		group store.NotificationGroup
+		want  string
+	}{
+		{
+			group: store.NotificationGroup{Type: store.NotificationFollow, Actors: []string{"alice"}, ActorCount: 1},
+			want:  "alice followed you",
+		},
+		{
+			group: store.NotificationGroup{Type: store.NotificationComment, Actors: []string{"alice", "bob"}, ActorCount: 2},
+			want:  "alice and bob commented on your post",
+		},
+		{
+			group: store.NotificationGroup{Type: store.NotificationReaction, Actors: []string{"carol", "alice", "bob"}, ActorCount: 3},
+			want:  "carol and 2 others reacted to your post",
+		},
+		{
+			// the same actor twice is still one actor
+			group: store.NotificationGroup{Type: store.NotificationReply, Actors: []string{"alice"}, ActorCount: 1, Count: 2},
+			want:  "alice replied to your comment",
+		},
+		{
+			group: store.NotificationGroup{Type: store.NotificationMention},
+			want:  "Someone mentioned you",
+		},
+		{
+			group: store.NotificationGroup{Type: "poke", Actors: []string{"alice"}, ActorCount: 1},
+			want:  "alice poke",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := Message(tt.group); got != tt.want {
+			t.Errorf("Message(%+v) = %q, want %q", tt.group, got, tt.want)
+		}
+	}
+}
+
+func TestCommentCreatedNotifiesEachUserOnce(t *testing.T) {
+	users := fakeUsers{ids: map[string]int64{"alice": 1, "bob": 2, "carol": 3, "dave": 4}}
+	parentID := int64(20)
+
+	tests := []struct {
+		name     string
+		parentID *int64
+		content  string
+		want     []string
+	}{
+		{
+			name:    "post author mentioned",
+			content: "@alice @carol have a look",
+			want:    []string{"1:comment", "3:mention"},
+		},
+		{
+			name:     "reply to a mentioned user",
+			parentID: &parentID,
+			content:  "@bob @Bob agreed",
+			want:     []string{"1:comment", "2:reply"},
+		},
+		{
+			name:    "unknown and self mentions",
+			content: "@nobody @dave",
+			want:    []string{"1:comment"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifications := &fakeNotifications{}
+			s := New(store.Storage{
+				Notifications: notifications,
+				Users:         users,
+				Comments:      fakeComments{comments: map[int64]store.Comment{20: {ID: 20, UserID: 2}}},
+			}, nil)
+
+			post := &store.Post{ID: 10, UserID: 1}
+			comment := &store.Comment{ID: 30, PostID: 10, UserID: 4, ParentID: tt.parentID, Content: tt.content}
+			if err := s.CommentCreated(context.Background(), post, comment); err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(notifications.created, tt.want) {
+				t.Errorf("notified %v, want %v", notifications.created, tt.want)
+			}
+		})
+	}
+}
+
+// fakeNotifications records the notifications created as "user:type",
+// leaving out the actor's own like the store does.
+type fakeNotifications struct {
+	notificationsStore
+	created []string
+}
+
+func (f *fakeNotifications) Create(_ context.Context, n *store.Notification) error {
+	if n.UserID == n.ActorID {
+		return nil
+	}
+	f.created = append(f.created, fmt.Sprintf("%d:%s", n.UserID, n.Type))
+	return nil
+}
+
+// fakeUsers maps usernames to ids.
+type fakeUsers struct {
+	usersStore
+	ids map[string]int64
+}
+
+func (f fakeUsers) GetByUsername(_ context.Context, username string) (*store.User, error) {
+	id, ok := f.ids[username]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &store.User{ID: id, Username: username}, nil
+}
+
+type fakeComments struct {
+	commentsStore
+	comments map[int64]store.Comment
+}
+
+func (f fakeComments) GetByID(_ context.Context, commentID int64) (*store.Comment, error) {
+	c, ok := f.comments[commentID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &c, nil
+}
+
+// notificationsStore, usersStore and commentsStore are the method sets of
+// the store.Storage fields, the fakes only implement what the service uses.
+type notificationsStore = interface {
+	Create(ctx context.Context, n *store.Notification) error
+	GetGroups(ctx context.Context, userID int64, nq store.PaginatedNotificationsQuery) ([]store.NotificationGroup, error)
+	CountUnread(ctx context.Context, userID int64) (int, error)
+	MarkGroupRead(ctx context.Context, userID, notificationID int64) error
+	MarkAllRead(ctx context.Context, userID int64) error
+	GetPreferences(ctx context.Context, userID int64) (map[string]bool, error)
+	SetPreferences(ctx context.Context, userID int64, prefs map[string]bool) error
+}
+
+type usersStore = interface {
+	Create(ctx context.Context, tx *sql.Tx, user *store.User) error
+	CreateAndInvite(ctx context.Context, user *store.User, token string, invitationsExpDate time.Duration, invite *store.OutboxMessage) error
+	GetByID(ctx context.Context, userID int64) (*store.User, error)
+	GetByEmail(ctx context.Context, email string) (*store.User, error)
+	GetByUsername(ctx context.Context, username string) (*store.User, error)
+	Activate(ctx context.Context, token string) (*store.User, error)
+	SetLocale(ctx context.Context, userID int64, locale string) error
+	RecordLogin(ctx context.Context, userID int64) error
+	Delete(ctx context.Context, userID int64) error
+	Search(ctx context.Context, viewerID int64, sq store.PaginatedSearchQuery) ([]store.UserCard, error)
+	DeleteExpiredInvitations(ctx context.Context) (int64, error)
+}
+
+type commentsStore = interface {
+	Create(ctx context.Context, comment *store.Comment) error
+	GetByID(ctx context.Context, commentID int64) (*store.Comment, error)
+	GetByPostID(ctx context.Context, postID int64, limit int) ([]store.Comment, error)
+	GetPage(ctx context.Context, postID int64, pq store.PaginatedCommentsQuery) (*store.CommentsPage, error)
+	GetReplies(ctx context.Context, commentID int64, pq store.PaginatedCommentsQuery) (*store.CommentsPage, error)
+	CountTopLevel(ctx context.Context, postID int64) (int, error)
+	CountReplies(ctx context.Context, commentID int64) (int, error)
+	React(ctx context.Context, commentID, userID int64, reaction string) error
+	Unreact(ctx context.Context, commentID, userID int64) error
+	Update(ctx context.Context, comment *store.Comment) error
+	Delete(ctx context.Context, commentID int64) error
+}
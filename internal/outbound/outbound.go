@@ -0,0 +1,131 @@
+// Package outbound builds the http client for requests to urls picked by
+// users or remote servers, such as webhooks and federated inboxes. Those must
+// not reach the network the api runs in.
+package outbound
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInsecureURL        = errors.New("url must use https")
+	ErrForbiddenAddress   = errors.New("address is not public")
+	sharedAddressSpace    = netip.MustParsePrefix("100.64.0.0/10")
+	benchmarkAddressSpace = netip.MustParsePrefix("198.18.0.0/15")
+)
+
+type Config struct {
+	Timeout time.Duration
+	// AllowPrivate lets requests use plain http and reach private and
+	// loopback addresses, for running against local services in dev.
+	AllowPrivate bool
+}
+
+// NewClient returns a client that only speaks https and refuses to connect to
+// addresses that are not public. The address is checked when dialing, after
+// name resolution, so a public name resolving to a private address is refused
+// as well, including on redirects.
+func NewClient(config Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !config.AllowPrivate {
+		dialer.Control = control
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   config.Timeout,
+		Transport: &schemeTransport{next: transport, allowHTTP: config.AllowPrivate},
+	}
+}
+
+// CheckURL reports whether rawURL can be requested through a client built
+// with config, so invalid targets are rejected when they are configured
+// rather than on every request.
+func CheckURL(rawURL string, config Config) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("url %q has no host", rawURL)
+	}
+	if err := checkScheme(u, config.AllowPrivate); err != nil {
+		return err
+	}
+	if config.AllowPrivate {
+		return nil
+	}
+
+	if u.Hostname() == "localhost" {
+		return ErrForbiddenAddress
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !IsPublic(addr) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// IsPublic reports whether addr is a globally routable unicast address.
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!sharedAddressSpace.Contains(addr) &&
+		!benchmarkAddressSpace.Contains(addr)
+}
+
+// control runs before every connection, with the resolved address.
+func control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !IsPublic(addr) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+	}
+	return nil
+}
+
+// schemeTransport refuses plain http, redirects included.
+type schemeTransport struct {
+	next      http.RoundTripper
+	allowHTTP bool
+}
+
+func (t *schemeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := checkScheme(req.URL, t.allowHTTP); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+func checkScheme(u *url.URL, allowHTTP bool) error {
+	switch {
+	case u.Scheme == "https":
+		return nil
+	case u.Scheme == "http" && allowHTTP:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrInsecureURL, u.Redacted())
+	}
+}
@@ -0,0 +1,94 @@
+package outbound
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		wantErr      error
+	}{
+		{url: "https://hooks.example.com/receive"},
+		{url: "https://93.184.215.14/receive"},
+		{url: "http://hooks.example.com/receive", wantErr: ErrInsecureURL},
+		{url: "ftp://hooks.example.com/receive", wantErr: ErrInsecureURL},
+		{url: "https://localhost/receive", wantErr: ErrForbiddenAddress},
+		{url: "https://127.0.0.1/receive", wantErr: ErrForbiddenAddress},
+		{url: "https://10.0.0.8/receive", wantErr: ErrForbiddenAddress},
+		{url: "https://192.168.1.1/receive", wantErr: ErrForbiddenAddress},
+		{url: "https://169.254.169.254/latest/meta-data", wantErr: ErrForbiddenAddress},
+		{url: "https://[::1]/receive", wantErr: ErrForbiddenAddress},
+		{url: "https://[fe80::1]/receive", wantErr: ErrForbiddenAddress},
+		{url: "https://[::ffff:127.0.0.1]/receive", wantErr: ErrForbiddenAddress},
+		{url: "http://localhost:8080/receive", allowPrivate: true},
+		{url: "ftp://localhost/receive", allowPrivate: true, wantErr: ErrInsecureURL},
+	}
+
+	for _, tt := range tests {
+		err := CheckURL(tt.url, Config{AllowPrivate: tt.allowPrivate})
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("CheckURL(%q, allowPrivate=%v) = %v, want %v", tt.url, tt.allowPrivate, err, tt.wantErr)
+		}
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsPublic(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("IsPublic(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestClientRefusesPrivateTargets(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// the address is checked when dialing, whatever the url says
+	client := NewClient(Config{Timeout: 5 * time.Second})
+	client.Transport.(*schemeTransport).next.(*http.Transport).TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+
+	_, err := client.Get(server.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("Get %s error = %v, want ErrForbiddenAddress", server.URL, err)
+	}
+
+	_, err = client.Get("http://" + server.Listener.Addr().String())
+	if !errors.Is(err, ErrInsecureURL) {
+		t.Errorf("plain http error = %v, want ErrInsecureURL", err)
+	}
+
+	// dev talks to local services
+	dev := NewClient(Config{Timeout: 5 * time.Second, AllowPrivate: true})
+	dev.Transport.(*schemeTransport).next.(*http.Transport).TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	resp, err := dev.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get with AllowPrivate: %v", err)
+	}
+	resp.Body.Close()
+}
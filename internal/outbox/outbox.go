@@ -0,0 +1,170 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/mailer"
+	"github.com/MohammadTaghipour/social/internal/store"
+	"go.uber.org/zap"
+)
+
+const TopicEmail = "email"
+
+type Config struct {
+	PollInterval time.Duration
+	MaxAttempts  int
+	Enabled      bool
+}
+
+// Handler processes the payload of a message. Messages are delivered at least
+// once, so handlers must tolerate seeing a message again.
+type Handler func(ctx context.Context, msg store.OutboxMessage) error
+
+// NewMessage builds a message for topic. Messages with the same key are
+// queued once.
+func NewMessage(topic, key string, payload any) (*store.OutboxMessage, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.OutboxMessage{Topic: topic, Key: key, Payload: data}, nil
+}
+
+// Dispatcher hands queued messages to the handler of their topic, retrying
+// failures with exponential backoff until they become dead letters.
+type Dispatcher struct {
+	store    store.Storage
+	config   Config
+	logger   *zap.SugaredLogger
+	handlers map[string]Handler
+}
+
+func New(store store.Storage, config Config, logger *zap.SugaredLogger) *Dispatcher {
+	return &Dispatcher{
+		store:    store,
+		config:   config,
+		logger:   logger,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Handle registers the handler of topic. It must be called before Run.
+func (d *Dispatcher) Handle(topic string, h Handler) {
+	d.handlers[topic] = h
+}
+
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Dispatch(ctx); err != nil {
+			d.logger.Errorw("error dispatching outbox", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch processes the due messages.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	messages, err := d.store.Outbox.Claim(ctx, 50, time.Minute*5)
+	if err != nil {
+		return err
+	}
+
+	// on shutdown the message in progress finishes, the rest are claimed
+	// again once their lease expires
+	stop := ctx
+	ctx = context.WithoutCancel(ctx)
+
+	for _, msg := range messages {
+		if stop.Err() != nil {
+			return nil
+		}
+
+		if err := d.process(ctx, msg); err != nil {
+			var retryAt *time.Time
+			if msg.Attempts < d.config.MaxAttempts {
+				next := time.Now().Add(backoff(msg.Attempts))
+				retryAt = &next
+			}
+
+			if retryAt == nil {
+				d.logger.Errorw("outbox message is dead", "topic", msg.Topic, "key", msg.Key, "error", err.Error())
+			} else {
+				d.logger.Warnw("outbox message failed", "topic", msg.Topic, "key", msg.Key, "attempt", msg.Attempts, "error", err.Error())
+			}
+
+			if err := d.store.Outbox.MarkFailed(ctx, msg.ID, err.Error(), retryAt); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := d.store.Outbox.MarkProcessed(ctx, msg.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) process(ctx context.Context, msg store.OutboxMessage) error {
+	h, ok := d.handlers[msg.Topic]
+	if !ok {
+		return fmt.Errorf("no handler for topic %q", msg.Topic)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	return h(ctx, msg)
+}
+
+// Email is the payload of TopicEmail messages.
+type Email struct {
+	Template string `json:"template"`
+	Locale   string `json:"locale"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Data     any    `json:"data"`
+}
+
+// NewEmail builds a message sending template in locale to a user.
+func NewEmail(key, template, locale, username, email string, data any) (*store.OutboxMessage, error) {
+	return NewMessage(TopicEmail, key, Email{
+		Template: template,
+		Locale:   locale,
+		Username: username,
+		Email:    email,
+		Data:     data,
+	})
+}
+
+// SendEmail returns the handler of TopicEmail messages.
+func SendEmail(client mailer.Client, isSandbox bool) Handler {
+	return func(ctx context.Context, msg store.OutboxMessage) error {
+		var email Email
+		if err := json.Unmarshal(msg.Payload, &email); err != nil {
+			return err
+		}
+
+		return client.Send(ctx, email.Template, email.Locale, email.Username, email.Email, email.Data, isSandbox)
+	}
+}
+
+// backoff doubles the wait after every attempt, starting at 30 seconds and
+// capped at 6 hours.
+func backoff(attempts int) time.Duration {
+	wait := time.Second * 30 << min(attempts-1, 10)
+	return min(wait, time.Hour*6)
+}
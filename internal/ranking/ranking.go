@@ -0,0 +1,58 @@
+package ranking
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+)
+
+type Config struct {
+	Weights         Weights
+	RefreshInterval time.Duration
+	// FullRefreshInterval is how often every score is recomputed, so that
+	// removed reactions, reposts and comments and interactions leaving the
+	// affinity window lower scores too.
+	FullRefreshInterval time.Duration
+	// AffinityWindow is how far back interactions count towards affinity
+	AffinityWindow time.Duration
+	Enabled        bool
+}
+
+func (c Config) validate() error {
+	if c.Weights.Decay <= 0 {
+		return errors.New("ranking decay must be positive")
+	}
+	if c.RefreshInterval <= 0 || c.FullRefreshInterval <= 0 {
+		return errors.New("ranking refresh intervals must be positive")
+	}
+	return nil
+}
+
+type Weights struct {
+	Comments  float64
+	Reactions float64
+	Reposts   float64
+	Affinity  float64
+	// Decay is how much newer a post has to be to match one with ten times
+	// its engagement.
+	Decay time.Duration
+}
+
+// PostScore ranks a post by its weighted engagement on a log scale plus its
+// age. Because the time part only depends on the creation date, scores never
+// have to be recomputed just because time passed.
+func PostScore(e store.PostEngagement, w Weights) float64 {
+	engagement := w.Comments*float64(e.Comments) +
+		w.Reactions*float64(e.Reactions) +
+		w.Reposts*float64(e.Reposts)
+
+	return math.Log10(1+engagement) + float64(e.CreatedAt.Unix())/w.Decay.Seconds()
+}
+
+// AffinityScore is the boost a user's posts get in the top feed of someone
+// who interacted with them.
+func AffinityScore(a store.Affinity, w Weights) float64 {
+	return w.Affinity * math.Log10(1+float64(a.Interactions))
+}
@@ -0,0 +1,199 @@
+package ranking
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+	"go.uber.org/zap"
+)
+
+var testWeights = Weights{
+	Comments:  2,
+	Reactions: 1,
+	Reposts:   3,
+	Affinity:  1,
+	Decay:     time.Hour * 12,
+}
+
+func TestPostScoreOrder(t *testing.T) {
+	base := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		higher, lower store.PostEngagement
+	}{
+		{
+			name:   "more engagement at the same age",
+			higher: store.PostEngagement{CreatedAt: base, Reactions: 10},
+			lower:  store.PostEngagement{CreatedAt: base, Reactions: 9},
+		},
+		{
+			name:   "newer at the same engagement",
+			higher: store.PostEngagement{CreatedAt: base.Add(time.Minute), Comments: 3},
+			lower:  store.PostEngagement{CreatedAt: base, Comments: 3},
+		},
+		{
+			name:   "reposts weigh more than comments",
+			higher: store.PostEngagement{CreatedAt: base, Reposts: 1},
+			lower:  store.PostEngagement{CreatedAt: base, Comments: 1},
+		},
+		{
+			name:   "comments weigh more than reactions",
+			higher: store.PostEngagement{CreatedAt: base, Comments: 1},
+			lower:  store.PostEngagement{CreatedAt: base, Reactions: 1},
+		},
+		{
+			name:   "a decay newer beats less than tenfold engagement",
+			higher: store.PostEngagement{CreatedAt: base.Add(testWeights.Decay)},
+			lower:  store.PostEngagement{CreatedAt: base, Reactions: 8},
+		},
+		{
+			name:   "tenfold engagement beats a post less than a decay newer",
+			higher: store.PostEngagement{CreatedAt: base, Reactions: 99},
+			lower:  store.PostEngagement{CreatedAt: base.Add(testWeights.Decay - time.Hour)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			higher, lower := PostScore(tt.higher, testWeights), PostScore(tt.lower, testWeights)
+			if higher <= lower {
+				t.Errorf("score %v <= %v, want the first post ranked higher", higher, lower)
+			}
+		})
+	}
+}
+
+func TestPostScoreWithoutEngagementIsAge(t *testing.T) {
+	// the feed scores posts the scorer has not reached yet by their age
+	created := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	got := PostScore(store.PostEngagement{CreatedAt: created}, testWeights)
+	want := float64(created.Unix()) / testWeights.Decay.Seconds()
+	if got != want {
+		t.Errorf("PostScore = %v, want %v", got, want)
+	}
+}
+
+func TestAffinityScore(t *testing.T) {
+	tests := []struct {
+		interactions int
+		want         float64
+	}{
+		{0, 0},
+		{9, 1},
+		{99, 2},
+	}
+
+	for _, tt := range tests {
+		got := AffinityScore(store.Affinity{Interactions: tt.interactions}, testWeights)
+		if got != tt.want {
+			t.Errorf("AffinityScore(%d) = %v, want %v", tt.interactions, got, tt.want)
+		}
+	}
+}
+
+func TestNewScorerValidatesConfig(t *testing.T) {
+	valid := Config{Weights: testWeights, RefreshInterval: time.Minute, FullRefreshInterval: time.Hour}
+
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(*Config) {}},
+		{name: "zero decay", modify: func(c *Config) { c.Weights.Decay = 0 }, wantErr: true},
+		{name: "negative decay", modify: func(c *Config) { c.Weights.Decay = -time.Hour }, wantErr: true},
+		{name: "zero refresh", modify: func(c *Config) { c.RefreshInterval = 0 }, wantErr: true},
+		{name: "zero full refresh", modify: func(c *Config) { c.FullRefreshInterval = 0 }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.modify(&config)
+			_, err := NewScorer(store.Storage{}, config, zap.NewNop().Sugar())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewScorer error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+type fakeRanking struct {
+	since  []time.Time
+	posts  []store.PostEngagement
+	scores map[int64]float64
+}
+
+func (f *fakeRanking) GetPostEngagement(_ context.Context, since time.Time) ([]store.PostEngagement, error) {
+	f.since = append(f.since, since)
+	return slices.Clone(f.posts), nil
+}
+
+func (f *fakeRanking) SavePostScores(_ context.Context, posts []store.PostEngagement) error {
+	for _, p := range posts {
+		f.scores[p.PostID] = p.Score
+	}
+	return nil
+}
+
+func (f *fakeRanking) GetAffinities(context.Context, time.Time, time.Duration) ([]store.Affinity, error) {
+	return nil, nil
+}
+
+func (f *fakeRanking) SaveAffinities(context.Context, []store.Affinity) error {
+	return nil
+}
+
+func TestScorerRefresh(t *testing.T) {
+	created := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	fake := &fakeRanking{
+		posts:  []store.PostEngagement{{PostID: 1, CreatedAt: created, Reactions: 4}},
+		scores: map[int64]float64{},
+	}
+
+	scorer, err := NewScorer(store.Storage{Ranking: fake}, Config{
+		Weights:             testWeights,
+		RefreshInterval:     time.Minute,
+		FullRefreshInterval: time.Hour,
+	}, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for range 2 {
+		if err := scorer.Refresh(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := PostScore(fake.posts[0], testWeights); fake.scores[1] != want {
+		t.Errorf("saved score = %v, want %v", fake.scores[1], want)
+	}
+
+	// the first run recomputes everything, the next one what was added since
+	if !fake.since[0].IsZero() {
+		t.Errorf("first refresh since %v, want everything", fake.since[0])
+	}
+	if fake.since[1].IsZero() {
+		t.Error("second refresh recomputed everything, want only what was added")
+	}
+
+	// once FullRefreshInterval passed everything is recomputed again, so
+	// removed engagement lowers the score
+	scorer.lastFull = scorer.lastFull.Add(-time.Hour)
+	fake.posts[0].Reactions = 0
+	if err := scorer.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !fake.since[2].IsZero() {
+		t.Errorf("refresh after the full interval since %v, want everything", fake.since[2])
+	}
+	if want := PostScore(fake.posts[0], testWeights); fake.scores[1] != want {
+		t.Errorf("score after removing reactions = %v, want %v", fake.scores[1], want)
+	}
+}
@@ -0,0 +1,94 @@
+package ranking
+
+import (
+	"context"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// Scorer keeps post scores and user affinities up to date in the background.
+// Most runs only recompute what was added since the previous one, and every
+// FullRefreshInterval a run recomputes everything.
+type Scorer struct {
+	store    store.Storage
+	config   Config
+	logger   *zap.SugaredLogger
+	lastRun  time.Time
+	lastFull time.Time
+}
+
+func NewScorer(store store.Storage, config Config, logger *zap.SugaredLogger) (*Scorer, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	return &Scorer{
+		store:  store,
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+// Run refreshes the scores every RefreshInterval until ctx is done.
+func (s *Scorer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		// a refresh in progress finishes on shutdown
+		if err := s.Refresh(context.WithoutCancel(ctx)); err != nil {
+			s.logger.Errorw("error refreshing ranking scores", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scorer) Refresh(ctx context.Context) error {
+	// read the clock first so activity during the run is picked up next time
+	startedAt := time.Now()
+
+	// removals leave nothing to find by time, so they are only picked up by
+	// recomputing everything
+	since := s.lastRun
+	full := startedAt.Sub(s.lastFull) >= s.config.FullRefreshInterval
+	if full {
+		since = time.Time{}
+	}
+
+	posts, err := s.store.Ranking.GetPostEngagement(ctx, since)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Score = PostScore(posts[i], s.config.Weights)
+	}
+	if err := s.store.Ranking.SavePostScores(ctx, posts); err != nil {
+		return err
+	}
+
+	affinities, err := s.store.Ranking.GetAffinities(ctx, since, s.config.AffinityWindow)
+	if err != nil {
+		return err
+	}
+	for i := range affinities {
+		affinities[i].Score = AffinityScore(affinities[i], s.config.Weights)
+	}
+	if err := s.store.Ranking.SaveAffinities(ctx, affinities); err != nil {
+		return err
+	}
+
+	s.lastRun = startedAt
+	if full {
+		s.lastFull = startedAt
+	}
+	s.logger.Infow("ranking scores refreshed", "full", full, "posts", len(posts), "affinities", len(affinities))
+
+	return nil
+}
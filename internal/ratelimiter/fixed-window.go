@@ -5,41 +5,79 @@ import (
 	"time"
 )
 
+// FixedWindowRateLimiter counts requests per key in process, in windows that
+// start with the key's first request.
 type FixedWindowRateLimiter struct {
-	sync.RWMutex
-	clients map[string]int
-	limit   int
-	window  time.Duration
+	mu        sync.Mutex
+	clients   map[string]*fixedWindow
+	limit     int
+	window    time.Duration
+	lastSweep time.Time
+}
+
+type fixedWindow struct {
+	start time.Time
+	count int
 }
 
 func NewFixedWindowRateLimiter(limit int, window time.Duration) *FixedWindowRateLimiter {
 	return &FixedWindowRateLimiter{
-		clients: make(map[string]int),
+		clients: make(map[string]*fixedWindow),
 		limit:   limit,
 		window:  window,
 	}
 }
 
-func (rl *FixedWindowRateLimiter) Allow(ip string) (bool, time.Duration) {
-	rl.RLock()
-	count, exists := rl.clients[ip]
-	rl.RUnlock()
+func (rl *FixedWindowRateLimiter) Allow(key string) Result {
+	return rl.check(key, true)
+}
+
+func (rl *FixedWindowRateLimiter) Peek(key string) Result {
+	return rl.check(key, false)
+}
+
+func (rl *FixedWindowRateLimiter) check(key string, count bool) Result {
+	now := time.Now()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
 
-	if !exists || count < rl.limit {
-		rl.Lock()
-		if !exists {
-			go rl.resetCount(ip)
+	w, ok := rl.clients[key]
+	if !ok || now.Sub(w.start) >= rl.window {
+		w = &fixedWindow{start: now}
+		if count {
+			rl.clients[key] = w
 		}
-		rl.clients[ip]++
-		rl.Unlock()
-		return true, 0
+	}
 
+	res := Result{Allowed: w.count < rl.limit, Limit: rl.limit}
+	if res.Allowed && count {
+		w.count++
+	}
+	if w.count > 0 {
+		res.Reset = w.start.Add(rl.window).Sub(now)
 	}
-	return false, rl.window
+	if !res.Allowed {
+		res.RetryAfter = res.Reset
+	}
+	res.Remaining = rl.limit - w.count
+
+	return res
 }
 
-func (rl *FixedWindowRateLimiter) resetCount(ip string) {
-	time.Sleep(rl.window)
-	delete(rl.clients, ip)
+// sweep drops the ended windows, at most once per window, so keys that
+// stopped sending requests do not pile up.
+func (rl *FixedWindowRateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rl.window {
+		return
+	}
+	rl.lastSweep = now
 
+	for key, w := range rl.clients {
+		if now.Sub(w.start) >= rl.window {
+			delete(rl.clients, key)
+		}
+	}
 }
@@ -1,13 +1,128 @@
 package ratelimiter
 
-import "time"
+import (
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
 
 type Limiter interface {
-	Allow(ip string) (bool, time.Duration)
+	// Allow counts a request of key, if it is allowed.
+	Allow(key string) Result
+	// Peek returns the quota of key without counting a request.
+	Peek(key string) Result
+}
+
+// Result is the quota of a key after a request, or at a Peek.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the whole quota is available again.
+	Reset time.Duration
+	// RetryAfter is how long until a request is allowed, zero when it is.
+	RetryAfter time.Duration
 }
 
+const (
+	FixedWindow   = "fixed_window"
+	SlidingWindow = "sliding_window"
+	TokenBucket   = "token_bucket"
+)
+
+const (
+	// PolicyAuth limits signing up and signing in
+	PolicyAuth = "auth"
+	// PolicyRead limits GET requests
+	PolicyRead = "read"
+	// PolicyWrite limits requests that change something
+	PolicyWrite = "write"
+)
+
 type Config struct {
-	ReuestsPerTimeFrame int
-	TimeFrame           time.Duration
-	Enabled             bool
+	Policies map[string]Rule
+	Enabled  bool
+}
+
+// Rule allows Limit requests per Window using Algorithm.
+type Rule struct {
+	Algorithm string
+	Limit     int
+	Window    time.Duration
+}
+
+// New returns an in-process limiter that enforces rule.
+func New(rule Rule) (Limiter, error) {
+	if rule.Limit <= 0 || rule.Window <= 0 {
+		return nil, fmt.Errorf("rate limit of %d per %s is not positive", rule.Limit, rule.Window)
+	}
+
+	switch rule.Algorithm {
+	case FixedWindow:
+		return NewFixedWindowRateLimiter(rule.Limit, rule.Window), nil
+	case SlidingWindow:
+		return NewSlidingWindowRateLimiter(rule.Limit, rule.Window), nil
+	case TokenBucket:
+		return NewTokenBucketRateLimiter(rule.Limit, rule.Window), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", rule.Algorithm)
+	}
+}
+
+// Policies limits requests under named policies. A client's requests under
+// one policy do not count towards another.
+type Policies struct {
+	rules    map[string]Rule
+	limiters map[string]Limiter
+}
+
+// NewPolicies builds the limiter of every rule. With a Redis client the
+// limits are shared by every replica through Redis, which runs the rule's
+// algorithm, and the in-process limiter takes over while Redis can not be
+// reached.
+func NewPolicies(rules map[string]Rule, rdb *redis.Client, logger *zap.SugaredLogger) (*Policies, error) {
+	limiters := make(map[string]Limiter, len(rules))
+	for name, rule := range rules {
+		limiter, err := New(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit policy %s: %w", name, err)
+		}
+
+		if rdb != nil {
+			limiter, err = NewRedisRateLimiter(rdb, rule, limiter, logger)
+			if err != nil {
+				return nil, fmt.Errorf("rate limit policy %s: %w", name, err)
+			}
+		}
+		limiters[name] = limiter
+	}
+
+	return &Policies{rules: rules, limiters: limiters}, nil
+}
+
+// Allow counts a request of key under policy, if it is allowed. Policies
+// without a rule allow everything.
+func (p *Policies) Allow(policy, key string) Result {
+	limiter, ok := p.limiters[policy]
+	if !ok {
+		return Result{Allowed: true}
+	}
+	return limiter.Allow(policy + ":" + key)
+}
+
+// Peek returns the quota of key under policy without counting a request.
+func (p *Policies) Peek(policy, key string) Result {
+	limiter, ok := p.limiters[policy]
+	if !ok {
+		return Result{Allowed: true}
+	}
+	return limiter.Peek(policy + ":" + key)
+}
+
+// Rules returns the rule of every policy.
+func (p *Policies) Rules() map[string]Rule {
+	return maps.Clone(p.rules)
 }
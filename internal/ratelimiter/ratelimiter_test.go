@@ -0,0 +1,216 @@
+package ratelimiter
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// allowConcurrently sends requests of key from workers goroutines at once and
+// returns how many were allowed.
+func allowConcurrently(l Limiter, key string, workers, requests int) int {
+	var (
+		allowed atomic.Int64
+		wg      sync.WaitGroup
+		start   = make(chan struct{})
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for range requests {
+				if l.Allow(key).Allowed {
+					allowed.Add(1)
+				}
+				l.Peek(key)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	return int(allowed.Load())
+}
+
+func TestLimitersConcurrentAllow(t *testing.T) {
+	const limit = 50
+
+	for _, algorithm := range []string{FixedWindow, SlidingWindow, TokenBucket} {
+		t.Run(algorithm, func(t *testing.T) {
+			// a window long enough that nothing refills during the test
+			limiter, err := New(Rule{Algorithm: algorithm, Limit: limit, Window: time.Hour})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := allowConcurrently(limiter, "client", 16, 20); got != limit {
+				t.Errorf("allowed %d of 320 concurrent requests, want %d", got, limit)
+			}
+
+			res := limiter.Peek("client")
+			if res.Allowed || res.Remaining != 0 || res.RetryAfter <= 0 {
+				t.Errorf("Peek after the limit = %+v, want denied with a retry", res)
+			}
+
+			// keys are limited apart
+			if !limiter.Allow("other").Allowed {
+				t.Error("another key was denied")
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidRules(t *testing.T) {
+	tests := []Rule{
+		{Algorithm: FixedWindow, Limit: 0, Window: time.Minute},
+		{Algorithm: FixedWindow, Limit: 10, Window: 0},
+		{Algorithm: "leaky_bucket", Limit: 10, Window: time.Minute},
+	}
+
+	for _, rule := range tests {
+		if _, err := New(rule); err == nil {
+			t.Errorf("New(%+v) succeeded, want an error", rule)
+		}
+	}
+}
+
+// testRedis connects to the Redis at REDIS_ADDR, the test is skipped without
+// one.
+func testRedis(t *testing.T) *redis.Client {
+	t.Helper()
+
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { rdb.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis at %s is not reachable: %v", addr, err)
+	}
+
+	return rdb
+}
+
+func TestRedisLimitIsShared(t *testing.T) {
+	rdb := testRedis(t)
+	const limit = 20
+
+	for _, algorithm := range []string{FixedWindow, SlidingWindow, TokenBucket} {
+		t.Run(algorithm, func(t *testing.T) {
+			rule := Rule{Algorithm: algorithm, Limit: limit, Window: time.Hour}
+
+			// two replicas with their own fallback share the limit through Redis
+			newReplica := func() Limiter {
+				fallback, err := New(rule)
+				if err != nil {
+					t.Fatal(err)
+				}
+				limiter, err := NewRedisRateLimiter(rdb, rule, fallback, zap.NewNop().Sugar())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return limiter
+			}
+			a, b := newReplica(), newReplica()
+
+			key := "test:" + rand.Text()
+			t.Cleanup(func() { rdb.Del(context.Background(), "ratelimit:"+algorithm+":"+key) })
+
+			var allowed atomic.Int64
+			var wg sync.WaitGroup
+			for _, replica := range []Limiter{a, b} {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					allowed.Add(int64(allowConcurrently(replica, key, 4, 10)))
+				}()
+			}
+			wg.Wait()
+
+			if got := allowed.Load(); got != limit {
+				t.Errorf("two replicas allowed %d of 80 requests, want %d between them", got, limit)
+			}
+
+			for name, replica := range map[string]Limiter{"a": a, "b": b} {
+				res := replica.Peek(key)
+				if res.Allowed || res.Remaining != 0 || res.RetryAfter <= 0 {
+					t.Errorf("replica %s Peek = %+v, want the shared limit reached", name, res)
+				}
+			}
+		})
+	}
+}
+
+func TestRedisFallsBackWhenUnreachable(t *testing.T) {
+	// nothing listens on port 1
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { rdb.Close() })
+
+	const limit = 3
+	rule := Rule{Algorithm: FixedWindow, Limit: limit, Window: time.Minute}
+	core, logs := observer.New(zap.InfoLevel)
+	limiter, err := NewRedisRateLimiter(rdb, rule, NewFixedWindowRateLimiter(limit, time.Minute), zap.New(core).Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range limit {
+		if res := limiter.Allow("client"); !res.Allowed {
+			t.Fatalf("request %d denied while falling back: %+v", i+1, res)
+		}
+	}
+
+	res := limiter.Allow("client")
+	if res.Allowed {
+		t.Error("request over the limit allowed, want the fallback to limit in process")
+	}
+	if res.Limit != limit || res.RetryAfter <= 0 {
+		t.Errorf("fallback result = %+v, want the in-process quota", res)
+	}
+
+	if res := limiter.Peek("client"); res.Allowed {
+		t.Errorf("Peek = %+v, want the fallback's quota", res)
+	}
+
+	// the outage is logged once, not on every request
+	if n := logs.Len(); n != 1 {
+		t.Errorf("logged %d entries while Redis was down, want 1", n)
+	}
+}
+
+func TestRedisLogsRecovery(t *testing.T) {
+	rdb := testRedis(t)
+
+	core, logs := observer.New(zap.InfoLevel)
+	rule := Rule{Algorithm: FixedWindow, Limit: 5, Window: time.Minute}
+	limiter, err := NewRedisRateLimiter(rdb, rule, NewFixedWindowRateLimiter(5, time.Minute), zap.New(core).Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter.failing.Store(true)
+
+	key := "recovery-" + rand.Text()
+	limiter.Allow(key)
+	limiter.Allow(key)
+
+	if limiter.failing.Load() {
+		t.Error("still failing after Redis answered")
+	}
+	if n := logs.FilterMessage("redis rate limiter recovered").Len(); n != 1 {
+		t.Errorf("logged the recovery %d times, want once", n)
+	}
+}
@@ -0,0 +1,216 @@
+package ratelimiter
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// slidingLogScript keeps the times of the admitted requests of a key in a
+// sorted set and admits a request while fewer than limit fall in the window.
+// Scripts run atomically, so replicas sharing a key never admit more than
+// limit between them, and the time comes from Redis so replicas with skewed
+// clocks agree. Unless ARGV[4] is 1 it only reports the quota. It returns
+// whether the request is admitted, the remaining requests, and the
+// microseconds until the whole quota is available and, when not admitted,
+// until the request would be.
+var slidingLogScript = redis.NewScript(`
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local member = ARGV[3]
+local count = ARGV[4] == '1'
+
+-- needed to write after reading TIME before Redis 5, a no-op since
+redis.replicate_commands()
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+
+local admitted = redis.call('ZCARD', key)
+local allowed = admitted < limit
+if allowed and count then
+	redis.call('ZADD', key, now, member)
+	redis.call('PEXPIRE', key, math.ceil(window / 1000))
+	admitted = admitted + 1
+end
+
+local reset = 0
+local newest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+if newest[2] ~= nil then
+	reset = tonumber(newest[2]) + window - now
+end
+
+if allowed then
+	return {1, limit - admitted, reset, 0}
+end
+
+local retry = window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] ~= nil then
+	retry = tonumber(oldest[2]) + window - now
+end
+return {0, 0, reset, retry}
+`)
+
+// fixedWindowScript counts the requests of a key in a window that starts
+// with its first request and ends when the counter expires. It takes and
+// returns the same as slidingLogScript.
+var fixedWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local count = ARGV[4] == '1'
+
+local admitted = tonumber(redis.call('GET', key) or '0')
+local allowed = admitted < limit
+if allowed and count then
+	admitted = redis.call('INCR', key)
+	if admitted == 1 then
+		redis.call('PEXPIRE', key, math.ceil(window / 1000))
+	end
+end
+
+local reset = 0
+local ttl = redis.call('PTTL', key)
+if ttl > 0 then
+	reset = ttl * 1000
+end
+
+if allowed then
+	return {1, limit - admitted, reset, 0}
+end
+return {0, 0, reset, reset}
+`)
+
+// tokenBucketScript keeps the tokens of a key and when they were counted in
+// a hash, refilling limit tokens per window. It takes and returns the same as
+// slidingLogScript.
+var tokenBucketScript = redis.NewScript(`
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local count = ARGV[4] == '1'
+
+redis.replicate_commands()
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+-- tokens per microsecond
+local rate = limit / window
+
+local tokens = limit
+local bucket = redis.call('HMGET', key, 'tokens', 'last')
+if bucket[1] and bucket[2] then
+	tokens = math.min(limit, tonumber(bucket[1]) + (now - tonumber(bucket[2])) * rate)
+end
+
+local allowed = tokens >= 1
+if allowed and count then
+	tokens = tokens - 1
+end
+if count then
+	-- numbers are passed on exactly, unlike tostring
+	redis.call('HSET', key, 'tokens', tokens, 'last', now)
+	-- a bucket left alone for a window is full again
+	redis.call('PEXPIRE', key, math.ceil(window / 1000))
+end
+
+local reset = math.ceil((limit - tokens) / rate)
+if allowed then
+	return {1, math.floor(tokens), reset, 0}
+end
+return {0, 0, reset, math.ceil((1 - tokens) / rate)}
+`)
+
+// redisScripts runs every algorithm in Redis. The sliding window is kept as
+// an exact log of requests rather than the two weighted counters of the
+// in-process limiter.
+var redisScripts = map[string]*redis.Script{
+	FixedWindow:   fixedWindowScript,
+	SlidingWindow: slidingLogScript,
+	TokenBucket:   tokenBucketScript,
+}
+
+// RedisRateLimiter enforces a rule shared by every replica through Redis.
+// While Redis can not be reached it falls back to an in-process limiter,
+// which limits each replica on its own.
+type RedisRateLimiter struct {
+	rdb       *redis.Client
+	script    *redis.Script
+	algorithm string
+	limit     int
+	window    time.Duration
+	fallback  Limiter
+	logger    *zap.SugaredLogger
+	// failing is set while Redis is unavailable, so the outage is logged
+	// once instead of on every request
+	failing atomic.Bool
+}
+
+func NewRedisRateLimiter(rdb *redis.Client, rule Rule, fallback Limiter, logger *zap.SugaredLogger) (*RedisRateLimiter, error) {
+	script, ok := redisScripts[rule.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", rule.Algorithm)
+	}
+
+	return &RedisRateLimiter{
+		rdb:       rdb,
+		script:    script,
+		algorithm: rule.Algorithm,
+		limit:     rule.Limit,
+		window:    rule.Window,
+		fallback:  fallback,
+		logger:    logger,
+	}, nil
+}
+
+func (rl *RedisRateLimiter) Allow(key string) Result {
+	return rl.check(key, true)
+}
+
+func (rl *RedisRateLimiter) Peek(key string) Result {
+	return rl.check(key, false)
+}
+
+func (rl *RedisRateLimiter) check(key string, count bool) Result {
+	// a slow Redis must not hold up every request
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	flag := 0
+	if count {
+		flag = 1
+	}
+
+	// members must be unique, or requests in the same microsecond collapse
+	// algorithms keep different types under a key, so the key names it
+	res, err := rl.script.Run(ctx, rl.rdb, []string{"ratelimit:" + rl.algorithm + ":" + key},
+		rl.window.Microseconds(), rl.limit, rand.Text(), flag).Int64Slice()
+	if err != nil || len(res) != 4 {
+		if rl.failing.CompareAndSwap(false, true) {
+			rl.logger.Warnw("redis rate limiter failed, limiting in process", "error", err)
+		}
+		if count {
+			return rl.fallback.Allow(key)
+		}
+		return rl.fallback.Peek(key)
+	}
+	if rl.failing.CompareAndSwap(true, false) {
+		rl.logger.Infow("redis rate limiter recovered")
+	}
+
+	return Result{
+		Allowed:    res[0] == 1,
+		Limit:      rl.limit,
+		Remaining:  int(res[1]),
+		Reset:      time.Duration(res[2]) * time.Microsecond,
+		RetryAfter: time.Duration(res[3]) * time.Microsecond,
+	}
+}
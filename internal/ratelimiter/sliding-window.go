@@ -0,0 +1,126 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// SlidingWindowRateLimiter approximates a window sliding with every request
+// from two fixed windows: the count of the previous window is weighted by how
+// much of it the sliding window still covers. Unlike a fixed window it does
+// not let through twice the limit around a window boundary, and it keeps two
+// counters per key instead of a log of requests.
+type SlidingWindowRateLimiter struct {
+	mu        sync.Mutex
+	clients   map[string]*slidingWindow
+	limit     int
+	window    time.Duration
+	lastSweep time.Time
+}
+
+type slidingWindow struct {
+	start    time.Time
+	previous int
+	current  int
+}
+
+func NewSlidingWindowRateLimiter(limit int, window time.Duration) *SlidingWindowRateLimiter {
+	return &SlidingWindowRateLimiter{
+		clients: make(map[string]*slidingWindow),
+		limit:   limit,
+		window:  window,
+	}
+}
+
+func (rl *SlidingWindowRateLimiter) Allow(key string) Result {
+	return rl.check(key, true)
+}
+
+func (rl *SlidingWindowRateLimiter) Peek(key string) Result {
+	return rl.check(key, false)
+}
+
+func (rl *SlidingWindowRateLimiter) check(key string, count bool) Result {
+	now := time.Now()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	w := slidingWindow{start: now.Truncate(rl.window)}
+	if stored, ok := rl.clients[key]; ok {
+		w = *stored
+	}
+
+	switch elapsed := now.Sub(w.start) / rl.window; {
+	case elapsed == 1:
+		w.start = w.start.Add(rl.window)
+		w.previous, w.current = w.current, 0
+	case elapsed > 1:
+		w.start = now.Truncate(rl.window)
+		w.previous, w.current = 0, 0
+	}
+
+	// the share of the previous window the sliding window still covers
+	overlap := 1 - float64(now.Sub(w.start))/float64(rl.window)
+	estimate := func() float64 {
+		return float64(w.previous)*overlap + float64(w.current)
+	}
+
+	res := Result{Allowed: estimate() < float64(rl.limit), Limit: rl.limit}
+	if res.Allowed && count {
+		w.current++
+	}
+	if !res.Allowed {
+		res.RetryAfter = rl.retryAfter(&w, now)
+	}
+	if count {
+		rl.clients[key] = &w
+	}
+
+	res.Remaining = max(rl.limit-int(math.Ceil(estimate())), 0)
+	// requests leave the sliding window one window after their own ended
+	switch {
+	case w.current > 0:
+		res.Reset = w.start.Add(2 * rl.window).Sub(now)
+	case w.previous > 0:
+		res.Reset = w.start.Add(rl.window).Sub(now)
+	}
+
+	return res
+}
+
+// retryAfter is how long until the estimate of w drops below the limit,
+// assuming no more requests are admitted meanwhile.
+func (rl *SlidingWindowRateLimiter) retryAfter(w *slidingWindow, now time.Time) time.Duration {
+	limit := float64(rl.limit)
+
+	// the overlap at which previous*overlap + current < limit
+	start, previous, current := w.start, float64(w.previous), float64(w.current)
+	if current >= limit {
+		// not before the next window, where current becomes previous
+		start, previous, current = start.Add(rl.window), current, 0
+	}
+
+	overlap := (limit - current) / previous
+	at := start.Add(time.Duration((1 - overlap) * float64(rl.window)))
+
+	return max(at.Sub(now), 0)
+}
+
+// sweep drops the keys without requests in the last two windows, at most
+// once per window.
+func (rl *SlidingWindowRateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rl.window {
+		return
+	}
+	rl.lastSweep = now
+
+	for key, w := range rl.clients {
+		if now.Sub(w.start) >= 2*rl.window {
+			delete(rl.clients, key)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucketRateLimiter gives every key a bucket of limit tokens that
+// refills at limit tokens per window. Bursts of up to limit requests pass,
+// and over time a key gets limit requests per window.
+type TokenBucketRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	limit     int
+	window    time.Duration
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucketRateLimiter(limit int, window time.Duration) *TokenBucketRateLimiter {
+	return &TokenBucketRateLimiter{
+		buckets: make(map[string]*tokenBucket),
+		limit:   limit,
+		window:  window,
+	}
+}
+
+func (rl *TokenBucketRateLimiter) Allow(key string) Result {
+	return rl.check(key, true)
+}
+
+func (rl *TokenBucketRateLimiter) Peek(key string) Result {
+	return rl.check(key, false)
+}
+
+func (rl *TokenBucketRateLimiter) check(key string, count bool) Result {
+	now := time.Now()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	limit := float64(rl.limit)
+	rate := limit / float64(rl.window)
+
+	tokens := limit
+	if b, ok := rl.buckets[key]; ok {
+		tokens = min(limit, b.tokens+float64(now.Sub(b.last))*rate)
+	}
+
+	res := Result{Allowed: tokens >= 1, Limit: rl.limit}
+	if res.Allowed && count {
+		tokens--
+	}
+	if !res.Allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / rate)
+	}
+	if count {
+		rl.buckets[key] = &tokenBucket{tokens: tokens, last: now}
+	}
+
+	res.Remaining = int(tokens)
+	res.Reset = time.Duration((limit - tokens) / rate)
+
+	return res
+}
+
+// sweep drops the buckets that refilled completely, at most once per window.
+func (rl *TokenBucketRateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rl.window {
+		return
+	}
+	rl.lastSweep = now
+
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) >= rl.window {
+			delete(rl.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// a Thursday
+	from := time.Date(2026, time.January, 15, 10, 30, 0, 0, time.UTC)
+	at := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{spec: "* * * * *", from: from.Add(time.Second * 20), want: at(2026, time.January, 15, 10, 31)},
+		{spec: "*/15 * * * *", from: from, want: at(2026, time.January, 15, 10, 45)},
+		// a/step runs from a to the end of the field
+		{spec: "5/20 * * * *", from: from, want: at(2026, time.January, 15, 10, 45)},
+		{spec: "10-40/10 * * * *", from: from, want: at(2026, time.January, 15, 10, 40)},
+		{spec: "10-40/10 * * * *", from: at(2026, time.January, 15, 10, 40), want: at(2026, time.January, 15, 11, 10)},
+		{spec: "0,45 9,10 * * *", from: from, want: at(2026, time.January, 15, 10, 45)},
+		{spec: "0 8 * * 1", from: from, want: at(2026, time.January, 19, 8, 0)},
+		// 0 and 7 are both Sunday
+		{spec: "0 0 * * 0", from: from, want: at(2026, time.January, 18, 0, 0)},
+		{spec: "0 0 * * 7", from: from, want: at(2026, time.January, 18, 0, 0)},
+		{spec: "0 0 * * 5-7", from: from, want: at(2026, time.January, 16, 0, 0)},
+		// a restricted day of month and day of week match either
+		{spec: "0 0 13 * 5", from: from, want: at(2026, time.January, 16, 0, 0)},
+		{spec: "0 0 13 * 5", from: at(2026, time.February, 12, 0, 0), want: at(2026, time.February, 13, 0, 0)},
+		// with a * in either field both must match
+		{spec: "0 0 13 * *", from: from, want: at(2026, time.February, 13, 0, 0)},
+		{spec: "0 0 13 * */2", from: from, want: at(2026, time.June, 13, 0, 0)},
+		{spec: "0 0 * * 5", from: from, want: at(2026, time.January, 16, 0, 0)},
+		// rolling over into the next month and year
+		{spec: "0 0 1 * *", from: from, want: at(2026, time.February, 1, 0, 0)},
+		{spec: "0 0 31 * *", from: at(2026, time.January, 31, 0, 0), want: at(2026, time.March, 31, 0, 0)},
+		{spec: "* * * * *", from: at(2026, time.December, 31, 23, 59), want: at(2027, time.January, 1, 0, 0)},
+		{spec: "0 12 1 3 *", from: from, want: at(2026, time.March, 1, 12, 0)},
+		{spec: "0 0 1 1 *", from: from, want: at(2027, time.January, 1, 0, 0)},
+		{spec: "0 0 29 2 *", from: from, want: at(2028, time.February, 29, 0, 0)},
+		// never happens
+		{spec: "0 0 30 2 *", from: from, want: time.Time{}},
+		// descriptors
+		{spec: "@hourly", from: from, want: at(2026, time.January, 15, 11, 0)},
+		{spec: "@daily", from: from, want: at(2026, time.January, 16, 0, 0)},
+		{spec: "@midnight", from: from, want: at(2026, time.January, 16, 0, 0)},
+		{spec: "@weekly", from: from, want: at(2026, time.January, 18, 0, 0)},
+		{spec: "@monthly", from: from, want: at(2026, time.February, 1, 0, 0)},
+		{spec: "@yearly", from: from, want: at(2027, time.January, 1, 0, 0)},
+		{spec: " @annually ", from: from, want: at(2027, time.January, 1, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("ParseCron(%q).Next(%v) = %v, want %v", tt.spec, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleNextKeepsLocation(t *testing.T) {
+	tehran := time.FixedZone("Asia/Tehran", 3*60*60+30*60)
+	s, err := ParseCron("0 8 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := s.Next(time.Date(2026, time.January, 15, 9, 0, 0, 0, tehran))
+	want := time.Date(2026, time.January, 16, 8, 0, 0, 0, tehran)
+	if !got.Equal(want) || got.Location() != tehran {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@every 5m",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"1,,2 * * * *",
+	}
+
+	for _, spec := range specs {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want an error", spec)
+		}
+	}
+}
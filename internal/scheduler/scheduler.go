@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// Task is a recurring job run on its cron schedule by one instance at a time.
+type Task struct {
+	Name     string
+	Schedule string
+	Run      func(ctx context.Context) error
+}
+
+// TaskStatus combines a task's schedule with its last run on any instance.
+type TaskStatus struct {
+	Name     string               `json:"name"`
+	Schedule string               `json:"schedule"`
+	NextRun  time.Time            `json:"next_run"`
+	LastRun  *store.ScheduledTask `json:"last_run"`
+}
+
+type entry struct {
+	task     Task
+	schedule *Schedule
+	next     time.Time
+}
+
+// Scheduler runs tasks on their cron schedules. Every instance runs a
+// Scheduler; a Postgres advisory lock and the recorded last run make sure
+// each scheduled run happens once.
+type Scheduler struct {
+	store  store.Storage
+	logger *zap.SugaredLogger
+
+	mu      sync.Mutex
+	entries []*entry
+}
+
+func New(store store.Storage, logger *zap.SugaredLogger) *Scheduler {
+	return &Scheduler{store: store, logger: logger}
+}
+
+// Add registers a task. It must be called before Run.
+func (s *Scheduler) Add(task Task) error {
+	schedule, err := ParseCron(task.Schedule)
+	if err != nil {
+		return fmt.Errorf("task %s: %w", task.Name, err)
+	}
+
+	next := schedule.Next(time.Now().UTC())
+	if next.IsZero() {
+		return fmt.Errorf("task %s: schedule %q never runs", task.Name, task.Schedule)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, &entry{task: task, schedule: schedule, next: next})
+	return nil
+}
+
+// Run starts the tasks when they are due until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	var running sync.WaitGroup
+	defer running.Wait()
+
+	for {
+		s.mu.Lock()
+		var wake time.Time
+		for _, e := range s.entries {
+			if wake.IsZero() || e.next.Before(wake) {
+				wake = e.next
+			}
+		}
+		s.mu.Unlock()
+
+		if wake.IsZero() {
+			<-ctx.Done()
+			return
+		}
+
+		timer := time.NewTimer(time.Until(wake))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now().UTC()
+
+		s.mu.Lock()
+		for _, e := range s.entries {
+			if e.next.After(now) {
+				continue
+			}
+
+			scheduledAt := e.next
+			e.next = e.schedule.Next(now)
+
+			running.Add(1)
+			go func(task Task) {
+				defer running.Done()
+				s.run(ctx, task, scheduledAt)
+			}(e.task)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, task Task, scheduledAt time.Time) {
+	start := time.Now()
+
+	ran, err := s.store.Scheduler.RunExclusive(ctx, task.Name, scheduledAt, task.Run)
+	switch {
+	case err != nil:
+		s.logger.Errorw("scheduled task failed", "task", task.Name, "scheduled_at", scheduledAt, "error", err)
+	case ran:
+		s.logger.Infow("scheduled task finished", "task", task.Name, "duration", time.Since(start).String())
+	}
+}
+
+// Status returns every task with its next and last run.
+func (s *Scheduler) Status(ctx context.Context) ([]TaskStatus, error) {
+	runs, err := s.store.Scheduler.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lastRuns := make(map[string]*store.ScheduledTask, len(runs))
+	for i := range runs {
+		lastRuns[runs[i].Name] = &runs[i]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]TaskStatus, 0, len(s.entries))
+	for _, e := range s.entries {
+		statuses = append(statuses, TaskStatus{
+			Name:     e.task.Name,
+			Schedule: e.task.Schedule,
+			NextRun:  e.next,
+			LastRun:  lastRuns[e.task.Name],
+		})
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type BlockStore struct {
+	db *sql.DB
+}
+
+// Block stops blockedID from interacting with userID. Any follow between the
+// two users is removed in both directions.
+func (s *BlockStore) Block(ctx context.Context, userID, blockedID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO user_blocks (user_id, blocked_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`
+		if _, err := tx.ExecContext(ctx, query, userID, blockedID); err != nil {
+			return err
+		}
+
+		query = `
+			DELETE FROM followers
+			WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+		`
+		_, err := tx.ExecContext(ctx, query, userID, blockedID)
+		return err
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, userID, blockedID int64) error {
+	query := `
+		DELETE FROM user_blocks
+		WHERE user_id = $1 AND blocked_id = $2
+	`
+	_, err := s.db.ExecContext(ctx, query, userID, blockedID)
+	return err
+}
+
+// GetBlockedIDs returns the users userID blocked or was blocked by.
+func (s *BlockStore) GetBlockedIDs(ctx context.Context, userID int64) ([]int64, error) {
+	query := `
+		SELECT blocked_id FROM user_blocks WHERE user_id = $1
+		UNION
+		SELECT user_id FROM user_blocks WHERE blocked_id = $1
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+	"github.com/redis/go-redis/v9"
+)
+
+// ExploreFeedExpTime is kept short since the explore feed changes with every
+// new post.
+const ExploreFeedExpTime = time.Second * 30
+
+type FeedStore struct {
+	rdb *redis.Client
+}
+
+func (s *FeedStore) GetExplore(ctx context.Context, fq store.PaginatedFeedQuery) (*store.FeedPage, error) {
+	cacheKey, err := exploreKey(fq)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.rdb.Get(ctx, cacheKey).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var page store.FeedPage
+	if err := json.Unmarshal([]byte(data), &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (s *FeedStore) SetExplore(ctx context.Context, fq store.PaginatedFeedQuery, page *store.FeedPage) error {
+	cacheKey, err := exploreKey(fq)
+	if err != nil {
+		return err
+	}
+
+	json, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.Set(ctx, cacheKey, json, ExploreFeedExpTime).Err()
+}
+
+// exploreKey derives the cache key from every filter of the query.
+func exploreKey(fq store.PaginatedFeedQuery) (string, error) {
+	data, err := json.Marshal(fq)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(data)
+	return "feed-explore-" + hex.EncodeToString(hash[:16]), nil
+}
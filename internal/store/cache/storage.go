@@ -11,11 +11,22 @@ type Storage struct {
 	Users interface {
 		Get(context.Context, int64) (*store.User, error)
 		Set(context.Context, *store.User) error
+		Delete(context.Context, int64) error
+	}
+	Feeds interface {
+		GetExplore(context.Context, store.PaginatedFeedQuery) (*store.FeedPage, error)
+		SetExplore(context.Context, store.PaginatedFeedQuery, *store.FeedPage) error
+	}
+	Syndication interface {
+		Get(context.Context, string) (*SyndicationFeed, error)
+		Set(context.Context, string, *SyndicationFeed) error
 	}
 }
 
 func NewStorage(rdb *redis.Client) Storage {
 	return Storage{
-		Users: &UserStore{rdb: rdb},
+		Users:       &UserStore{rdb: rdb},
+		Feeds:       &FeedStore{rdb: rdb},
+		Syndication: &SyndicationStore{rdb: rdb},
 	}
 }
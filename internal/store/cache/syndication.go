@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SyndicationExpTime bounds how stale a feed reader's copy can get.
+const SyndicationExpTime = time.Minute * 5
+
+// SyndicationFeed is a rendered RSS or Atom document.
+type SyndicationFeed struct {
+	Body         []byte    `json:"body"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+type SyndicationStore struct {
+	rdb *redis.Client
+}
+
+func (s *SyndicationStore) Get(ctx context.Context, key string) (*SyndicationFeed, error) {
+	data, err := s.rdb.Get(ctx, syndicationKey(key)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var feed SyndicationFeed
+	if err := json.Unmarshal([]byte(data), &feed); err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+func (s *SyndicationStore) Set(ctx context.Context, key string, feed *SyndicationFeed) error {
+	json, err := json.Marshal(feed)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.Set(ctx, syndicationKey(key), json, SyndicationExpTime).Err()
+}
+
+func syndicationKey(key string) string {
+	return "syndication-" + key
+}
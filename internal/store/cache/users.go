@@ -44,3 +44,8 @@ func (s *UserStore) Get(ctx context.Context, user_id int64) (*store.User, error)
 	}
 	return &user, nil
 }
+
+func (s *UserStore) Delete(ctx context.Context, userID int64) error {
+	cacheKey := fmt.Sprintf("user-%v", userID)
+	return s.rdb.Del(ctx, cacheKey).Err()
+}
@@ -3,15 +3,33 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 )
 
+// MaxCommentDepth is the deepest level a reply can be nested at.
+// top-level comments have depth 0.
+const MaxCommentDepth = 5
+
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	User      User   `json:"user"`
+	ID            int64  `json:"id"`
+	PostID        int64  `json:"post_id"`
+	UserID        int64  `json:"user_id"`
+	ParentID      *int64 `json:"parent_id"`
+	Depth         int    `json:"depth"`
+	Content       string `json:"content"`
+	ReplyCount    int    `json:"reply_count"`
+	ReactionCount int    `json:"reaction_count"`
+	IsDeleted     bool   `json:"is_deleted"`
+	CreatedAt     string `json:"created_at"`
+	Version       int    `json:"version"`
+	UpdatedAt     string `json:"updated_at"`
+	User          User   `json:"user"`
+}
+
+type CommentsPage struct {
+	Comments   []Comment `json:"comments"`
+	Total      int       `json:"total"`
+	NextCursor string    `json:"next_cursor,omitempty"`
 }
 
 type CommentStore struct {
@@ -19,46 +37,371 @@ type CommentStore struct {
 }
 
 func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		comment.Depth = 0
+		if comment.ParentID != nil {
+			depth, err := s.replyDepth(ctx, tx, comment.PostID, *comment.ParentID)
+			if err != nil {
+				return err
+			}
+			comment.Depth = depth
+		}
+
+		query := `
+			INSERT INTO comments (post_id, user_id, content, parent_id, depth)
+			VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at, version
+		`
+		return tx.QueryRowContext(
+			ctx,
+			query,
+			comment.PostID,
+			comment.UserID,
+			comment.Content,
+			comment.ParentID,
+			comment.Depth,
+		).Scan(
+			&comment.ID,
+			&comment.CreatedAt,
+			&comment.UpdatedAt,
+			&comment.Version,
+		)
+	})
+}
+
+// replyDepth returns the depth a reply to parentID would have, making sure the
+// parent lives on the same post and the thread is not nested too deep.
+func (s *CommentStore) replyDepth(ctx context.Context, tx *sql.Tx, postID, parentID int64) (int, error) {
 	query := `
-		INSERT INTO comments (post_id, user_id, content)
-		VALUES ($1, $2, $3) RETURNING id, created_at 
+		SELECT depth FROM comments
+		WHERE id = $1 AND post_id = $2 AND deleted_at IS NULL
+		FOR SHARE
 	`
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		&comment.PostID,
-		&comment.UserID,
-		&comment.Content,
-	).Scan(
-		&comment.ID,
-		&comment.CreatedAt,
-	)
+	var depth int
+	if err := tx.QueryRowContext(ctx, query, parentID, postID).Scan(&depth); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
 
-	return err
+	if depth+1 > MaxCommentDepth {
+		return 0, ErrMaxCommentDepth
+	}
+
+	return depth + 1, nil
 }
 
-func (s *CommentStore) GetByPostID(ctx context.Context, postId int64) ([]Comment, error) {
+func (s *CommentStore) GetByID(ctx context.Context, commentID int64) (*Comment, error) {
 	query := `
-		SELECT 
-			c.id, 
-			c.post_id, 
-			c.user_id, 
-			c.content, 
+		SELECT
+			c.id,
+			c.post_id,
+			c.user_id,
+			c.parent_id,
+			c.depth,
+			c.content,
+			c.deleted_at IS NOT NULL,
 			c.created_at,
+			c.version,
+			c.updated_at,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id AND r.deleted_at IS NULL),
+			(SELECT COUNT(*) FROM comment_reactions cr WHERE cr.comment_id = c.id),
 			u.id,
 			u.username
 		FROM comments c
 		JOIN users u ON u.id = c.user_id
-		WHERE c.post_id = $1
-		ORDER BY c.created_at DESC;
+		WHERE c.id = $1
 	`
+	var c Comment
+	if err := s.db.QueryRowContext(ctx, query, commentID).Scan(
+		&c.ID,
+		&c.PostID,
+		&c.UserID,
+		&c.ParentID,
+		&c.Depth,
+		&c.Content,
+		&c.IsDeleted,
+		&c.CreatedAt,
+		&c.Version,
+		&c.UpdatedAt,
+		&c.ReplyCount,
+		&c.ReactionCount,
+		&c.User.ID,
+		&c.User.Username,
+	); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &c, nil
+}
 
-	rows, err := s.db.QueryContext(ctx, query, postId)
+// GetByPostID returns up to limit comments of a post's tree flattened in
+// thread order: newest threads first, each followed by its replies oldest first.
+func (s *CommentStore) GetByPostID(ctx context.Context, postId int64, limit int) ([]Comment, error) {
+	query := `
+		WITH RECURSIVE thread AS (
+			SELECT c.id, ARRAY[c.id] AS path
+			FROM comments c
+			WHERE c.post_id = $1 AND c.parent_id IS NULL
+			UNION ALL
+			SELECT c.id, t.path || c.id
+			FROM comments c
+			JOIN thread t ON c.parent_id = t.id
+		)
+		SELECT
+			c.id,
+			c.post_id,
+			c.user_id,
+			c.parent_id,
+			c.depth,
+			c.content,
+			c.deleted_at IS NOT NULL,
+			c.created_at,
+			c.version,
+			c.updated_at,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id AND r.deleted_at IS NULL),
+			(SELECT COUNT(*) FROM comment_reactions cr WHERE cr.comment_id = c.id),
+			u.id,
+			u.username
+		FROM thread t
+		JOIN comments c ON c.id = t.id
+		JOIN users u ON u.id = c.user_id
+		ORDER BY t.path[1] DESC, t.path
+		LIMIT $2;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, postId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanComments(rows)
+}
+
+// GetPage returns a page of the top-level comments of a post.
+func (s *CommentStore) GetPage(ctx context.Context, postID int64, pq PaginatedCommentsQuery) (*CommentsPage, error) {
+	return s.getPage(ctx, "c.post_id = $1 AND c.parent_id IS NULL", postID, pq)
+}
+
+// GetReplies returns a page of the direct replies to a comment.
+func (s *CommentStore) GetReplies(ctx context.Context, commentID int64, pq PaginatedCommentsQuery) (*CommentsPage, error) {
+	return s.getPage(ctx, "c.parent_id = $1", commentID, pq)
+}
+
+var commentSortOrders = map[string]struct {
+	order  string
+	cursor string
+}{
+	"newest": {
+		order:  "p.created_at DESC, p.id DESC",
+		cursor: "(p.created_at, p.id) < ($3, $4)",
+	},
+	"oldest": {
+		order:  "p.created_at ASC, p.id ASC",
+		cursor: "(p.created_at, p.id) > ($3, $4)",
+	},
+	"top": {
+		order:  "p.reactions DESC, p.created_at DESC, p.id DESC",
+		cursor: "(p.reactions, p.created_at, p.id) < ($5, $3, $4)",
+	},
+}
+
+// getPage runs a keyset paginated query over the comments matching scope,
+// which must reference its id as $1.
+func (s *CommentStore) getPage(ctx context.Context, scope string, scopeID int64, pq PaginatedCommentsQuery) (*CommentsPage, error) {
+	sort, ok := commentSortOrders[pq.Sort]
+	if !ok {
+		sort = commentSortOrders["newest"]
+	}
+
+	// fetch one extra row to know if there is a next page
+	args := []any{scopeID, pq.Limit + 1}
+	where := "TRUE"
+	if pq.Cursor != "" {
+		cursor, err := DecodeCommentCursor(pq.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, cursor.CreatedAt, cursor.ID)
+		if pq.Sort == "top" {
+			args = append(args, cursor.Reactions)
+		}
+		where = sort.cursor
+	}
+
+	query := `
+		WITH p AS (
+			SELECT
+				c.id,
+				c.created_at,
+				(SELECT COUNT(*) FROM comment_reactions cr WHERE cr.comment_id = c.id) AS reactions
+			FROM comments c
+			WHERE ` + scope + `
+		)
+		SELECT
+			c.id,
+			c.post_id,
+			c.user_id,
+			c.parent_id,
+			c.depth,
+			c.content,
+			c.deleted_at IS NOT NULL,
+			c.created_at,
+			c.version,
+			c.updated_at,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id AND r.deleted_at IS NULL),
+			p.reactions,
+			u.id,
+			u.username
+		FROM p
+		JOIN comments c ON c.id = p.id
+		JOIN users u ON u.id = c.user_id
+		WHERE ` + where + `
+		ORDER BY ` + sort.order + `
+		LIMIT $2;
+	`
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &CommentsPage{Comments: comments}
+	if len(comments) > pq.Limit {
+		page.Comments = comments[:pq.Limit]
+		last := page.Comments[pq.Limit-1]
+		page.NextCursor = CommentCursor{
+			Reactions: last.ReactionCount,
+			CreatedAt: last.CreatedAt,
+			ID:        last.ID,
+		}.Encode()
+	}
+
+	return page, nil
+}
+
+// CountTopLevel counts the top-level comments of a post, leaving out
+// tombstones like CountReplies.
+func (s *CommentStore) CountTopLevel(ctx context.Context, postID int64) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM comments
+		WHERE post_id = $1 AND parent_id IS NULL AND deleted_at IS NULL
+	`
+	var count int
+	err := s.db.QueryRowContext(ctx, query, postID).Scan(&count)
+	return count, err
+}
+
+// CountReplies counts the direct replies to a comment that are not deleted.
+func (s *CommentStore) CountReplies(ctx context.Context, commentID int64) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM comments
+		WHERE parent_id = $1 AND deleted_at IS NULL
+	`
+	var count int
+	err := s.db.QueryRowContext(ctx, query, commentID).Scan(&count)
+	return count, err
+}
+
+func (s *CommentStore) React(ctx context.Context, commentID, userID int64, reaction string) error {
+	query := `
+		INSERT INTO comment_reactions (comment_id, user_id, reaction)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (comment_id, user_id) DO UPDATE SET reaction = EXCLUDED.reaction
+	`
+	_, err := s.db.ExecContext(ctx, query, commentID, userID, reaction)
+	return err
+}
+
+func (s *CommentStore) Unreact(ctx context.Context, commentID, userID int64) error {
+	query := `
+		DELETE FROM comment_reactions
+		WHERE comment_id = $1 AND user_id = $2
+	`
+	_, err := s.db.ExecContext(ctx, query, commentID, userID)
+	return err
+}
+
+func (s *CommentStore) Update(ctx context.Context, comment *Comment) error {
+	query := `
+		UPDATE comments
+		SET content = $1,
+			updated_at = now(),
+			version = version + 1
+		WHERE id = $2 AND version = $3 AND deleted_at IS NULL
+		RETURNING version, updated_at
+	`
+
+	err := s.db.QueryRowContext(ctx, query,
+		comment.Content,
+		comment.ID,
+		comment.Version,
+	).Scan(&comment.Version, &comment.UpdatedAt)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes a comment. Comments that still have replies are kept as a
+// tombstone so the thread below them stays reachable.
+func (s *CommentStore) Delete(ctx context.Context, commentID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE comments
+			SET content = '', deleted_at = now(), version = version + 1
+			WHERE id = $1 AND EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = $1)
+		`
+		result, err := tx.ExecContext(ctx, query, commentID)
+		if err != nil {
+			return err
+		}
+
+		tombstoned, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if tombstoned > 0 {
+			return nil
+		}
+
+		result, err = tx.ExecContext(ctx, `DELETE FROM comments WHERE id = $1`, commentID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected <= 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	})
+}
+
+func scanComments(rows *sql.Rows) ([]Comment, error) {
 	comments := []Comment{}
 
 	for rows.Next() {
@@ -68,8 +411,15 @@ func (s *CommentStore) GetByPostID(ctx context.Context, postId int64) ([]Comment
 			&c.ID,
 			&c.PostID,
 			&c.UserID,
+			&c.ParentID,
+			&c.Depth,
 			&c.Content,
+			&c.IsDeleted,
 			&c.CreatedAt,
+			&c.Version,
+			&c.UpdatedAt,
+			&c.ReplyCount,
+			&c.ReactionCount,
 			&c.User.ID,
 			&c.User.Username,
 		)
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testStorage migrates a schema of its own in the database at TEST_DB_ADDR
+// and returns a Storage on it, the test is skipped without one.
+func testStorage(t *testing.T) (Storage, *sql.DB) {
+	t.Helper()
+
+	addr := os.Getenv("TEST_DB_ADDR")
+	if addr == "" {
+		t.Skip("TEST_DB_ADDR is not set")
+	}
+
+	admin, err := sql.Open("postgres", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "test_" + strings.ToLower(rand.Text())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	// every connection works in the schema, extensions may live in public
+	u, err := url.Parse(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema+",public")
+	u.RawQuery = q.Encode()
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := filepath.Glob("../../cmd/migrate/migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(migrations)
+	for _, path := range migrations {
+		migration, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(migration)); err != nil {
+			t.Fatalf("migrating %s: %v", filepath.Base(path), err)
+		}
+	}
+
+	return NewStorage(db), db
+}
+
+// createTestUser adds an active user and returns its id.
+func createTestUser(t *testing.T, db *sql.DB, username string) int64 {
+	t.Helper()
+
+	query := `
+		INSERT INTO users (username, email, password, role_id, is_active)
+		VALUES ($1, $2, '', (SELECT id FROM roles WHERE name = 'user'), true)
+		RETURNING id
+	`
+	var id int64
+	err := db.QueryRowContext(context.Background(), query, username, username+"@example.com").Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
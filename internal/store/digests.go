@@ -0,0 +1,168 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+var DigestFrequencies = []string{DigestOff, DigestDaily, DigestWeekly}
+
+// DigestRecipient is a user due for a digest.
+type DigestRecipient struct {
+	ID       int64
+	Username string
+	Email    string
+	Locale   string
+}
+
+type DigestStore struct {
+	db *sql.DB
+}
+
+// GetRecipients returns up to limit active users after afterID, by id, who
+// want digests at frequency, did not sign in since inactiveSince and have no
+// digest recorded for the period starting at period.
+func (s *DigestStore) GetRecipients(ctx context.Context, frequency string, period, inactiveSince time.Time, afterID int64, limit int) ([]DigestRecipient, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.locale
+		FROM users u
+		WHERE u.is_active AND
+			u.digest_frequency = $1 AND
+			(u.last_login_at IS NULL OR u.last_login_at < $3) AND
+			u.id > $4 AND
+			NOT EXISTS (
+				SELECT 1 FROM digest_sends ds
+				WHERE ds.user_id = u.id AND ds.frequency = $1 AND ds.period_start = $2
+			)
+		ORDER BY u.id
+		LIMIT $5
+	`
+	rows, err := s.db.QueryContext(ctx, query, frequency, period, inactiveSince, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []DigestRecipient{}
+	for rows.Next() {
+		var r DigestRecipient
+		if err := rows.Scan(&r.ID, &r.Username, &r.Email, &r.Locale); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+
+	return recipients, rows.Err()
+}
+
+// GetNewFollowers returns the usernames of up to limit users who started
+// following userID since since, newest first, and how many there are in all.
+func (s *DigestStore) GetNewFollowers(ctx context.Context, userID int64, since time.Time, limit int) ([]string, int, error) {
+	query := `
+		SELECT u.username, COUNT(*) OVER ()
+		FROM followers f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.follower_id = $1 AND f.created_at >= $2
+		ORDER BY f.created_at DESC
+		LIMIT $3
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID, since, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var (
+		usernames []string
+		total     int
+	)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username, &total); err != nil {
+			return nil, 0, err
+		}
+		usernames = append(usernames, username)
+	}
+
+	return usernames, total, rows.Err()
+}
+
+// Record records the digest of userID for the period starting at period and
+// queues email with it. It reports false, queueing nothing, when the digest
+// was already recorded.
+func (s *DigestStore) Record(ctx context.Context, userID int64, frequency string, period time.Time, email *OutboxMessage) (bool, error) {
+	var recorded bool
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO digest_sends (user_id, frequency, period_start)
+			VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+		`
+		res, err := tx.ExecContext(ctx, query, userID, frequency, period)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return nil
+		}
+
+		recorded = true
+		return enqueueOutbox(ctx, tx, email)
+	})
+
+	return recorded, err
+}
+
+func (s *DigestStore) GetFrequency(ctx context.Context, userID int64) (string, error) {
+	query := `
+		SELECT digest_frequency FROM users
+		WHERE id = $1 AND is_active = true
+	`
+	var frequency string
+	if err := s.db.QueryRowContext(ctx, query, userID).Scan(&frequency); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return frequency, nil
+}
+
+func (s *DigestStore) SetFrequency(ctx context.Context, userID int64, frequency string) error {
+	query := `
+		UPDATE users
+		SET digest_frequency = $1
+		WHERE id = $2
+	`
+	res, err := s.db.ExecContext(ctx, query, frequency, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// UserKey is the PEM encoded RSA key pair a user signs federated requests with.
+type UserKey struct {
+	UserID     int64
+	PublicKey  string
+	PrivateKey string
+}
+
+// RemoteFollower is an actor on another server following a local user.
+type RemoteFollower struct {
+	UserID  int64  `json:"user_id"`
+	ActorID string `json:"actor_id"`
+	Inbox   string `json:"inbox"`
+}
+
+// InboxActivity is an activity received in a local user's inbox.
+type InboxActivity struct {
+	ID      string
+	UserID  int64
+	ActorID string
+	Type    string
+	Object  string
+	Payload []byte
+}
+
+// FederationDelivery is an activity waiting to be posted to a remote inbox.
+type FederationDelivery struct {
+	ID       int64
+	UserID   int64
+	Inbox    string
+	Payload  []byte
+	Attempts int
+}
+
+type FederationStore struct {
+	db *sql.DB
+}
+
+func (s *FederationStore) GetKey(ctx context.Context, userID int64) (*UserKey, error) {
+	query := `
+		SELECT user_id, public_key, private_key
+		FROM user_keys
+		WHERE user_id = $1
+	`
+	var key UserKey
+	if err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&key.UserID,
+		&key.PublicKey,
+		&key.PrivateKey,
+	); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &key, nil
+}
+
+// CreateKey stores a key pair unless the user already has one.
+func (s *FederationStore) CreateKey(ctx context.Context, key *UserKey) error {
+	query := `
+		INSERT INTO user_keys (user_id, public_key, private_key)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO NOTHING
+	`
+	_, err := s.db.ExecContext(ctx, query, key.UserID, key.PublicKey, key.PrivateKey)
+	return err
+}
+
+func (s *FederationStore) AddRemoteFollower(ctx context.Context, follower *RemoteFollower) error {
+	query := `
+		INSERT INTO remote_followers (user_id, actor_id, inbox)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, actor_id) DO UPDATE SET inbox = EXCLUDED.inbox
+	`
+	_, err := s.db.ExecContext(ctx, query, follower.UserID, follower.ActorID, follower.Inbox)
+	return err
+}
+
+func (s *FederationStore) RemoveRemoteFollower(ctx context.Context, userID int64, actorID string) error {
+	query := `
+		DELETE FROM remote_followers
+		WHERE user_id = $1 AND actor_id = $2
+	`
+	_, err := s.db.ExecContext(ctx, query, userID, actorID)
+	return err
+}
+
+func (s *FederationStore) GetRemoteFollowers(ctx context.Context, userID int64) ([]RemoteFollower, error) {
+	query := `
+		SELECT user_id, actor_id, inbox
+		FROM remote_followers
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	followers := []RemoteFollower{}
+	for rows.Next() {
+		var f RemoteFollower
+		if err := rows.Scan(&f.UserID, &f.ActorID, &f.Inbox); err != nil {
+			return nil, err
+		}
+		followers = append(followers, f)
+	}
+
+	return followers, rows.Err()
+}
+
+// HasActivity reports whether the activity was already received, so
+// redeliveries are processed once.
+func (s *FederationStore) HasActivity(ctx context.Context, activityID string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM inbox_activities WHERE id = $1)`
+
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, query, activityID).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// RecordActivity stores a received activity once it has been processed.
+func (s *FederationStore) RecordActivity(ctx context.Context, activity *InboxActivity) error {
+	query := `
+		INSERT INTO inbox_activities (id, user_id, actor_id, type, object, payload)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO NOTHING
+	`
+	_, err := s.db.ExecContext(
+		ctx,
+		query,
+		activity.ID,
+		activity.UserID,
+		activity.ActorID,
+		activity.Type,
+		activity.Object,
+		activity.Payload,
+	)
+	return err
+}
+
+// EnqueueDeliveries schedules payload to be posted to every inbox on behalf of userID.
+func (s *FederationStore) EnqueueDeliveries(ctx context.Context, userID int64, inboxes []string, payload []byte) error {
+	if len(inboxes) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO federation_deliveries (user_id, inbox, payload)
+		SELECT $1, inbox, $3
+		FROM unnest($2::text[]) AS inbox
+	`
+	_, err := s.db.ExecContext(ctx, query, userID, pq.Array(inboxes), payload)
+	return err
+}
+
+// ClaimDeliveries picks up to limit due deliveries and hides them from other
+// workers for lease, after which an unfinished delivery is picked up again.
+func (s *FederationStore) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]FederationDelivery, error) {
+	query := `
+		UPDATE federation_deliveries
+		SET attempts = attempts + 1,
+			next_attempt_at = now() + $2 * interval '1 second'
+		WHERE id IN (
+			SELECT id FROM federation_deliveries
+			WHERE delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, inbox, payload, attempts
+	`
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []FederationDelivery
+	for rows.Next() {
+		var d FederationDelivery
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Inbox, &d.Payload, &d.Attempts); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (s *FederationStore) MarkDelivered(ctx context.Context, deliveryID int64) error {
+	query := `
+		UPDATE federation_deliveries
+		SET delivered_at = now(), last_error = ''
+		WHERE id = $1
+	`
+	_, err := s.db.ExecContext(ctx, query, deliveryID)
+	return err
+}
+
+// MarkFailed records a failed attempt. The delivery is retried at retryAt, or
+// given up on when retryAt is nil.
+func (s *FederationStore) MarkFailed(ctx context.Context, deliveryID int64, reason string, retryAt *time.Time) error {
+	query := `
+		UPDATE federation_deliveries
+		SET last_error = $2,
+			next_attempt_at = COALESCE($3, next_attempt_at),
+			failed_at = CASE WHEN $3::timestamptz IS NULL THEN now() END
+		WHERE id = $1
+	`
+	_, err := s.db.ExecContext(ctx, query, deliveryID, reason, retryAt)
+	return err
+}
@@ -32,3 +32,50 @@ func (s *FollowerStore) UnFollow(ctx context.Context, followedID, userID int64)
 	_, err := s.db.ExecContext(ctx, query, followedID, userID)
 	return err
 }
+
+// GetFollowerIDs returns the users following userID.
+func (s *FollowerStore) GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	query := `
+		SELECT user_id FROM followers
+		WHERE follower_id = $1
+	`
+	return s.queryIDs(ctx, query, userID)
+}
+
+// GetFollowingIDs returns the users userID follows.
+func (s *FollowerStore) GetFollowingIDs(ctx context.Context, userID int64) ([]int64, error) {
+	query := `
+		SELECT follower_id FROM followers
+		WHERE user_id = $1
+	`
+	return s.queryIDs(ctx, query, userID)
+}
+
+func (s *FollowerStore) CountFollowers(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM followers
+		WHERE follower_id = $1
+	`
+	var count int
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+func (s *FollowerStore) queryIDs(ctx context.Context, query string, args ...any) ([]int64, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Job is a unit of background work of a kind, run by the workers of its queue.
+type Job struct {
+	ID    int64
+	Queue string
+	Kind  string
+	Args  []byte
+	// UniqueKey, when set, keeps a second job with the same key from being
+	// queued while the first is pending or running
+	UniqueKey   string
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time
+}
+
+type JobStore struct {
+	db *sql.DB
+}
+
+// Enqueue stores a pending job. It reports false when a job with the same
+// unique key is already pending or running.
+func (s *JobStore) Enqueue(ctx context.Context, job *Job) (bool, error) {
+	query := `
+		INSERT INTO jobs (queue, kind, args, unique_key, max_attempts, run_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, COALESCE($6, now()))
+		ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL AND status IN ('pending', 'running')
+		DO NOTHING
+		RETURNING id
+	`
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		job.Queue,
+		job.Kind,
+		job.Args,
+		job.UniqueKey,
+		job.MaxAttempts,
+		runAt,
+	).Scan(&job.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Claim starts up to limit due jobs of queue, including running jobs whose
+// worker vanished, and leases them for lease.
+func (s *JobStore) Claim(ctx context.Context, queue string, limit int, lease time.Duration) ([]Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'running',
+			attempts = attempts + 1,
+			locked_until = now() + $3 * interval '1 second'
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE queue = $1 AND (
+				(status = 'pending' AND run_at <= now()) OR
+				(status = 'running' AND locked_until < now())
+			)
+			ORDER BY run_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, queue, kind, args, COALESCE(unique_key, ''), attempts, max_attempts, run_at
+	`
+	rows, err := s.db.QueryContext(ctx, query, queue, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var j Job
+		err := rows.Scan(
+			&j.ID,
+			&j.Queue,
+			&j.Kind,
+			&j.Args,
+			&j.UniqueKey,
+			&j.Attempts,
+			&j.MaxAttempts,
+			&j.RunAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, rows.Err()
+}
+
+// Complete records that the claimed attempt of job succeeded. Attempts is a
+// fencing token: once the lease expired and another worker claimed the job,
+// the outcome of the earlier attempt is dropped with ErrLeaseLost.
+func (s *JobStore) Complete(ctx context.Context, job *Job) error {
+	query := `
+		UPDATE jobs
+		SET status = 'completed', finished_at = now(), locked_until = NULL, last_error = ''
+		WHERE id = $1 AND status = 'running' AND attempts = $2
+	`
+	res, err := s.db.ExecContext(ctx, query, job.ID, job.Attempts)
+	if err != nil {
+		return err
+	}
+	return leaseHeld(res)
+}
+
+// Fail records a failed attempt of job like Complete. The job runs again at
+// retryAt, or is given up on when retryAt is nil.
+func (s *JobStore) Fail(ctx context.Context, job *Job, reason string, retryAt *time.Time) error {
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN $4::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+			last_error = $3,
+			run_at = COALESCE($4, run_at),
+			finished_at = CASE WHEN $4::timestamptz IS NULL THEN now() END,
+			locked_until = NULL
+		WHERE id = $1 AND status = 'running' AND attempts = $2
+	`
+	res, err := s.db.ExecContext(ctx, query, job.ID, job.Attempts, reason, retryAt)
+	if err != nil {
+		return err
+	}
+	return leaseHeld(res)
+}
+
+func leaseHeld(res sql.Result) error {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// DeleteFinished removes completed and failed jobs that finished before before.
+func (s *JobStore) DeleteFinished(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM jobs
+		WHERE finished_at < $1
+	`
+	res, err := s.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
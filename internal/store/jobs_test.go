@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobOutcomeOfExpiredLeaseIsDropped(t *testing.T) {
+	s, _ := testStorage(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"complete", "fail"} {
+		t.Run(name, func(t *testing.T) {
+			queue := "test_" + name
+			if _, err := s.Jobs.Enqueue(ctx, &Job{Queue: queue, Kind: "echo", Args: []byte(`{}`), MaxAttempts: 3}); err != nil {
+				t.Fatal(err)
+			}
+
+			// the first lease is already over, so the job is claimed again
+			first := claimOne(t, s, queue, -time.Second)
+			second := claimOne(t, s, queue, time.Minute)
+			if second.Attempts != first.Attempts+1 {
+				t.Fatalf("claimed again at attempt %d, want %d", second.Attempts, first.Attempts+1)
+			}
+
+			outcome := func(job *Job) error {
+				if name == "complete" {
+					return s.Jobs.Complete(ctx, job)
+				}
+				return s.Jobs.Fail(ctx, job, "boom", nil)
+			}
+
+			if err := outcome(&first); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("outcome of the expired attempt = %v, want ErrLeaseLost", err)
+			}
+			if err := outcome(&second); err != nil {
+				t.Errorf("outcome of the current attempt = %v", err)
+			}
+			if err := outcome(&second); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("second outcome of the same attempt = %v, want ErrLeaseLost", err)
+			}
+		})
+	}
+}
+
+func claimOne(t *testing.T, s Storage, queue string, lease time.Duration) Job {
+	t.Helper()
+
+	jobs, err := s.Jobs.Claim(context.Background(), queue, 1, lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("claimed %d jobs, want 1", len(jobs))
+	}
+	return jobs[0]
+}
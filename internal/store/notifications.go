@@ -0,0 +1,236 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+const (
+	NotificationFollow   = "follow"
+	NotificationComment  = "comment"
+	NotificationReply    = "reply"
+	NotificationMention  = "mention"
+	NotificationReaction = "reaction"
+)
+
+// NotificationTypes lists every type a user can turn off.
+var NotificationTypes = []string{
+	NotificationFollow,
+	NotificationComment,
+	NotificationReply,
+	NotificationMention,
+	NotificationReaction,
+}
+
+type Notification struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	ActorID   int64  `json:"actor_id"`
+	Type      string `json:"type"`
+	PostID    *int64 `json:"post_id"`
+	CommentID *int64 `json:"comment_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+// NotificationGroup folds the notifications of one type about the same post
+// into a single entry, e.g. everyone who commented on it. ID is the newest
+// notification of the group.
+type NotificationGroup struct {
+	ID         int64    `json:"id"`
+	Type       string   `json:"type"`
+	PostID     *int64   `json:"post_id"`
+	CommentID  *int64   `json:"comment_id"`
+	Actors     []string `json:"actors"`
+	ActorCount int      `json:"actor_count"`
+	Count      int      `json:"count"`
+	Unread     bool     `json:"unread"`
+	CreatedAt  string   `json:"created_at"`
+	Message    string   `json:"message"`
+}
+
+type NotificationStore struct {
+	db *sql.DB
+}
+
+// Create stores a notification unless the recipient turned its type off or
+// is the actor.
+func (s *NotificationStore) Create(ctx context.Context, n *Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id)
+		SELECT $1::bigint, $2::bigint, $3::varchar, $4::bigint, $5::bigint
+		WHERE $1 <> $2 AND NOT EXISTS (
+			SELECT 1 FROM notification_preferences
+			WHERE user_id = $1 AND type = $3 AND enabled = false
+		)
+		RETURNING id, created_at
+	`
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		n.UserID,
+		n.ActorID,
+		n.Type,
+		n.PostID,
+		n.CommentID,
+	).Scan(&n.ID, &n.CreatedAt)
+	if err == sql.ErrNoRows {
+		// filtered out
+		return nil
+	}
+	return err
+}
+
+// GetGroups returns a page of userID's notifications grouped by type and
+// post, newest first. Read and unread notifications are grouped apart.
+func (s *NotificationStore) GetGroups(ctx context.Context, userID int64, nq PaginatedNotificationsQuery) ([]NotificationGroup, error) {
+	query := `
+		SELECT
+			MAX(n.id),
+			n.type,
+			n.post_id,
+			(array_agg(n.comment_id ORDER BY n.id DESC))[1],
+			array_agg(u.username ORDER BY n.id DESC),
+			COUNT(DISTINCT n.actor_id),
+			COUNT(*),
+			n.read_at IS NULL,
+			MAX(n.created_at)
+		FROM notifications n
+		JOIN users u ON u.id = n.actor_id
+		WHERE n.user_id = $1 AND ($2 = false OR n.read_at IS NULL)
+		GROUP BY n.type, n.post_id, n.read_at IS NULL
+		ORDER BY MAX(n.id) DESC
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID, nq.Unread, nq.Limit, nq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []NotificationGroup{}
+	for rows.Next() {
+		var g NotificationGroup
+		err := rows.Scan(
+			&g.ID,
+			&g.Type,
+			&g.PostID,
+			&g.CommentID,
+			pq.Array(&g.Actors),
+			&g.ActorCount,
+			&g.Count,
+			&g.Unread,
+			&g.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		g.Actors = uniqueActors(g.Actors)
+		groups = append(groups, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// uniqueActors drops repeated actors, keeping the latest occurrence of each
+// in front.
+func uniqueActors(actors []string) []string {
+	seen := make(map[string]bool, len(actors))
+	unique := actors[:0]
+	for _, a := range actors {
+		if !seen[a] {
+			seen[a] = true
+			unique = append(unique, a)
+		}
+	}
+	return unique
+}
+
+func (s *NotificationStore) CountUnread(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL
+	`
+	var count int
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// MarkGroupRead marks the group ending at notificationID as read.
+func (s *NotificationStore) MarkGroupRead(ctx context.Context, userID, notificationID int64) error {
+	query := `
+		UPDATE notifications n
+		SET read_at = now()
+		FROM notifications g
+		WHERE g.id = $2 AND g.user_id = $1
+			AND n.user_id = $1
+			AND n.type = g.type
+			AND n.post_id IS NOT DISTINCT FROM g.post_id
+			AND n.id <= g.id
+			AND n.read_at IS NULL
+	`
+	_, err := s.db.ExecContext(ctx, query, userID, notificationID)
+	return err
+}
+
+func (s *NotificationStore) MarkAllRead(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE notifications
+		SET read_at = now()
+		WHERE user_id = $1 AND read_at IS NULL
+	`
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// GetPreferences returns whether each notification type is enabled for userID.
+func (s *NotificationStore) GetPreferences(ctx context.Context, userID int64) (map[string]bool, error) {
+	query := `
+		SELECT type, enabled FROM notification_preferences
+		WHERE user_id = $1
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := make(map[string]bool, len(NotificationTypes))
+	for _, t := range NotificationTypes {
+		prefs[t] = true
+	}
+
+	for rows.Next() {
+		var (
+			t       string
+			enabled bool
+		)
+		if err := rows.Scan(&t, &enabled); err != nil {
+			return nil, err
+		}
+		prefs[t] = enabled
+	}
+
+	return prefs, rows.Err()
+}
+
+func (s *NotificationStore) SetPreferences(ctx context.Context, userID int64, prefs map[string]bool) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO notification_preferences (user_id, type, enabled)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled
+		`
+		for t, enabled := range prefs {
+			if _, err := tx.ExecContext(ctx, query, userID, t, enabled); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestUniqueActorsKeepsLatestFirst(t *testing.T) {
+	// as aggregated by GetGroups, newest notification first
+	actors := []string{"zoe", "adam", "zoe", "mia", "adam"}
+
+	got := uniqueActors(actors)
+	want := []string{"zoe", "adam", "mia"}
+	if !slices.Equal(got, want) {
+		t.Errorf("uniqueActors = %v, want %v", got, want)
+	}
+}
+
+func TestNotificationGroups(t *testing.T) {
+	s, db := testStorage(t)
+	ctx := context.Background()
+
+	owner := createTestUser(t, db, "owner")
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+
+	post := &Post{Title: "Hello", Content: "world", UserID: owner, Tags: []string{}}
+	if err := s.Posts.Create(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+
+	notify := func(actorID int64, typ string, postID *int64) int64 {
+		t.Helper()
+		n := &Notification{UserID: owner, ActorID: actorID, Type: typ, PostID: postID}
+		if err := s.Notifications.Create(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+		return n.ID
+	}
+
+	notify(alice, NotificationComment, &post.ID)
+	notify(bob, NotificationComment, &post.ID)
+	lastComment := notify(alice, NotificationComment, &post.ID)
+	follow := notify(bob, NotificationFollow, nil)
+	if id := notify(owner, NotificationComment, &post.ID); id != 0 {
+		t.Errorf("notification of the owner's own comment stored as %d, want it left out", id)
+	}
+
+	groups, err := s.Notifications.GetGroups(ctx, owner, PaginatedNotificationsQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGroups(t, groups, []NotificationGroup{
+		{ID: follow, Type: NotificationFollow, Actors: []string{"bob"}, ActorCount: 1, Count: 1, Unread: true},
+		{ID: lastComment, Type: NotificationComment, PostID: &post.ID, Actors: []string{"alice", "bob"}, ActorCount: 2, Count: 3, Unread: true},
+	})
+
+	// read notifications are grouped apart from the ones arriving later
+	if err := s.Notifications.MarkGroupRead(ctx, owner, lastComment); err != nil {
+		t.Fatal(err)
+	}
+	newComment := notify(bob, NotificationComment, &post.ID)
+
+	groups, err = s.Notifications.GetGroups(ctx, owner, PaginatedNotificationsQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGroups(t, groups, []NotificationGroup{
+		{ID: newComment, Type: NotificationComment, PostID: &post.ID, Actors: []string{"bob"}, ActorCount: 1, Count: 1, Unread: true},
+		{ID: follow, Type: NotificationFollow, Actors: []string{"bob"}, ActorCount: 1, Count: 1, Unread: true},
+		{ID: lastComment, Type: NotificationComment, PostID: &post.ID, Actors: []string{"alice", "bob"}, ActorCount: 2, Count: 3},
+	})
+
+	groups, err = s.Notifications.GetGroups(ctx, owner, PaginatedNotificationsQuery{Limit: 10, Unread: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Errorf("got %d unread groups, want 2", len(groups))
+	}
+
+	unread, err := s.Notifications.CountUnread(ctx, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unread != 2 {
+		t.Errorf("CountUnread = %d, want 2", unread)
+	}
+}
+
+// assertGroups compares the grouping of got with want, leaving out the
+// fields set by the database.
+func assertGroups(t *testing.T, got, want []NotificationGroup) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d groups %+v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.ID != w.ID || g.Type != w.Type || !equalIDs(g.PostID, w.PostID) ||
+			!slices.Equal(g.Actors, w.Actors) || g.ActorCount != w.ActorCount ||
+			g.Count != w.Count || g.Unread != w.Unread {
+			t.Errorf("group %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func equalIDs(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
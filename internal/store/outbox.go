@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// OutboxMessage is a message for a background handler, stored together with
+// the change it belongs to so neither is lost without the other.
+type OutboxMessage struct {
+	ID    int64
+	Topic string
+	// Key makes enqueueing idempotent
+	Key      string
+	Payload  []byte
+	Attempts int
+}
+
+type OutboxStore struct {
+	db *sql.DB
+}
+
+// Enqueue stores msg as part of tx. A message with the same key is only
+// stored once.
+func (s *OutboxStore) Enqueue(ctx context.Context, tx *sql.Tx, msg *OutboxMessage) error {
+	return enqueueOutbox(ctx, tx, msg)
+}
+
+func enqueueOutbox(ctx context.Context, tx *sql.Tx, msg *OutboxMessage) error {
+	query := `
+		INSERT INTO outbox_messages (topic, key, payload)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, query, msg.Topic, msg.Key, msg.Payload)
+	return err
+}
+
+// Claim picks up to limit due messages and hides them from other
+// dispatchers for lease, after which an unfinished message is picked up again.
+func (s *OutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	query := `
+		UPDATE outbox_messages
+		SET attempts = attempts + 1,
+			next_attempt_at = now() + $2 * interval '1 second'
+		WHERE id IN (
+			SELECT id FROM outbox_messages
+			WHERE processed_at IS NULL AND dead_at IS NULL AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, topic, key, payload, attempts
+	`
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.Topic, &m.Key, &m.Payload, &m.Attempts); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// MarkProcessed records that a message was handled and drops its payload,
+// which may carry secrets such as the token of an activation link.
+func (s *OutboxStore) MarkProcessed(ctx context.Context, messageID int64) error {
+	query := `
+		UPDATE outbox_messages
+		SET processed_at = now(), last_error = '', payload = '{}'
+		WHERE id = $1
+	`
+	_, err := s.db.ExecContext(ctx, query, messageID)
+	return err
+}
+
+// MarkFailed records a failed attempt. The message is retried at retryAt, or
+// moved to the dead letters when retryAt is nil, dropping its payload like
+// MarkProcessed does.
+func (s *OutboxStore) MarkFailed(ctx context.Context, messageID int64, reason string, retryAt *time.Time) error {
+	query := `
+		UPDATE outbox_messages
+		SET last_error = $2,
+			next_attempt_at = COALESCE($3, next_attempt_at),
+			dead_at = CASE WHEN $3::timestamptz IS NULL THEN now() END,
+			payload = CASE WHEN $3::timestamptz IS NULL THEN '{}' ELSE payload END
+		WHERE id = $1
+	`
+	_, err := s.db.ExecContext(ctx, query, messageID, reason, retryAt)
+	return err
+}
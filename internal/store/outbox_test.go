@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOutboxDropsPayloadOfFinishedMessages(t *testing.T) {
+	s, db := testStorage(t)
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"processed", "retried", "dead"} {
+		msg := &OutboxMessage{Topic: "test", Key: key, Payload: []byte(`{"token":"secret"}`)}
+		if err := s.Outbox.Enqueue(ctx, tx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := s.Outbox.Claim(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]int64)
+	for _, m := range messages {
+		ids[m.Key] = m.ID
+	}
+
+	retryAt := time.Now().Add(time.Minute)
+	if err := s.Outbox.MarkProcessed(ctx, ids["processed"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Outbox.MarkFailed(ctx, ids["retried"], "timeout", &retryAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Outbox.MarkFailed(ctx, ids["dead"], "timeout", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"processed": `{}`,
+		"retried":   `{"token": "secret"}`,
+		"dead":      `{}`,
+	}
+	for key, payload := range want {
+		var got string
+		err := db.QueryRowContext(ctx, `SELECT payload FROM outbox_messages WHERE key = $1`, key).Scan(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != payload {
+			t.Errorf("payload of %s message = %s, want %s", key, got, payload)
+		}
+	}
+}
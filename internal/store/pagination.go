@@ -1,6 +1,12 @@
 package store
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -8,35 +14,49 @@ import (
 )
 
 type PaginatedFeedQuery struct {
-	Limit  int      `json:"limit" validate:"min=1,max=100"`
-	Offset int      `json:"offset" validate:"min=0"`
-	Sort   string   `json:"sort" validate:"oneof=asc desc"`
-	Tags   []string `json:"tags" validate:"max=5"`
-	Search string   `json:"search" validate:"max=100"`
-	Since  string   `json:"since"`
-	Until  string   `json:"until"`
+	Limit  int        `json:"limit" validate:"min=1,max=100"`
+	Offset int        `json:"offset" validate:"min=0"`
+	Sort   string     `json:"sort" validate:"oneof=asc desc top"`
+	Tags   []string   `json:"tags" validate:"max=5"`
+	Search string     `json:"search" validate:"max=100"`
+	Since  *time.Time `json:"since"`
+	Until  *time.Time `json:"until"`
+	Cursor string     `json:"cursor" validate:"max=512"`
+	// Keyset is the decoded Cursor. When set the feed is paginated from it
+	// and Offset is ignored.
+	Keyset *FeedCursor `json:"-"`
+	// ScoreDecay is the ranking decay, used to score the posts the scorer
+	// has not reached yet by their age alone.
+	ScoreDecay time.Duration `json:"-"`
 }
 
+// Parse reads the feed query string on top of the defaults in fq. Every
+// malformed parameter is reported in the returned error.
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
 	qs := r.URL.Query()
+	var errs []error
 
 	// pagination
 	if limit := qs.Get("limit"); limit != "" {
 		l, err := strconv.Atoi(limit)
 		if err != nil {
-			return fq, nil
-
+			errs = append(errs, fmt.Errorf("limit: %q is not an integer", limit))
+		} else {
+			fq.Limit = l
 		}
-		fq.Limit = l
 	}
 
 	if offset := qs.Get("offset"); offset != "" {
 		f, err := strconv.Atoi(offset)
 		if err != nil {
-			return fq, nil
+			errs = append(errs, fmt.Errorf("offset: %q is not an integer", offset))
+		} else {
+			fq.Offset = f
 		}
-		fq.Offset = f
+	}
 
+	if cursor := qs.Get("cursor"); cursor != "" {
+		fq.Cursor = cursor
 	}
 
 	// sort
@@ -54,21 +74,228 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	}
 
 	if since := qs.Get("since"); since != "" {
-		fq.Since = parseTime(since)
+		t, err := parseTime(since, false)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("since: %w", err))
+		} else {
+			fq.Since = &t
+		}
 	}
 
 	if until := qs.Get("until"); until != "" {
-		fq.Until = parseTime(until)
+		t, err := parseTime(until, true)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("until: %w", err))
+		} else {
+			fq.Until = &t
+		}
 	}
 
-	return fq, nil
+	if fq.Since != nil && fq.Until != nil && fq.Since.After(*fq.Until) {
+		errs = append(errs, errors.New("since: must not be after until"))
+	}
+
+	return fq, errors.Join(errs...)
+}
+
+// FeedCursor is the keyset position of a post on a feed page. Backward
+// cursors point to the page before the post instead of the one after it.
+type FeedCursor struct {
+	CreatedAt string  `json:"t"`
+	Score     float64 `json:"sc,omitempty"`
+	ID        int64   `json:"id"`
+	Sort      string  `json:"s"`
+	Backward  bool    `json:"b,omitempty"`
 }
 
-func parseTime(value string) string {
-	t, err := time.Parse(time.DateTime, value)
+// Encode returns the cursor as an opaque string signed with secret so clients
+// can not forge positions.
+func (c FeedCursor) Encode(secret string) string {
+	data, _ := json.Marshal(c)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + signCursor(payload, secret)
+}
+
+func DecodeFeedCursor(value, secret string) (*FeedCursor, error) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(signCursor(payload, secret))) {
+		return nil, ErrInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
 	if err != nil {
-		return ""
+		return nil, ErrInvalidCursor
+	}
+
+	var c FeedCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.Sort != "asc" && c.Sort != "desc" && c.Sort != "top" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+func signCursor(payload, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseTime accepts RFC3339 timestamps, dates and the legacy "2006-01-02 15:04:05"
+// format in UTC. A date used as an upper bound covers the whole day.
+func parseTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		if endOfDay {
+			// timestamps are stored with second precision
+			t = t.AddDate(0, 0, 1).Add(-time.Second)
+		}
+		return t, nil
+	}
+
+	if t, err := time.Parse(time.DateTime, value); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not an RFC3339 timestamp or a YYYY-MM-DD date", value)
+}
+
+type PaginatedCommentsQuery struct {
+	Limit  int    `json:"limit" validate:"min=1,max=100"`
+	Sort   string `json:"sort" validate:"oneof=newest oldest top"`
+	Cursor string `json:"cursor"`
+}
+
+func (pq PaginatedCommentsQuery) Parse(r *http.Request) (PaginatedCommentsQuery, error) {
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return pq, err
+		}
+		pq.Limit = l
+	}
+
+	if sort := qs.Get("sort"); sort != "" {
+		pq.Sort = sort
+	}
+
+	if cursor := qs.Get("cursor"); cursor != "" {
+		pq.Cursor = cursor
+	}
+
+	return pq, nil
+}
+
+// CommentCursor is the keyset position of the last comment on a page.
+// Reactions is only used when sorting by top.
+type CommentCursor struct {
+	Reactions int    `json:"r,omitempty"`
+	CreatedAt string `json:"t"`
+	ID        int64  `json:"id"`
+}
+
+func (c CommentCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCommentCursor(value string) (CommentCursor, error) {
+	var c CommentCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, c.CreatedAt); err != nil || c.ID <= 0 {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+type PaginatedSearchQuery struct {
+	Query  string `json:"q" validate:"required,max=100"`
+	Limit  int    `json:"limit" validate:"min=1,max=100"`
+	Offset int    `json:"offset" validate:"min=0"`
+}
+
+func (sq PaginatedSearchQuery) Parse(r *http.Request) (PaginatedSearchQuery, error) {
+	qs := r.URL.Query()
+	var errs []error
+
+	sq.Query = strings.TrimSpace(qs.Get("q"))
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("limit: %q is not an integer", limit))
+		} else {
+			sq.Limit = l
+		}
+	}
+
+	if offset := qs.Get("offset"); offset != "" {
+		f, err := strconv.Atoi(offset)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("offset: %q is not an integer", offset))
+		} else {
+			sq.Offset = f
+		}
+	}
+
+	return sq, errors.Join(errs...)
+}
+
+type PaginatedNotificationsQuery struct {
+	Limit  int  `json:"limit" validate:"min=1,max=100"`
+	Offset int  `json:"offset" validate:"min=0"`
+	Unread bool `json:"unread"`
+}
+
+func (nq PaginatedNotificationsQuery) Parse(r *http.Request) (PaginatedNotificationsQuery, error) {
+	qs := r.URL.Query()
+	var errs []error
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("limit: %q is not an integer", limit))
+		} else {
+			nq.Limit = l
+		}
+	}
+
+	if offset := qs.Get("offset"); offset != "" {
+		f, err := strconv.Atoi(offset)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("offset: %q is not an integer", offset))
+		} else {
+			nq.Offset = f
+		}
+	}
+
+	if unread := qs.Get("unread"); unread != "" {
+		u, err := strconv.ParseBool(unread)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unread: %q is not a boolean", unread))
+		} else {
+			nq.Unread = u
+		}
 	}
 
-	return t.Format(time.DateTime)
+	return nq, errors.Join(errs...)
 }
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		endOfDay bool
+		want     time.Time
+		wantErr  bool
+	}{
+		{
+			name:  "RFC3339",
+			value: "2024-03-10T12:30:00Z",
+			want:  time.Date(2024, 3, 10, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "RFC3339 with offset",
+			value: "2024-03-10T12:30:00+02:00",
+			want:  time.Date(2024, 3, 10, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "RFC3339 upper bound is exact",
+			value:    "2024-03-10T12:30:00Z",
+			endOfDay: true,
+			want:     time.Date(2024, 3, 10, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "date",
+			value: "2024-03-10",
+			want:  time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "date upper bound covers the day",
+			value:    "2024-03-10",
+			endOfDay: true,
+			want:     time.Date(2024, 3, 10, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:     "date upper bound at the end of the year",
+			value:    "2024-12-31",
+			endOfDay: true,
+			want:     time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:  "date time",
+			value: "2024-03-10 12:30:00",
+			want:  time.Date(2024, 3, 10, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "date time upper bound is exact",
+			value:    "2024-03-10 12:30:00",
+			endOfDay: true,
+			want:     time.Date(2024, 3, 10, 12, 30, 0, 0, time.UTC),
+		},
+		{name: "garbage", value: "yesterday", wantErr: true},
+		{name: "invalid date", value: "2024-02-30", wantErr: true},
+		{name: "missing zone", value: "2024-03-10T12:30:00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTime(tt.value, tt.endOfDay)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTime(%q) = %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTime(%q): %v", tt.value, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseTime(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginatedFeedQueryParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "valid",
+			query: "limit=10&since=2024-03-01&until=2024-03-10T00:00:00Z",
+		},
+		{
+			name:  "every malformed parameter is reported",
+			query: "limit=ten&offset=-x&since=soon&until=later",
+			want: []string{
+				`limit: "ten" is not an integer`,
+				`offset: "-x" is not an integer`,
+				`since: "soon" is not an RFC3339 timestamp`,
+				`until: "later" is not an RFC3339 timestamp`,
+			},
+		},
+		{
+			name:  "since after until",
+			query: "since=2024-03-10&until=2024-03-01",
+			want:  []string{"since: must not be after until"},
+		},
+		{
+			name:  "same day",
+			query: "since=2024-03-10&until=2024-03-10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/user/feed?"+tt.query, nil)
+			_, err := PaginatedFeedQuery{Limit: 20, Sort: "desc"}.Parse(r)
+
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Parse: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Parse succeeded, want an error")
+			}
+
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tt.want) {
+				t.Fatalf("Parse error = %q, want %d joined errors", err, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("error %d = %q, want prefix %q", i, lines[i], want)
+				}
+			}
+		})
+	}
+}
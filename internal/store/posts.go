@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"strconv"
 
 	"github.com/lib/pq"
 )
@@ -24,6 +26,15 @@ type Post struct {
 type PostWithMetadata struct {
 	Post         `json:"post"`
 	CommentCount int `json:"comments_count"`
+	// Score is the ranking of the post in the top sort
+	Score float64 `json:"-"`
+}
+
+type PostSearchResult struct {
+	Post           `json:"post"`
+	Rank           float32 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
 }
 
 type PostStore struct {
@@ -103,9 +114,10 @@ func (s *PostStore) Update(ctx context.Context, post *Post) error {
 		SET content  = $1,
 			title = $2,
 			tags = $3,
+			updated_at = now(),
 			version = version + 1
 		WHERE id = $4 AND version = $5
-		RETURNING version 
+		RETURNING version, updated_at
 	`
 
 	err := s.db.QueryRowContext(ctx, query,
@@ -114,7 +126,7 @@ func (s *PostStore) Update(ctx context.Context, post *Post) error {
 		pq.Array(post.Tags),
 		post.ID,
 		post.Version,
-	).Scan(&post.Version)
+	).Scan(&post.Version, &post.UpdatedAt)
 
 	if err != nil {
 		switch {
@@ -127,7 +139,114 @@ func (s *PostStore) Update(ctx context.Context, post *Post) error {
 	return nil
 }
 
-func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+// FeedPage is a page of a feed plus the keyset positions of its neighbours.
+// Next and Prev are nil when there is no such page.
+type FeedPage struct {
+	Posts []PostWithMetadata
+	Next  *FeedCursor
+	Prev  *FeedCursor
+}
+
+// GetUserFeed returns the posts of userID and of the users they follow.
+// The top sort favours the authors userID interacts with the most.
+func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) (*FeedPage, error) {
+	return s.getFeedPage(ctx, fq, func(arg func(any) string) feedScope {
+		user := arg(userID)
+		return feedScope{
+			join: "LEFT JOIN user_affinities ua ON ua.user_id = " + user + " AND ua.author_id = p.user_id",
+			where: "(p.user_id = " + user + " OR p.user_id IN (" +
+				"SELECT follower_id FROM followers WHERE user_id = " + user + "))",
+			affinity: "ua.score",
+		}
+	})
+}
+
+// GetExploreFeed returns the posts of every active user.
+func (s *PostStore) GetExploreFeed(ctx context.Context, fq PaginatedFeedQuery) (*FeedPage, error) {
+	return s.getFeedPage(ctx, fq, func(func(any) string) feedScope {
+		return feedScope{where: "u.is_active = true"}
+	})
+}
+
+// feedScope is the extra join and where clause that pick the posts of a feed.
+// affinity, when set, is added to the post score in the top sort.
+type feedScope struct {
+	join     string
+	where    string
+	affinity string
+}
+
+// feedScopeFunc builds a feedScope. arg binds a query parameter and returns
+// its placeholder.
+type feedScopeFunc func(arg func(any) string) feedScope
+
+// feedOrder orders a feed by sortKey. Posts with the same key, like posts
+// with equal scores, are ordered by id so the order is deterministic and
+// pages never overlap or skip a post.
+func feedOrder(sortKey string, ascending bool) string {
+	if ascending {
+		return sortKey + " ASC, p.id ASC"
+	}
+	return sortKey + " DESC, p.id DESC"
+}
+
+// feedKeyset is the condition for the posts after the one at position and
+// id in the order of feedOrder.
+func feedKeyset(sortKey string, ascending bool, position, id string) string {
+	cmp := "<"
+	if ascending {
+		cmp = ">"
+	}
+	return "(" + sortKey + ", p.id) " + cmp + " (" + position + ", " + id + ")"
+}
+
+func (s *PostStore) getFeedPage(ctx context.Context, fq PaginatedFeedQuery, scopeFn feedScopeFunc) (*FeedPage, error) {
+	// walking backward from a cursor reads the feed in the opposite order
+	// and flips the rows afterwards
+	backward := fq.Keyset != nil && fq.Keyset.Backward
+	ascending := (fq.Sort == "asc") != backward
+
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	scope := scopeFn(arg)
+
+	// unscored posts rank like posts without engagement, see ranking.PostScore
+	unscored := "0"
+	if fq.ScoreDecay > 0 {
+		unscored = "extract(epoch from p.created_at)::float8 / " + arg(fq.ScoreDecay.Seconds())
+	}
+	score := "COALESCE(ps.score, " + unscored + ")"
+	if scope.affinity != "" {
+		score += " + COALESCE(" + scope.affinity + ", 0)"
+	}
+
+	sortKey := "p.created_at"
+	if fq.Sort == "top" {
+		sortKey = score
+	}
+
+	search := arg(toTSQuery(fq.Search))
+	tags := arg(pq.Array(fq.Tags))
+	since := arg(fq.Since)
+	until := arg(fq.Until)
+
+	keyset := ""
+	offset := fq.Offset
+	if fq.Keyset != nil {
+		offset = 0
+		var position any = fq.Keyset.CreatedAt
+		if fq.Sort == "top" {
+			position = fq.Keyset.Score
+		}
+		keyset = "AND " + feedKeyset(sortKey, ascending, arg(position), arg(fq.Keyset.ID))
+	}
+
+	// fetch one extra row to know if there is a further page
+	limit := arg(fq.Limit + 1)
 
 	query := `
 		SELECT 
@@ -139,26 +258,137 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 			p.version,
 			p.tags,
 			u.username,
-			COUNT(c.id) AS comments_count
+			COUNT(c.id) AS comments_count,
+			` + score + ` AS score
 		FROM posts p
 		LEFT JOIN comments c ON c.post_id = p.id
 		LEFT JOIN users u ON u.id = p.user_id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
+		LEFT JOIN post_scores ps ON ps.post_id = p.id
+		` + scope.join + `
 		WHERE 
-			(f.user_id = $1 OR p.user_id = $1) AND
-			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
-			(p.tags @> $5 OR $5 = '{}')
-		GROUP BY p.id, u.username 	
-		ORDER BY p.created_at ` + fq.Sort + `
-		LIMIT $2 OFFSET $3;
+			` + scope.where + ` AND
+			(` + search + ` = '' OR p.search_vector @@ to_tsquery('english', ` + search + `)) AND
+			(p.tags @> ` + tags + ` OR ` + tags + ` = '{}') AND
+			(` + since + `::timestamptz IS NULL OR p.created_at >= ` + since + `) AND
+			(` + until + `::timestamptz IS NULL OR p.created_at <= ` + until + `)
+			` + keyset + `
+		GROUP BY p.id, u.username, ps.score` + groupAffinity(scope) + `
+		ORDER BY ` + feedOrder(sortKey, ascending) + `
+		LIMIT ` + limit + ` OFFSET ` + arg(offset) + `;
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
+	var feed []PostWithMetadata
+	for rows.Next() {
+		var post PostWithMetadata
+		err := rows.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.User.Username,
+			&post.CommentCount,
+			&post.Score,
+		)
+		if err != nil {
+			return nil, err
+		}
+		feed = append(feed, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	hasMore := len(feed) > fq.Limit
+	if hasMore {
+		feed = feed[:fq.Limit]
+	}
+
+	if backward {
+		slices.Reverse(feed)
+	}
+
+	page := &FeedPage{Posts: feed}
+	if len(feed) == 0 {
+		return page, nil
+	}
+
+	first, last := feed[0], feed[len(feed)-1]
+
+	// forward pages have a next page when rows are left over, backward pages
+	// always do since they were reached from it
+	if hasMore || backward {
+		page.Next = &FeedCursor{CreatedAt: last.CreatedAt, Score: last.Score, ID: last.ID, Sort: fq.Sort}
+	}
+
+	if (backward && hasMore) || (!backward && (fq.Keyset != nil || fq.Offset > 0)) {
+		page.Prev = &FeedCursor{CreatedAt: first.CreatedAt, Score: first.Score, ID: first.ID, Sort: fq.Sort, Backward: true}
+	}
+
+	return page, nil
+}
+
+// GetIDsByAuthors returns the ids of the newest posts of the given authors
+// older than beforeID.
+func (s *PostStore) GetIDsByAuthors(ctx context.Context, authorIDs []int64, beforeID int64, limit int) ([]int64, error) {
+	query := `
+		SELECT id FROM posts
+		WHERE user_id = ANY($1) AND id < $2
+		ORDER BY id DESC
+		LIMIT $3
+	`
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(authorIDs), beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetFeedByIDs loads the given posts for a feed, newest first. Posts that no
+// longer exist are skipped.
+func (s *PostStore) GetFeedByIDs(ctx context.Context, ids []int64) ([]PostWithMetadata, error) {
+	query := `
+		SELECT 
+			p.id,
+			p.user_id,
+			p.title,
+			p.content,
+			p.created_at,
+			p.version,
+			p.tags,
+			u.username,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count
+		FROM posts p
+		LEFT JOIN users u ON u.id = p.user_id
+		WHERE p.id = ANY($1)
+		ORDER BY p.id DESC
+	`
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
 	var feed []PostWithMetadata
 	for rows.Next() {
 		var post PostWithMetadata
@@ -179,5 +409,194 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 		feed = append(feed, post)
 	}
 
-	return feed, nil
+	return feed, rows.Err()
+}
+
+// groupAffinity adds the affinity column of a scope to the feed GROUP BY.
+func groupAffinity(scope feedScope) string {
+	if scope.affinity == "" {
+		return ""
+	}
+	return ", " + scope.affinity
+}
+
+// React sets the reaction of userID to postID. It reports whether the user
+// had not reacted before, changing a reaction reports false.
+func (s *PostStore) React(ctx context.Context, postID, userID int64, reaction string) (bool, error) {
+	query := `
+		INSERT INTO post_reactions (post_id, user_id, reaction)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (post_id, user_id) DO UPDATE SET reaction = EXCLUDED.reaction
+		RETURNING xmax = 0
+	`
+	var inserted bool
+	err := s.db.QueryRowContext(ctx, query, postID, userID, reaction).Scan(&inserted)
+	return inserted, err
+}
+
+func (s *PostStore) Unreact(ctx context.Context, postID, userID int64) error {
+	query := `
+		DELETE FROM post_reactions
+		WHERE post_id = $1 AND user_id = $2
+	`
+	_, err := s.db.ExecContext(ctx, query, postID, userID)
+	return err
+}
+
+func (s *PostStore) Repost(ctx context.Context, postID, userID int64) error {
+	query := `
+		INSERT INTO reposts (post_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	_, err := s.db.ExecContext(ctx, query, postID, userID)
+	return err
+}
+
+func (s *PostStore) Unrepost(ctx context.Context, postID, userID int64) error {
+	query := `
+		DELETE FROM reposts
+		WHERE post_id = $1 AND user_id = $2
+	`
+	_, err := s.db.ExecContext(ctx, query, postID, userID)
+	return err
+}
+
+// Search runs a ranked full-text search over the posts of active users,
+// leaving out users that blocked viewerID or that viewerID blocked. Matches are wrapped in <mark> tags in TitleHighlight and Snippet.
+func (s *PostStore) Search(ctx context.Context, viewerID int64, sq PaginatedSearchQuery) ([]PostSearchResult, error) {
+	tsquery := toTSQuery(sq.Query)
+	if tsquery == "" {
+		return nil, ErrEmptySearch
+	}
+
+	query := `
+		SELECT
+			p.id,
+			p.user_id,
+			p.title,
+			p.content,
+			p.tags,
+			p.created_at,
+			p.updated_at,
+			p.version,
+			u.username,
+			ts_rank(p.search_vector, q) AS rank,
+			ts_headline('english', p.title, q, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'),
+			ts_headline('english', p.content, q, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10')
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		CROSS JOIN to_tsquery('english', $2) q
+		WHERE
+			p.search_vector @@ q AND
+			u.is_active = true AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.user_id = $1 AND b.blocked_id = p.user_id)
+					OR (b.user_id = p.user_id AND b.blocked_id = $1)
+			)
+		ORDER BY rank DESC, p.created_at DESC, p.id DESC
+		LIMIT $3 OFFSET $4;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, viewerID, tsquery, sq.Limit, sq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []PostSearchResult{}
+	for rows.Next() {
+		var r PostSearchResult
+		err := rows.Scan(
+			&r.ID,
+			&r.UserID,
+			&r.Title,
+			&r.Content,
+			pq.Array(&r.Tags),
+			&r.CreatedAt,
+			&r.UpdatedAt,
+			&r.Version,
+			&r.User.Username,
+			&r.Rank,
+			&r.TitleHighlight,
+			&r.Snippet,
+		)
+		if err != nil {
+			return nil, err
+		}
+		r.User.ID = r.UserID
+		results = append(results, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// GetPublicByAuthor returns the newest posts of an active user.
+func (s *PostStore) GetPublicByAuthor(ctx context.Context, userID int64, limit int) ([]Post, error) {
+	return s.getPublic(ctx, "p.user_id = $1", userID, limit)
+}
+
+// GetPublicByTag returns the newest posts of active users carrying tag.
+func (s *PostStore) GetPublicByTag(ctx context.Context, tag string, limit int) ([]Post, error) {
+	return s.getPublic(ctx, "$1 = ANY(p.tags)", tag, limit)
+}
+
+// getPublic lists the newest posts of active users matching scope, which must
+// reference its argument as $1.
+func (s *PostStore) getPublic(ctx context.Context, scope string, scopeArg any, limit int) ([]Post, error) {
+	query := `
+		SELECT
+			p.id,
+			p.user_id,
+			p.title,
+			p.content,
+			p.tags,
+			p.created_at,
+			p.updated_at,
+			p.version,
+			u.username
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE ` + scope + ` AND u.is_active = true
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $2;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, scopeArg, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			pq.Array(&p.Tags),
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.Version,
+			&p.User.Username,
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.User.ID = p.UserID
+		posts = append(posts, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
 }
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostEngagement is what a post's score is computed from.
+type PostEngagement struct {
+	PostID    int64
+	CreatedAt time.Time
+	Comments  int
+	Reactions int
+	Reposts   int
+	Score     float64
+}
+
+// Affinity is how often UserID interacted with the posts of AuthorID.
+type Affinity struct {
+	UserID       int64
+	AuthorID     int64
+	Interactions int
+	Score        float64
+}
+
+type RankingStore struct {
+	db *sql.DB
+}
+
+// GetPostEngagement returns the engagement of every post that was created,
+// commented, reacted to or reposted since the given time.
+func (s *RankingStore) GetPostEngagement(ctx context.Context, since time.Time) ([]PostEngagement, error) {
+	query := `
+		WITH touched AS (
+			SELECT id AS post_id FROM posts WHERE created_at >= $1
+			UNION
+			SELECT post_id FROM comments WHERE created_at >= $1
+			UNION
+			SELECT post_id FROM post_reactions WHERE created_at >= $1
+			UNION
+			SELECT post_id FROM reposts WHERE created_at >= $1
+		)
+		SELECT
+			p.id,
+			p.created_at,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL),
+			(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id),
+			(SELECT COUNT(*) FROM reposts rp WHERE rp.post_id = p.id)
+		FROM touched t
+		JOIN posts p ON p.id = t.post_id
+		ORDER BY p.id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []PostEngagement
+	for rows.Next() {
+		var e PostEngagement
+		if err := rows.Scan(&e.PostID, &e.CreatedAt, &e.Comments, &e.Reactions, &e.Reposts); err != nil {
+			return nil, err
+		}
+		posts = append(posts, e)
+	}
+
+	return posts, rows.Err()
+}
+
+func (s *RankingStore) SavePostScores(ctx context.Context, posts []PostEngagement) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(posts))
+	scores := make([]float64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.PostID
+		scores[i] = p.Score
+	}
+
+	query := `
+		INSERT INTO post_scores (post_id, score)
+		SELECT * FROM unnest($1::bigint[], $2::float8[])
+		ON CONFLICT (post_id) DO UPDATE SET score = EXCLUDED.score, updated_at = now()
+	`
+	_, err := s.db.ExecContext(ctx, query, pq.Array(ids), pq.Array(scores))
+	return err
+}
+
+// GetAffinities returns, for every user that interacted with another user's
+// posts since the given time, how many interactions they had within window.
+func (s *RankingStore) GetAffinities(ctx context.Context, since time.Time, window time.Duration) ([]Affinity, error) {
+	query := `
+		WITH interactions AS (
+			SELECT c.user_id, p.user_id AS author_id, c.created_at
+			FROM comments c JOIN posts p ON p.id = c.post_id
+			UNION ALL
+			SELECT r.user_id, p.user_id, r.created_at
+			FROM post_reactions r JOIN posts p ON p.id = r.post_id
+			UNION ALL
+			SELECT rp.user_id, p.user_id, rp.created_at
+			FROM reposts rp JOIN posts p ON p.id = rp.post_id
+		),
+		touched AS (
+			SELECT DISTINCT user_id, author_id FROM interactions
+			WHERE created_at >= $1 AND user_id <> author_id
+		)
+		SELECT
+			t.user_id,
+			t.author_id,
+			(
+				SELECT COUNT(*) FROM interactions i
+				WHERE i.user_id = t.user_id AND i.author_id = t.author_id AND i.created_at >= $2
+			)
+		FROM touched t
+		ORDER BY t.user_id, t.author_id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, since, time.Now().Add(-window))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var affinities []Affinity
+	for rows.Next() {
+		var a Affinity
+		if err := rows.Scan(&a.UserID, &a.AuthorID, &a.Interactions); err != nil {
+			return nil, err
+		}
+		affinities = append(affinities, a)
+	}
+
+	return affinities, rows.Err()
+}
+
+func (s *RankingStore) SaveAffinities(ctx context.Context, affinities []Affinity) error {
+	if len(affinities) == 0 {
+		return nil
+	}
+
+	userIDs := make([]int64, len(affinities))
+	authorIDs := make([]int64, len(affinities))
+	scores := make([]float64, len(affinities))
+	for i, a := range affinities {
+		userIDs[i] = a.UserID
+		authorIDs[i] = a.AuthorID
+		scores[i] = a.Score
+	}
+
+	query := `
+		INSERT INTO user_affinities (user_id, author_id, score)
+		SELECT * FROM unnest($1::bigint[], $2::bigint[], $3::float8[])
+		ON CONFLICT (user_id, author_id) DO UPDATE SET score = EXCLUDED.score, updated_at = now()
+	`
+	_, err := s.db.ExecContext(ctx, query, pq.Array(userIDs), pq.Array(authorIDs), pq.Array(scores))
+	return err
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ScheduledTask is the last run of a scheduled task.
+type ScheduledTask struct {
+	Name          string  `json:"name"`
+	ScheduledAt   string  `json:"scheduled_at"`
+	StartedAt     string  `json:"started_at"`
+	FinishedAt    *string `json:"finished_at"`
+	LastError     string  `json:"last_error"`
+	LastSuccessAt *string `json:"last_success_at"`
+}
+
+type SchedulerStore struct {
+	db *sql.DB
+}
+
+// RunExclusive runs fn as the run of task name scheduled at scheduledAt,
+// unless another instance holds the task's advisory lock or already ran
+// that schedule. It reports whether fn ran and returns fn's error.
+func (s *SchedulerStore) RunExclusive(ctx context.Context, name string, scheduledAt time.Time, fn func(ctx context.Context) error) (bool, error) {
+	// advisory locks belong to a session, so hold on to one connection
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	lockKey := "scheduler:" + name
+
+	var locked bool
+	query := `SELECT pg_try_advisory_lock(hashtext($1))`
+	if err := conn.QueryRowContext(ctx, query, lockKey).Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+	defer func() {
+		// unlock even when ctx is cancelled, or the lock stays with the pooled session
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		_, _ = conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtext($1))`, lockKey)
+	}()
+
+	query = `
+		INSERT INTO scheduled_tasks (name, scheduled_at, started_at)
+		VALUES ($1, $2, now())
+		ON CONFLICT (name) DO UPDATE
+		SET scheduled_at = EXCLUDED.scheduled_at, started_at = now(), finished_at = NULL
+		WHERE scheduled_tasks.scheduled_at < EXCLUDED.scheduled_at
+	`
+	res, err := conn.ExecContext(ctx, query, name, scheduledAt)
+	if err != nil {
+		return false, err
+	}
+
+	claimed, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if claimed == 0 {
+		// another instance already ran this schedule
+		return false, nil
+	}
+
+	runErr := fn(ctx)
+
+	var reason string
+	if runErr != nil {
+		reason = runErr.Error()
+	}
+
+	query = `
+		UPDATE scheduled_tasks
+		SET finished_at = now(),
+			last_error = $2,
+			last_success_at = CASE WHEN $2 = '' THEN now() ELSE last_success_at END
+		WHERE name = $1
+	`
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if _, err := conn.ExecContext(ctx, query, name, reason); err != nil {
+		return true, err
+	}
+
+	return true, runErr
+}
+
+func (s *SchedulerStore) GetAll(ctx context.Context) ([]ScheduledTask, error) {
+	query := `
+		SELECT name, scheduled_at, started_at, finished_at, last_error, last_success_at
+		FROM scheduled_tasks
+		ORDER BY name
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []ScheduledTask{}
+	for rows.Next() {
+		var t ScheduledTask
+		err := rows.Scan(
+			&t.Name,
+			&t.ScheduledAt,
+			&t.StartedAt,
+			&t.FinishedAt,
+			&t.LastError,
+			&t.LastSuccessAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+
+	return tasks, rows.Err()
+}
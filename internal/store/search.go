@@ -0,0 +1,74 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+)
+
+// toTSQuery turns a user search string into a to_tsquery expression.
+// Terms are AND-ed together and support:
+//
+//	"exact phrase"  words next to each other, in order
+//	gopher*         prefix match
+//	-java           exclude posts containing the term
+//
+// Every term is quoted so the input can not inject tsquery operators.
+func toTSQuery(q string) string {
+	var terms []string
+
+	rest := strings.TrimSpace(q)
+	for rest != "" {
+		negate := false
+		if rest[0] == '-' {
+			negate = true
+			rest = rest[1:]
+		}
+
+		var term string
+		if strings.HasPrefix(rest, `"`) {
+			var phrase string
+			phrase, rest, _ = strings.Cut(rest[1:], `"`)
+			term = quoteLexeme(phrase)
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			word := rest[:end]
+			rest = rest[end:]
+
+			prefix := strings.HasSuffix(word, "*")
+			term = quoteLexeme(strings.TrimRight(word, "*"))
+			if prefix && term != "" {
+				term += ":*"
+			}
+		}
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+
+		if term == "" {
+			continue
+		}
+		if negate {
+			term = "!" + term
+		}
+		terms = append(terms, term)
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+func quoteLexeme(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	text = strings.ReplaceAll(text, `'`, `''`)
+	return "'" + text + "'"
+}
+
+// escapeLike escapes the LIKE wildcards in text so it is matched literally.
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
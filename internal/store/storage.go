@@ -11,6 +11,10 @@ var (
 	ErrNotFound          = errors.New("record not found")
 	ErrDuplicateEmail    = errors.New("email already exists")
 	ErrDuplicateUsername = errors.New("username already exists")
+	ErrMaxCommentDepth   = errors.New("comment thread is nested too deep")
+	ErrInvalidCursor     = errors.New("invalid pagination cursor")
+	ErrEmptySearch       = errors.New("search query has no terms")
+	ErrLeaseLost         = errors.New("lease expired and was claimed again")
 )
 
 type Storage struct {
@@ -19,23 +23,124 @@ type Storage struct {
 		GetByID(ctx context.Context, postID int64) (*Post, error)
 		Delete(ctx context.Context, postID int64) error
 		Update(ctx context.Context, post *Post) error
-		GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) (*FeedPage, error)
+		GetExploreFeed(ctx context.Context, fq PaginatedFeedQuery) (*FeedPage, error)
+		Search(ctx context.Context, viewerID int64, sq PaginatedSearchQuery) ([]PostSearchResult, error)
+		React(ctx context.Context, postID, userID int64, reaction string) (bool, error)
+		Unreact(ctx context.Context, postID, userID int64) error
+		Repost(ctx context.Context, postID, userID int64) error
+		Unrepost(ctx context.Context, postID, userID int64) error
+		GetIDsByAuthors(ctx context.Context, authorIDs []int64, beforeID int64, limit int) ([]int64, error)
+		GetFeedByIDs(ctx context.Context, ids []int64) ([]PostWithMetadata, error)
+		GetPublicByAuthor(ctx context.Context, userID int64, limit int) ([]Post, error)
+		GetPublicByTag(ctx context.Context, tag string, limit int) ([]Post, error)
 	}
 	Users interface {
 		Create(ctx context.Context, tx *sql.Tx, user *User) error
-		CreateAndInvite(ctx context.Context, user *User, token string, invitationsExpDate time.Duration) error
+		CreateAndInvite(ctx context.Context, user *User, token string, invitationsExpDate time.Duration, invite *OutboxMessage) error
 		GetByID(ctx context.Context, userID int64) (*User, error)
 		GetByEmail(ctx context.Context, email string) (*User, error)
-		Activate(ctx context.Context, token string) error
+		GetByUsername(ctx context.Context, username string) (*User, error)
+		Activate(ctx context.Context, token string) (*User, error)
+		SetLocale(ctx context.Context, userID int64, locale string) error
+		RecordLogin(ctx context.Context, userID int64) error
 		Delete(ctx context.Context, userID int64) error
+		Search(ctx context.Context, viewerID int64, sq PaginatedSearchQuery) ([]UserCard, error)
+		DeleteExpiredInvitations(ctx context.Context) (int64, error)
 	}
 	Comments interface {
 		Create(ctx context.Context, comment *Comment) error
-		GetByPostID(ctx context.Context, postID int64) ([]Comment, error)
+		GetByID(ctx context.Context, commentID int64) (*Comment, error)
+		GetByPostID(ctx context.Context, postID int64, limit int) ([]Comment, error)
+		GetPage(ctx context.Context, postID int64, pq PaginatedCommentsQuery) (*CommentsPage, error)
+		GetReplies(ctx context.Context, commentID int64, pq PaginatedCommentsQuery) (*CommentsPage, error)
+		CountTopLevel(ctx context.Context, postID int64) (int, error)
+		CountReplies(ctx context.Context, commentID int64) (int, error)
+		React(ctx context.Context, commentID, userID int64, reaction string) error
+		Unreact(ctx context.Context, commentID, userID int64) error
+		Update(ctx context.Context, comment *Comment) error
+		Delete(ctx context.Context, commentID int64) error
 	}
 	Followers interface {
 		Follow(ctx context.Context, followedID, userID int64) error
 		UnFollow(ctx context.Context, followedID, userID int64) error
+		GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error)
+		GetFollowingIDs(ctx context.Context, userID int64) ([]int64, error)
+		CountFollowers(ctx context.Context, userID int64) (int, error)
+	}
+	Blocks interface {
+		Block(ctx context.Context, userID, blockedID int64) error
+		Unblock(ctx context.Context, userID, blockedID int64) error
+		GetBlockedIDs(ctx context.Context, userID int64) ([]int64, error)
+	}
+	Ranking interface {
+		GetPostEngagement(ctx context.Context, since time.Time) ([]PostEngagement, error)
+		SavePostScores(ctx context.Context, posts []PostEngagement) error
+		GetAffinities(ctx context.Context, since time.Time, window time.Duration) ([]Affinity, error)
+		SaveAffinities(ctx context.Context, affinities []Affinity) error
+	}
+	Federation interface {
+		GetKey(ctx context.Context, userID int64) (*UserKey, error)
+		CreateKey(ctx context.Context, key *UserKey) error
+		AddRemoteFollower(ctx context.Context, follower *RemoteFollower) error
+		RemoveRemoteFollower(ctx context.Context, userID int64, actorID string) error
+		GetRemoteFollowers(ctx context.Context, userID int64) ([]RemoteFollower, error)
+		HasActivity(ctx context.Context, activityID string) (bool, error)
+		RecordActivity(ctx context.Context, activity *InboxActivity) error
+		EnqueueDeliveries(ctx context.Context, userID int64, inboxes []string, payload []byte) error
+		ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]FederationDelivery, error)
+		MarkDelivered(ctx context.Context, deliveryID int64) error
+		MarkFailed(ctx context.Context, deliveryID int64, reason string, retryAt *time.Time) error
+	}
+	Notifications interface {
+		Create(ctx context.Context, n *Notification) error
+		GetGroups(ctx context.Context, userID int64, nq PaginatedNotificationsQuery) ([]NotificationGroup, error)
+		CountUnread(ctx context.Context, userID int64) (int, error)
+		MarkGroupRead(ctx context.Context, userID, notificationID int64) error
+		MarkAllRead(ctx context.Context, userID int64) error
+		GetPreferences(ctx context.Context, userID int64) (map[string]bool, error)
+		SetPreferences(ctx context.Context, userID int64, prefs map[string]bool) error
+	}
+	Webhooks interface {
+		Create(ctx context.Context, webhook *Webhook) error
+		GetByID(ctx context.Context, webhookID int64) (*Webhook, error)
+		GetByUserID(ctx context.Context, userID int64) ([]Webhook, error)
+		Delete(ctx context.Context, webhookID int64) error
+		Enable(ctx context.Context, webhookID int64) error
+		Enqueue(ctx context.Context, event string, userID int64, payload []byte) error
+		GetDeliveries(ctx context.Context, webhookID int64, limit int) ([]WebhookDelivery, error)
+		Redeliver(ctx context.Context, webhookID, deliveryID int64) (*WebhookDelivery, error)
+		ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error)
+		MarkDelivered(ctx context.Context, d *WebhookDelivery, status int) error
+		MarkFailed(ctx context.Context, d *WebhookDelivery, status *int, reason string, retryAt *time.Time, disableAfter int) error
+	}
+	Outbox interface {
+		Enqueue(ctx context.Context, tx *sql.Tx, msg *OutboxMessage) error
+		Claim(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error)
+		MarkProcessed(ctx context.Context, messageID int64) error
+		MarkFailed(ctx context.Context, messageID int64, reason string, retryAt *time.Time) error
+	}
+	Digests interface {
+		GetRecipients(ctx context.Context, frequency string, period, inactiveSince time.Time, afterID int64, limit int) ([]DigestRecipient, error)
+		GetNewFollowers(ctx context.Context, userID int64, since time.Time, limit int) ([]string, int, error)
+		Record(ctx context.Context, userID int64, frequency string, period time.Time, email *OutboxMessage) (bool, error)
+		GetFrequency(ctx context.Context, userID int64) (string, error)
+		SetFrequency(ctx context.Context, userID int64, frequency string) error
+	}
+	Jobs interface {
+		Enqueue(ctx context.Context, job *Job) (bool, error)
+		Claim(ctx context.Context, queue string, limit int, lease time.Duration) ([]Job, error)
+		Complete(ctx context.Context, job *Job) error
+		Fail(ctx context.Context, job *Job, reason string, retryAt *time.Time) error
+		DeleteFinished(ctx context.Context, before time.Time) (int64, error)
+	}
+	Scheduler interface {
+		RunExclusive(ctx context.Context, name string, scheduledAt time.Time, fn func(ctx context.Context) error) (bool, error)
+		GetAll(ctx context.Context) ([]ScheduledTask, error)
+	}
+	Tags interface {
+		RecomputeTrending(ctx context.Context, since time.Time, limit int) error
+		GetTrending(ctx context.Context, limit int) ([]TrendingTag, error)
 	}
 	Roles interface {
 		GetByName(ctx context.Context, name string) (*Role, error)
@@ -44,11 +149,21 @@ type Storage struct {
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostStore{db: db},
-		Users:     &UserStore{db: db},
-		Comments:  &CommentStore{db: db},
-		Followers: &FollowerStore{db: db},
-		Roles:     &RoleStore{db: db},
+		Posts:         &PostStore{db: db},
+		Users:         &UserStore{db: db},
+		Comments:      &CommentStore{db: db},
+		Followers:     &FollowerStore{db: db},
+		Blocks:        &BlockStore{db: db},
+		Ranking:       &RankingStore{db: db},
+		Federation:    &FederationStore{db: db},
+		Notifications: &NotificationStore{db: db},
+		Webhooks:      &WebhookStore{db: db},
+		Outbox:        &OutboxStore{db: db},
+		Digests:       &DigestStore{db: db},
+		Jobs:          &JobStore{db: db},
+		Scheduler:     &SchedulerStore{db: db},
+		Tags:          &TagStore{db: db},
+		Roles:         &RoleStore{db: db},
 	}
 }
 
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type TrendingTag struct {
+	Tag         string `json:"tag"`
+	PostCount   int    `json:"post_count"`
+	AuthorCount int    `json:"author_count"`
+	ComputedAt  string `json:"computed_at"`
+}
+
+type TagStore struct {
+	db *sql.DB
+}
+
+// RecomputeTrending replaces the trending tags with the limit tags used by
+// the most authors since since.
+func (s *TagStore) RecomputeTrending(ctx context.Context, since time.Time, limit int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM trending_tags`); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO trending_tags (tag, post_count, author_count)
+			SELECT t.tag, COUNT(*), COUNT(DISTINCT p.user_id)
+			FROM posts p
+			JOIN users u ON u.id = p.user_id AND u.is_active
+			CROSS JOIN LATERAL unnest(p.tags) AS t(tag)
+			WHERE p.created_at >= $1
+			GROUP BY t.tag
+			ORDER BY COUNT(DISTINCT p.user_id) DESC, COUNT(*) DESC
+			LIMIT $2
+		`
+		_, err := tx.ExecContext(ctx, query, since, limit)
+		return err
+	})
+}
+
+func (s *TagStore) GetTrending(ctx context.Context, limit int) ([]TrendingTag, error) {
+	query := `
+		SELECT tag, post_count, author_count, computed_at
+		FROM trending_tags
+		ORDER BY author_count DESC, post_count DESC, tag
+		LIMIT $1
+	`
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TrendingTag{}
+	for rows.Next() {
+		var t TrendingTag
+		if err := rows.Scan(&t.Tag, &t.PostCount, &t.AuthorCount, &t.ComputedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
@@ -20,6 +20,17 @@ type User struct {
 	IsActive  bool     `json:"is_active"`
 	RoleID    int64    `json:"role_id"`
 	Role      Role     `json:"role"`
+	// Locale is the preferred language of emails and messages, empty to
+	// negotiate it per request
+	Locale string `json:"locale"`
+}
+
+// UserCard is the compact view of a user shown in listings.
+type UserCard struct {
+	ID             int64  `json:"id"`
+	Username       string `json:"username"`
+	FollowersCount int    `json:"followers_count"`
+	FollowedByMe   bool   `json:"followed_by_me"`
 }
 
 type password struct {
@@ -40,8 +51,8 @@ type UserStore struct {
 
 func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 	query := `
-		INSERT INTO users (username, email, password, role_id)
-		VALUES ($1, $2, $3, (SELECT id FROM roles WHERE name = $4)) RETURNING id, created_at
+		INSERT INTO users (username, email, password, role_id, locale)
+		VALUES ($1, $2, $3, (SELECT id FROM roles WHERE name = $4), $5) RETURNING id, created_at
 	`
 
 	role := user.Role.Name
@@ -56,6 +67,7 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 		user.Email,
 		user.Password.hash,
 		role,
+		user.Locale,
 	).Scan(&user.ID, &user.CreatedAt)
 
 	if err != nil {
@@ -72,8 +84,11 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 	}
 }
 
+// CreateAndInvite creates an inactive user with an invitation token. invite,
+// usually the invitation email, is queued in the same transaction so it is
+// sent exactly when the user exists.
 func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string,
-	invitationsExpDate time.Duration) error {
+	invitationsExpDate time.Duration, invite *OutboxMessage) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		// create the user
 		if err := s.Create(ctx, tx, user); err != nil {
@@ -81,8 +96,15 @@ func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token strin
 		}
 
 		// create the user invite
-		return s.createUserInvitation(ctx, tx, token, invitationsExpDate, user.ID)
+		if err := s.createUserInvitation(ctx, tx, token, invitationsExpDate, user.ID); err != nil {
+			return err
+		}
 
+		// queue the invitation
+		if invite == nil {
+			return nil
+		}
+		return enqueueOutbox(ctx, tx, invite)
 	})
 }
 
@@ -99,7 +121,7 @@ func (s *UserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token
 
 func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 	query := `
-		SELECT users.id, username, email, password, role_id, created_at, roles.*
+		SELECT users.id, username, email, password, role_id, created_at, locale, roles.*
 		FROM users
 		JOIN roles ON (users.role_id = roles.id)
 		WHERE users.id = $1 AND is_active = true
@@ -112,6 +134,7 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 		&user.Password.hash,
 		&user.RoleID,
 		&user.CreatedAt,
+		&user.Locale,
 		&user.Role.ID,
 		&user.Role.Name,
 		&user.Role.Level,
@@ -129,7 +152,7 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, username, email, password, created_at
+		SELECT id, username, email, password, created_at, locale
 		FROM users
 		WHERE email = $1 AND is_active = true
 	`
@@ -141,6 +164,7 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.CreatedAt,
+		&user.Locale,
 	); err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -153,9 +177,37 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 	return &user, nil
 }
 
-func (s *UserStore) Activate(ctx context.Context, token string) error {
+func (s *UserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	query := `
+		SELECT id, username, email, password, created_at, locale
+		FROM users
+		WHERE username = $1 AND is_active = true
+	`
+	var user User
 
-	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+	if err := s.db.QueryRowContext(ctx, query, username).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.CreatedAt,
+		&user.Locale,
+	); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (s *UserStore) Activate(ctx context.Context, token string) (*User, error) {
+	var activated *User
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
 		// 1. find the user that token belongs to
 		user, err := s.getUserFromInvitation(ctx, tx, token)
 		if err != nil {
@@ -169,8 +221,46 @@ func (s *UserStore) Activate(ctx context.Context, token string) error {
 		}
 
 		// 3. clean the invitation token
+		activated = user
 		return s.deleteUserInvitations(ctx, tx, user.ID)
 	})
+
+	return activated, err
+}
+
+func (s *UserStore) SetLocale(ctx context.Context, userID int64, locale string) error {
+	query := `
+		UPDATE users
+		SET locale = $1
+		WHERE id = $2 AND is_active = true
+	`
+
+	res, err := s.db.ExecContext(ctx, query, locale, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RecordLogin notes that userID signed in, which holds back their digests.
+func (s *UserStore) RecordLogin(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE users
+		SET last_login_at = now()
+		WHERE id = $1
+	`
+	_, err := s.db.ExecContext(ctx, query, userID)
+
+	return err
 }
 
 func (s *UserStore) Delete(ctx context.Context, userID int64) error {
@@ -249,3 +339,63 @@ func (s *UserStore) deleteUserInvitations(ctx context.Context, tx *sql.Tx, userI
 
 	return err
 }
+
+// DeleteExpiredInvitations removes invitations that can no longer be used.
+func (s *UserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	query := `
+		DELETE FROM user_invitations WHERE expiry < now()
+	`
+	res, err := s.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Search finds active users whose username starts with, or is close to, the
+// query. Users that blocked the viewer or were blocked by them are left out.
+func (s *UserStore) Search(ctx context.Context, viewerID int64, sq PaginatedSearchQuery) ([]UserCard, error) {
+	query := `
+		SELECT
+			u.id,
+			u.username,
+			(SELECT COUNT(*) FROM followers f WHERE f.follower_id = u.id),
+			EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $1 AND f.follower_id = u.id)
+		FROM users u
+		WHERE
+			u.is_active = true AND
+			(u.username ILIKE $3 || '%' OR u.username % $2) AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.user_id = $1 AND b.blocked_id = u.id)
+					OR (b.user_id = u.id AND b.blocked_id = $1)
+			)
+		ORDER BY
+			u.username = $2 DESC,
+			u.username ILIKE $3 || '%' DESC,
+			similarity(u.username, $2) DESC,
+			u.username
+		LIMIT $4 OFFSET $5;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, viewerID, sq.Query, escapeLike(sq.Query), sq.Limit, sq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []UserCard{}
+	for rows.Next() {
+		var u UserCard
+		if err := rows.Scan(&u.ID, &u.Username, &u.FollowersCount, &u.FollowedByMe); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
@@ -0,0 +1,339 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Webhook posts the events it subscribes to to URL. A global webhook
+// receives the events of every user, otherwise only those of its owner.
+type Webhook struct {
+	ID           int64    `json:"id"`
+	UserID       int64    `json:"user_id"`
+	URL          string   `json:"url"`
+	Secret       string   `json:"secret,omitempty"`
+	Events       []string `json:"events"`
+	Global       bool     `json:"global"`
+	Active       bool     `json:"active"`
+	FailureCount int      `json:"failure_count"`
+	DisabledAt   *string  `json:"disabled_at"`
+	CreatedAt    string   `json:"created_at"`
+}
+
+// WebhookDelivery is one event sent, or waiting to be sent, to a webhook.
+type WebhookDelivery struct {
+	ID            int64           `json:"id"`
+	WebhookID     int64           `json:"webhook_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload" swaggertype:"object"`
+	Attempts      int             `json:"attempts"`
+	LastStatus    *int            `json:"last_status"`
+	LastError     string          `json:"last_error"`
+	NextAttemptAt string          `json:"next_attempt_at"`
+	DeliveredAt   *string         `json:"delivered_at"`
+	FailedAt      *string         `json:"failed_at"`
+	CreatedAt     string          `json:"created_at"`
+	// set on claimed deliveries
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type WebhookStore struct {
+	db *sql.DB
+}
+
+func (s *WebhookStore) Create(ctx context.Context, webhook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (user_id, url, secret, events, global)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, active, created_at
+	`
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		webhook.UserID,
+		webhook.URL,
+		webhook.Secret,
+		pq.Array(webhook.Events),
+		webhook.Global,
+	).Scan(&webhook.ID, &webhook.Active, &webhook.CreatedAt)
+}
+
+func (s *WebhookStore) GetByID(ctx context.Context, webhookID int64) (*Webhook, error) {
+	query := `
+		SELECT id, user_id, url, events, global, active, failure_count, disabled_at, created_at
+		FROM webhooks
+		WHERE id = $1
+	`
+	var w Webhook
+	err := s.db.QueryRowContext(ctx, query, webhookID).Scan(
+		&w.ID,
+		&w.UserID,
+		&w.URL,
+		pq.Array(&w.Events),
+		&w.Global,
+		&w.Active,
+		&w.FailureCount,
+		&w.DisabledAt,
+		&w.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &w, nil
+}
+
+func (s *WebhookStore) GetByUserID(ctx context.Context, userID int64) ([]Webhook, error) {
+	query := `
+		SELECT id, user_id, url, events, global, active, failure_count, disabled_at, created_at
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY id
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var w Webhook
+		err := rows.Scan(
+			&w.ID,
+			&w.UserID,
+			&w.URL,
+			pq.Array(&w.Events),
+			&w.Global,
+			&w.Active,
+			&w.FailureCount,
+			&w.DisabledAt,
+			&w.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (s *WebhookStore) Delete(ctx context.Context, webhookID int64) error {
+	query := `DELETE FROM webhooks WHERE id = $1`
+
+	res, err := s.db.ExecContext(ctx, query, webhookID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Enable reactivates a webhook and resets its failure count.
+func (s *WebhookStore) Enable(ctx context.Context, webhookID int64) error {
+	query := `
+		UPDATE webhooks
+		SET active = true, failure_count = 0, disabled_at = NULL
+		WHERE id = $1
+	`
+	_, err := s.db.ExecContext(ctx, query, webhookID)
+	return err
+}
+
+// Enqueue schedules payload for every active webhook subscribed to event
+// that receives the events of userID.
+func (s *WebhookStore) Enqueue(ctx context.Context, event string, userID int64, payload []byte) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $1, $3
+		FROM webhooks
+		WHERE active AND $1 = ANY(events) AND (global OR user_id = $2)
+	`
+	_, err := s.db.ExecContext(ctx, query, event, userID, payload)
+	return err
+}
+
+// GetDeliveries returns the newest deliveries of a webhook.
+func (s *WebhookStore) GetDeliveries(ctx context.Context, webhookID int64, limit int) ([]WebhookDelivery, error) {
+	query := `
+		SELECT id, webhook_id, event, payload, attempts, last_status, last_error,
+			next_attempt_at, delivered_at, failed_at, created_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`
+	rows, err := s.db.QueryContext(ctx, query, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		err := rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.Event,
+			(*[]byte)(&d.Payload),
+			&d.Attempts,
+			&d.LastStatus,
+			&d.LastError,
+			&d.NextAttemptAt,
+			&d.DeliveredAt,
+			&d.FailedAt,
+			&d.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// Redeliver queues a copy of a past delivery, keeping the original in the log.
+func (s *WebhookStore) Redeliver(ctx context.Context, webhookID, deliveryID int64) (*WebhookDelivery, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT webhook_id, event, payload
+		FROM webhook_deliveries
+		WHERE id = $1 AND webhook_id = $2
+		RETURNING id, webhook_id, event, payload, attempts, last_error, next_attempt_at, created_at
+	`
+	var d WebhookDelivery
+	err := s.db.QueryRowContext(ctx, query, deliveryID, webhookID).Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.Event,
+		(*[]byte)(&d.Payload),
+		&d.Attempts,
+		&d.LastError,
+		&d.NextAttemptAt,
+		&d.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &d, nil
+}
+
+// ClaimDeliveries picks up to limit due deliveries of active webhooks and
+// hides them from other workers for lease.
+func (s *WebhookStore) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1,
+			next_attempt_at = now() + $2 * interval '1 second'
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT wd.id FROM webhook_deliveries wd
+			JOIN webhooks wh ON wh.id = wd.webhook_id
+			WHERE wh.active AND wd.delivered_at IS NULL AND wd.failed_at IS NULL
+				AND wd.next_attempt_at <= now()
+			ORDER BY wd.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF wd SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts, w.url, w.secret
+	`
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		err := rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.Event,
+			(*[]byte)(&d.Payload),
+			&d.Attempts,
+			&d.URL,
+			&d.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// MarkDelivered records a successful delivery and resets the webhook's
+// consecutive failures.
+func (s *WebhookStore) MarkDelivered(ctx context.Context, d *WebhookDelivery, status int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE webhook_deliveries
+			SET delivered_at = now(), last_status = $2, last_error = ''
+			WHERE id = $1
+		`
+		if _, err := tx.ExecContext(ctx, query, d.ID, status); err != nil {
+			return err
+		}
+
+		query = `UPDATE webhooks SET failure_count = 0 WHERE id = $1`
+		_, err := tx.ExecContext(ctx, query, d.WebhookID)
+		return err
+	})
+}
+
+// MarkFailed records a failed attempt, retried at retryAt or given up on when
+// it is nil. The webhook is disabled once it failed disableAfter times in a row.
+func (s *WebhookStore) MarkFailed(ctx context.Context, d *WebhookDelivery, status *int, reason string, retryAt *time.Time, disableAfter int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE webhook_deliveries
+			SET last_status = $2,
+				last_error = $3,
+				next_attempt_at = COALESCE($4, next_attempt_at),
+				failed_at = CASE WHEN $4::timestamptz IS NULL THEN now() END
+			WHERE id = $1
+		`
+		if _, err := tx.ExecContext(ctx, query, d.ID, status, reason, retryAt); err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE webhooks
+			SET failure_count = failure_count + 1,
+				active = failure_count + 1 < $2,
+				disabled_at = CASE WHEN failure_count + 1 >= $2 THEN now() END
+			WHERE id = $1
+		`
+		_, err := tx.ExecContext(ctx, query, d.WebhookID, disableAfter)
+		return err
+	})
+}
@@ -0,0 +1,59 @@
+package stream
+
+import (
+	"context"
+	"errors"
+
+	"github.com/MohammadTaghipour/social/internal/jobs"
+	"github.com/MohammadTaghipour/social/internal/store"
+)
+
+type PostArgs struct {
+	Post store.Post `json:"post"`
+}
+
+type CommentArgs struct {
+	Post    store.Post    `json:"post"`
+	Comment store.Comment `json:"comment"`
+}
+
+// live events are worthless once late, so they are tried once
+var (
+	PublishPostJob    = jobs.Kind[PostArgs]{Name: "publish_post", Queue: "default", MaxAttempts: 1}
+	PublishCommentJob = jobs.Kind[CommentArgs]{Name: "publish_comment", Queue: "default", MaxAttempts: 1}
+)
+
+// RegisterJobs adds the handlers of the stream jobs to r, new posts go to
+// the followers of their author read from store. A nil b means streaming is
+// disabled, the jobs then complete without doing anything.
+func RegisterJobs(r *jobs.Runner, b *Broker, store store.Storage) {
+	jobs.Handle(r, PublishPostJob, func(ctx context.Context, args PostArgs) error {
+		if b == nil {
+			return nil
+		}
+		return b.publishToFollowers(ctx, store, &args.Post)
+	})
+	jobs.Handle(r, PublishCommentJob, func(ctx context.Context, args CommentArgs) error {
+		if b == nil {
+			return nil
+		}
+		return b.PublishToPost(ctx, args.Post.ID, EventComment, args.Comment)
+	})
+}
+
+// publishToFollowers pushes a new post to its author and everyone following them.
+func (b *Broker) publishToFollowers(ctx context.Context, store store.Storage, post *store.Post) error {
+	followerIDs, err := store.Followers.GetFollowerIDs(ctx, post.UserID)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, id := range append(followerIDs, post.UserID) {
+		if err := b.PublishToUser(ctx, id, EventPost, post); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
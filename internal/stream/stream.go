@@ -0,0 +1,285 @@
+package stream
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	channelPrefix = "stream-events:"
+	logPrefix     = "stream-log:"
+	// events older than this can not be replayed
+	logExpTime = time.Hour * 24
+
+	EventPost         = "post"
+	EventNotification = "notification"
+	EventComment      = "comment"
+)
+
+type Config struct {
+	// Heartbeat is how often an idle stream is pinged to keep proxies from
+	// closing it.
+	Heartbeat time.Duration
+	// ReplaySize is how many events per topic are kept for reconnecting clients.
+	ReplaySize int
+	Enabled    bool
+}
+
+// Event is a message pushed to connected clients. IDs are Redis stream ids,
+// which increase over time, so clients resume with Last-Event-ID.
+type Event struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func UserTopic(userID int64) string {
+	return fmt.Sprintf("user-%d", userID)
+}
+
+func PostTopic(postID int64) string {
+	return fmt.Sprintf("post-%d", postID)
+}
+
+// Broker fans events out to the clients connected to this instance. Events
+// are published through Redis so every instance sees them, and kept in a
+// capped Redis stream per topic for replay.
+type Broker struct {
+	rdb    *redis.Client
+	config Config
+	logger *zap.SugaredLogger
+
+	mu     sync.Mutex
+	subs   map[string]map[*Subscription]struct{}
+	closed bool
+}
+
+func NewBroker(rdb *redis.Client, config Config, logger *zap.SugaredLogger) *Broker {
+	return &Broker{
+		rdb:    rdb,
+		config: config,
+		logger: logger,
+		subs:   make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+func (b *Broker) Heartbeat() time.Duration {
+	return b.config.Heartbeat
+}
+
+func (b *Broker) PublishToUser(ctx context.Context, userID int64, typ string, data any) error {
+	return b.Publish(ctx, UserTopic(userID), typ, data)
+}
+
+func (b *Broker) PublishToPost(ctx context.Context, postID int64, typ string, data any) error {
+	return b.Publish(ctx, PostTopic(postID), typ, data)
+}
+
+// Publish appends an event to the replay log of topic and broadcasts it to
+// every instance.
+func (b *Broker) Publish(ctx context.Context, topic, typ string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	key := logPrefix + topic
+	id, err := b.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: int64(b.config.ReplaySize),
+		Approx: true,
+		Values: map[string]any{"type": typ, "data": payload},
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	if err := b.rdb.Expire(ctx, key, logExpTime).Err(); err != nil {
+		return err
+	}
+
+	message, err := json.Marshal(Event{ID: id, Type: typ, Data: payload})
+	if err != nil {
+		return err
+	}
+
+	return b.rdb.Publish(ctx, channelPrefix+topic, message).Err()
+}
+
+// Replay returns the events of topics published after lastEventID, oldest first.
+func (b *Broker) Replay(ctx context.Context, topics []string, lastEventID string) ([]Event, error) {
+	if _, ok := parseID(lastEventID); !ok {
+		return nil, nil
+	}
+
+	var events []Event
+	for _, topic := range topics {
+		messages, err := b.rdb.XRange(ctx, logPrefix+topic, "("+lastEventID, "+").Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range messages {
+			typ, _ := m.Values["type"].(string)
+			data, _ := m.Values["data"].(string)
+			events = append(events, Event{ID: m.ID, Type: typ, Data: json.RawMessage(data)})
+		}
+	}
+
+	slices.SortFunc(events, func(a, b Event) int { return compareIDs(a.ID, b.ID) })
+	return events, nil
+}
+
+// Run relays the events published by every instance to the local
+// subscribers until ctx is done, then closes all subscriptions so their
+// streams end.
+func (b *Broker) Run(ctx context.Context) {
+	pubsub := b.rdb.PSubscribe(ctx, channelPrefix+"*")
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			b.closeAll()
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				b.closeAll()
+				return
+			}
+
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				b.logger.Warnw("invalid stream event", "channel", msg.Channel, "error", err.Error())
+				continue
+			}
+			b.dispatch(strings.TrimPrefix(msg.Channel, channelPrefix), event)
+		}
+	}
+}
+
+// Subscription receives the events of its topics until it is closed, or the
+// client falls too far behind and has to reconnect.
+type Subscription struct {
+	broker *Broker
+	topics []string
+	events chan Event
+	once   sync.Once
+}
+
+func (b *Broker) Subscribe(topics ...string) *Subscription {
+	sub := &Subscription{
+		broker: b,
+		topics: topics,
+		events: make(chan Event, 32),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(sub.events)
+		return sub
+	}
+
+	for _, topic := range topics {
+		if b.subs[topic] == nil {
+			b.subs[topic] = make(map[*Subscription]struct{})
+		}
+		b.subs[topic][sub] = struct{}{}
+	}
+
+	return sub
+}
+
+// Events is closed when the subscription ends.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.remove(s)
+}
+
+func (b *Broker) dispatch(topic string, event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs[topic] {
+		select {
+		case sub.events <- event:
+		default:
+			// a stalled client resumes from its Last-Event-ID
+			b.remove(sub)
+		}
+	}
+}
+
+func (b *Broker) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for _, subs := range b.subs {
+		for sub := range subs {
+			b.remove(sub)
+		}
+	}
+}
+
+// remove unregisters sub and closes its channel. b.mu must be held.
+func (b *Broker) remove(sub *Subscription) {
+	sub.once.Do(func() {
+		for _, topic := range sub.topics {
+			delete(b.subs[topic], sub)
+			if len(b.subs[topic]) == 0 {
+				delete(b.subs, topic)
+			}
+		}
+		close(sub.events)
+	})
+}
+
+// After reports whether event id a comes after b.
+func After(a, b string) bool {
+	return compareIDs(a, b) > 0
+}
+
+func compareIDs(a, b string) int {
+	idA, _ := parseID(a)
+	idB, _ := parseID(b)
+	return cmp.Or(cmp.Compare(idA[0], idB[0]), cmp.Compare(idA[1], idB[1]))
+}
+
+// parseID splits a "<milliseconds>-<sequence>" stream id.
+func parseID(id string) ([2]uint64, bool) {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return [2]uint64{}, false
+	}
+
+	msN, err := strconv.ParseUint(ms, 10, 64)
+	if err != nil {
+		return [2]uint64{}, false
+	}
+	seqN, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return [2]uint64{}, false
+	}
+
+	return [2]uint64{msN, seqN}, true
+}
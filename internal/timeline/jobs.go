@@ -0,0 +1,55 @@
+package timeline
+
+import (
+	"context"
+
+	"github.com/MohammadTaghipour/social/internal/jobs"
+	"github.com/MohammadTaghipour/social/internal/store"
+)
+
+// FollowArgs is UserID starting or stopping to follow FollowedID.
+type FollowArgs struct {
+	UserID     int64 `json:"user_id"`
+	FollowedID int64 `json:"followed_id"`
+}
+
+type PostArgs struct {
+	Post store.Post `json:"post"`
+}
+
+// timelines can be rebuilt from Postgres, so they are not retried long
+var (
+	PostCreatedJob = jobs.Kind[PostArgs]{Name: "timeline_post_created", Queue: "default", MaxAttempts: 3}
+	PostDeletedJob = jobs.Kind[PostArgs]{Name: "timeline_post_deleted", Queue: "default", MaxAttempts: 3}
+	FollowedJob    = jobs.Kind[FollowArgs]{Name: "timeline_followed", Queue: "default", MaxAttempts: 3}
+	UnfollowedJob  = jobs.Kind[FollowArgs]{Name: "timeline_unfollowed", Queue: "default", MaxAttempts: 3}
+)
+
+// RegisterJobs adds the handlers of the timeline jobs to r. A nil s means
+// timelines are disabled, their jobs then complete without doing anything.
+func RegisterJobs(r *jobs.Runner, s *Service) {
+	jobs.Handle(r, PostCreatedJob, func(ctx context.Context, args PostArgs) error {
+		if s == nil {
+			return nil
+		}
+		return s.PostCreated(ctx, &args.Post)
+	})
+	jobs.Handle(r, PostDeletedJob, func(ctx context.Context, args PostArgs) error {
+		if s == nil {
+			return nil
+		}
+		return s.PostDeleted(ctx, &args.Post)
+	})
+	jobs.Handle(r, FollowedJob, func(ctx context.Context, args FollowArgs) error {
+		if s == nil {
+			return nil
+		}
+		return s.Followed(ctx, args.UserID, args.FollowedID)
+	})
+	jobs.Handle(r, UnfollowedJob, func(ctx context.Context, args FollowArgs) error {
+		if s == nil {
+			return nil
+		}
+		return s.Unfollowed(ctx, args.UserID, args.FollowedID)
+	})
+}
@@ -0,0 +1,380 @@
+package timeline
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/store"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	celebritiesKey = "timeline-celebrities"
+	// sentinel marks a timeline holding every post of its authors, it also
+	// keeps an empty timeline from being rebuilt on every read
+	sentinel = "0"
+	// timelines of users that stop reading expire and are rebuilt on demand
+	timelineExpTime = time.Hour * 24 * 7
+)
+
+type Config struct {
+	// MaxLength is how many post ids are kept per timeline, older pages are
+	// read from Postgres.
+	MaxLength int
+	// CelebrityThreshold is the follower count above which an author's posts
+	// are no longer pushed to followers but merged in when reading.
+	CelebrityThreshold int
+	Enabled            bool
+}
+
+// Service keeps a Redis sorted set of post ids per user, scored by post id,
+// holding the posts of everyone they follow plus their own.
+type Service struct {
+	rdb    *redis.Client
+	store  store.Storage
+	config Config
+}
+
+func New(rdb *redis.Client, store store.Storage, config Config) *Service {
+	return &Service{
+		rdb:    rdb,
+		store:  store,
+		config: config,
+	}
+}
+
+func timelineKey(userID int64) string {
+	return fmt.Sprintf("timeline-%v", userID)
+}
+
+// PostCreated pushes a new post to its author's and their followers' timelines.
+func (s *Service) PostCreated(ctx context.Context, post *store.Post) error {
+	celebrity, err := s.isCelebrity(ctx, post.UserID)
+	if err != nil {
+		return err
+	}
+
+	recipients := []int64{post.UserID}
+	if !celebrity {
+		followers, err := s.store.Followers.GetFollowerIDs(ctx, post.UserID)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, followers...)
+	}
+
+	return s.push(ctx, recipients, []int64{post.ID})
+}
+
+// PostDeleted removes a post from the timelines it was pushed to.
+func (s *Service) PostDeleted(ctx context.Context, post *store.Post) error {
+	followers, err := s.store.Followers.GetFollowerIDs(ctx, post.UserID)
+	if err != nil {
+		return err
+	}
+
+	member := strconv.FormatInt(post.ID, 10)
+	pipe := s.rdb.Pipeline()
+	for _, userID := range append(followers, post.UserID) {
+		pipe.ZRem(ctx, timelineKey(userID), member)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Followed backfills userID's timeline with the recent posts of followedID.
+func (s *Service) Followed(ctx context.Context, userID, followedID int64) error {
+	celebrity, err := s.isCelebrity(ctx, followedID)
+	if err != nil || celebrity {
+		return err
+	}
+
+	ids, err := s.store.Posts.GetIDsByAuthors(ctx, []int64{followedID}, math.MaxInt64, s.config.MaxLength)
+	if err != nil {
+		return err
+	}
+
+	return s.push(ctx, []int64{userID}, ids)
+}
+
+// Unfollowed removes the posts of followedID from userID's timeline.
+func (s *Service) Unfollowed(ctx context.Context, userID, followedID int64) error {
+	// losing followers may end followedID being a celebrity
+	if _, err := s.isCelebrity(ctx, followedID); err != nil {
+		return err
+	}
+
+	ids, err := s.store.Posts.GetIDsByAuthors(ctx, []int64{followedID}, math.MaxInt64, s.config.MaxLength)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	members := make([]any, len(ids))
+	for i, id := range ids {
+		members[i] = strconv.FormatInt(id, 10)
+	}
+
+	return s.rdb.ZRem(ctx, timelineKey(userID), members...).Err()
+}
+
+// Rebuild recreates userID's timeline from Postgres.
+func (s *Service) Rebuild(ctx context.Context, userID int64) error {
+	following, err := s.store.Followers.GetFollowingIDs(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	celebrities, err := s.rdb.SMembers(ctx, celebritiesKey).Result()
+	if err != nil {
+		return err
+	}
+
+	authors := []int64{userID}
+	for _, id := range following {
+		if !slices.Contains(celebrities, strconv.FormatInt(id, 10)) {
+			authors = append(authors, id)
+		}
+	}
+
+	ids, err := s.store.Posts.GetIDsByAuthors(ctx, authors, math.MaxInt64, s.config.MaxLength)
+	if err != nil {
+		return err
+	}
+
+	members := make([]redis.Z, 0, len(ids)+1)
+	for _, id := range ids {
+		members = append(members, redis.Z{Score: float64(id), Member: strconv.FormatInt(id, 10)})
+	}
+	if len(ids) < s.config.MaxLength {
+		// every post fits, the oldest page can be served from Redis too
+		members = append(members, redis.Z{Score: 0, Member: sentinel})
+	}
+
+	key := timelineKey(userID)
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.ZAdd(ctx, key, members...)
+	pipe.Expire(ctx, key, timelineExpTime)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RebuildAll rebuilds every timeline currently held in Redis.
+func (s *Service) RebuildAll(ctx context.Context) (int, error) {
+	count := 0
+	iter := s.rdb.Scan(ctx, 0, "timeline-[0-9]*", 100).Iterator()
+	for iter.Next(ctx) {
+		var userID int64
+		if _, err := fmt.Sscanf(iter.Val(), "timeline-%d", &userID); err != nil {
+			continue
+		}
+		if err := s.Rebuild(ctx, userID); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, iter.Err()
+}
+
+// GetFeed reads a page of userID's feed, newest first. ok is false when the
+// page can not be served from the timeline and the caller should fall back
+// to reading the feed from Postgres.
+func (s *Service) GetFeed(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) (page *store.FeedPage, ok bool, err error) {
+	if !servable(fq) {
+		return nil, false, nil
+	}
+
+	key := timelineKey(userID)
+	exists, err := s.rdb.Exists(ctx, key).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if exists == 0 {
+		if err := s.Rebuild(ctx, userID); err != nil {
+			return nil, false, err
+		}
+	}
+
+	beforeID := int64(math.MaxInt64)
+	if fq.Keyset != nil {
+		beforeID = fq.Keyset.ID
+	}
+
+	// one extra id tells whether there is a further page
+	want := fq.Limit + 1
+	members, err := s.rdb.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{
+		Max:   "(" + strconv.FormatInt(beforeID, 10),
+		Min:   "(0",
+		Count: int64(want),
+	}).Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(members) < want {
+		// the sentinel is trimmed away once the timeline outgrows MaxLength,
+		// without it the page may reach past what Redis holds
+		if err := s.rdb.ZScore(ctx, key, sentinel).Err(); err != nil {
+			if errors.Is(err, redis.Nil) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+	}
+
+	if err := s.rdb.Expire(ctx, key, timelineExpTime).Err(); err != nil {
+		return nil, false, err
+	}
+
+	ids := make([]int64, 0, len(members))
+	for _, m := range members {
+		id, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			return nil, false, err
+		}
+		ids = append(ids, id)
+	}
+
+	// fan-out-on-read for the celebrities userID follows
+	celebrityIDs, err := s.followedCelebrities(ctx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(celebrityIDs) > 0 {
+		pulled, err := s.store.Posts.GetIDsByAuthors(ctx, celebrityIDs, beforeID, want)
+		if err != nil {
+			return nil, false, err
+		}
+		ids = append(ids, pulled...)
+		slices.SortFunc(ids, func(a, b int64) int { return cmp.Compare(b, a) })
+		ids = slices.Compact(ids)
+	}
+
+	hasMore := len(ids) > fq.Limit
+	if hasMore {
+		ids = ids[:fq.Limit]
+	}
+
+	posts, err := s.store.Posts.GetFeedByIDs(ctx, ids)
+	if err != nil {
+		return nil, false, err
+	}
+
+	page = &store.FeedPage{Posts: posts}
+	if len(posts) == 0 {
+		return page, true, nil
+	}
+
+	first, last := posts[0], posts[len(posts)-1]
+	if hasMore {
+		page.Next = &store.FeedCursor{CreatedAt: last.CreatedAt, ID: last.ID, Sort: fq.Sort}
+	}
+	if fq.Keyset != nil {
+		page.Prev = &store.FeedCursor{CreatedAt: first.CreatedAt, ID: first.ID, Sort: fq.Sort, Backward: true}
+	}
+
+	return page, true, nil
+}
+
+// servable reports whether the timeline holds the answer to fq: newest first,
+// walking forward, without filters.
+func servable(fq store.PaginatedFeedQuery) bool {
+	return fq.Sort == "desc" &&
+		fq.Offset == 0 &&
+		(fq.Keyset == nil || !fq.Keyset.Backward) &&
+		len(fq.Tags) == 0 &&
+		fq.Search == "" &&
+		fq.Since == nil &&
+		fq.Until == nil
+}
+
+func (s *Service) push(ctx context.Context, userIDs []int64, postIDs []int64) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+
+	members := make([]redis.Z, len(postIDs))
+	for i, id := range postIDs {
+		members[i] = redis.Z{Score: float64(id), Member: strconv.FormatInt(id, 10)}
+	}
+
+	pipe := s.rdb.Pipeline()
+	for _, userID := range userIDs {
+		key := timelineKey(userID)
+		// only extend timelines that exist, the others are built on first read
+		pipe.ZAddXX(ctx, key, members...)
+		pipe.ZRemRangeByRank(ctx, key, 0, int64(-s.config.MaxLength-1))
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// isCelebrity checks the follower count of an author, remembering the ones
+// over the threshold so readers can pull their posts. An author dropping
+// below it has their posts backfilled into their followers' timelines.
+func (s *Service) isCelebrity(ctx context.Context, userID int64) (bool, error) {
+	followers, err := s.store.Followers.CountFollowers(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	member := strconv.FormatInt(userID, 10)
+	if followers > s.config.CelebrityThreshold {
+		return true, s.rdb.SAdd(ctx, celebritiesKey, member).Err()
+	}
+
+	was, err := s.rdb.SIsMember(ctx, celebritiesKey, member).Result()
+	if err != nil || !was {
+		return false, err
+	}
+
+	// readers pull the posts until the backfill is done, and a failed
+	// backfill is retried because the author is still in the set
+	if err := s.backfill(ctx, userID); err != nil {
+		return false, err
+	}
+	return false, s.rdb.SRem(ctx, celebritiesKey, member).Err()
+}
+
+// backfill pushes the recent posts of authorID to their followers'
+// timelines, which only pulled them on read while authorID was a celebrity.
+func (s *Service) backfill(ctx context.Context, authorID int64) error {
+	followers, err := s.store.Followers.GetFollowerIDs(ctx, authorID)
+	if err != nil || len(followers) == 0 {
+		return err
+	}
+
+	ids, err := s.store.Posts.GetIDsByAuthors(ctx, []int64{authorID}, math.MaxInt64, s.config.MaxLength)
+	if err != nil {
+		return err
+	}
+
+	return s.push(ctx, followers, ids)
+}
+
+func (s *Service) followedCelebrities(ctx context.Context, userID int64) ([]int64, error) {
+	celebrities, err := s.rdb.SMembers(ctx, celebritiesKey).Result()
+	if err != nil || len(celebrities) == 0 {
+		return nil, err
+	}
+
+	following, err := s.store.Followers.GetFollowingIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for _, id := range following {
+		if slices.Contains(celebrities, strconv.FormatInt(id, 10)) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,28 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/MohammadTaghipour/social/internal/jobs"
+)
+
+// TriggerArgs is an event of UserID, Data is its JSON payload.
+type TriggerArgs struct {
+	Event  string          `json:"event"`
+	UserID int64           `json:"user_id"`
+	Data   json.RawMessage `json:"data"`
+}
+
+var TriggerJob = jobs.Kind[TriggerArgs]{Name: "trigger_webhooks", Queue: "default"}
+
+// RegisterJobs adds the handler of the webhook trigger job to r. A nil s
+// means webhooks are disabled, the job then completes without doing anything.
+func RegisterJobs(r *jobs.Runner, s *Service) {
+	jobs.Handle(r, TriggerJob, func(ctx context.Context, args TriggerArgs) error {
+		if s == nil {
+			return nil
+		}
+		return s.Trigger(ctx, args.Event, args.UserID, args.Data)
+	})
+}
@@ -0,0 +1,223 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/MohammadTaghipour/social/internal/outbound"
+	"github.com/MohammadTaghipour/social/internal/store"
+	"go.uber.org/zap"
+)
+
+const (
+	EventPostCreated    = "post.created"
+	EventPostDeleted    = "post.deleted"
+	EventCommentCreated = "comment.created"
+	EventUserActivated  = "user.activated"
+
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// Events lists every event a webhook can subscribe to.
+var Events = []string{
+	EventPostCreated,
+	EventPostDeleted,
+	EventCommentCreated,
+	EventUserActivated,
+}
+
+type Config struct {
+	DeliveryInterval time.Duration
+	MaxAttempts      int
+	// DisableAfter is how many failed attempts in a row disable a webhook.
+	DisableAfter int
+	// AllowPrivate lets webhooks use plain http and target private and
+	// loopback addresses, for receivers running next to the api in dev.
+	AllowPrivate bool
+	Enabled      bool
+}
+
+// Payload is the body posted to webhooks.
+type Payload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+type Service struct {
+	store  store.Storage
+	client *http.Client
+	config Config
+	logger *zap.SugaredLogger
+}
+
+func New(store store.Storage, client *http.Client, config Config, logger *zap.SugaredLogger) *Service {
+	return &Service{
+		store:  store,
+		client: client,
+		config: config,
+		logger: logger,
+	}
+}
+
+// NewClient returns the client webhooks are delivered with. Users pick the
+// urls, so it refuses plain http and addresses that are not public unless
+// AllowPrivate is set.
+func NewClient(config Config) *http.Client {
+	return outbound.NewClient(outbound.Config{
+		Timeout:      10 * time.Second,
+		AllowPrivate: config.AllowPrivate,
+	})
+}
+
+// CheckURL rejects urls the client would refuse to deliver to.
+func (s *Service) CheckURL(rawURL string) error {
+	return outbound.CheckURL(rawURL, outbound.Config{AllowPrivate: s.config.AllowPrivate})
+}
+
+// Trigger queues event for the webhooks that receive the events of userID.
+func (s *Service) Trigger(ctx context.Context, event string, userID int64, data any) error {
+	payload, err := json.Marshal(Payload{
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.store.Webhooks.Enqueue(ctx, event, userID, payload)
+}
+
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.DeliveryInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Deliver(ctx); err != nil {
+			s.logger.Errorw("error delivering webhooks", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Deliver posts the due deliveries, rescheduling failures with exponential
+// backoff.
+func (s *Service) Deliver(ctx context.Context) error {
+	deliveries, err := s.store.Webhooks.ClaimDeliveries(ctx, 50, time.Minute*5)
+	if err != nil {
+		return err
+	}
+
+	// on shutdown the delivery in progress finishes, the rest are claimed
+	// again once their lease expires
+	stop := ctx
+	ctx = context.WithoutCancel(ctx)
+
+	for i := range deliveries {
+		if stop.Err() != nil {
+			return nil
+		}
+
+		d := &deliveries[i]
+
+		status, err := s.deliver(ctx, d)
+		if err != nil {
+			var retryAt *time.Time
+			if d.Attempts < s.config.MaxAttempts {
+				next := time.Now().Add(backoff(d.Attempts))
+				retryAt = &next
+			}
+
+			s.logger.Warnw("webhook delivery failed", "webhook", d.WebhookID, "attempt", d.Attempts, "error", err.Error())
+			if err := s.store.Webhooks.MarkFailed(ctx, d, status, err.Error(), retryAt, s.config.DisableAfter); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := s.store.Webhooks.MarkDelivered(ctx, d, *status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliver posts d and returns the response status, if there was a response.
+func (s *Service) deliver(ctx context.Context, d *store.WebhookDelivery) (*int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(d.Secret, timestamp, d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// drain so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	status := resp.StatusCode
+	if status < 200 || status > 299 {
+		return &status, fmt.Errorf("unexpected status %d", status)
+	}
+
+	return &status, nil
+}
+
+// Sign returns the signature of a payload sent at timestamp:
+// "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<payload>".
+// Receivers recompute it with their secret and reject stale timestamps.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret generates a signing secret for a webhook.
+func NewSecret() string {
+	return "whsec_" + rand.Text()
+}
+
+func ValidEvent(event string) bool {
+	return slices.Contains(Events, event)
+}
+
+// backoff doubles the wait after every attempt, starting at a minute and
+// capped at a day.
+func backoff(attempts int) time.Duration {
+	wait := time.Minute << min(attempts-1, 11)
+	return min(wait, time.Hour*24)
+}